@@ -4,40 +4,142 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 	"time"
 
 	"codeberg.org/justusbunsi/gitea-sonarqube-bot/internal/api"
 	giteaSdk "codeberg.org/justusbunsi/gitea-sonarqube-bot/internal/clients/gitea"
+	"codeberg.org/justusbunsi/gitea-sonarqube-bot/internal/clients/httpclient"
 	sonarQubeSdk "codeberg.org/justusbunsi/gitea-sonarqube-bot/internal/clients/sonarqube"
+	"codeberg.org/justusbunsi/gitea-sonarqube-bot/internal/dashboard"
+	"codeberg.org/justusbunsi/gitea-sonarqube-bot/internal/health"
+	"codeberg.org/justusbunsi/gitea-sonarqube-bot/internal/logging"
+	"codeberg.org/justusbunsi/gitea-sonarqube-bot/internal/provisioning"
+	"codeberg.org/justusbunsi/gitea-sonarqube-bot/internal/queue"
+	"codeberg.org/justusbunsi/gitea-sonarqube-bot/internal/review"
+	"codeberg.org/justusbunsi/gitea-sonarqube-bot/internal/selfcheck"
 	"codeberg.org/justusbunsi/gitea-sonarqube-bot/internal/settings"
+	"codeberg.org/justusbunsi/gitea-sonarqube-bot/internal/tracing"
 
 	"code.gitea.io/sdk/gitea"
 	"github.com/urfave/cli/v2"
 )
 
 var (
-	HammerTime time.Duration = 15 * time.Second
+	HammerTime          time.Duration = 15 * time.Second
+	ReadHeaderTimeout   time.Duration = 10 * time.Second
+	ReadTimeout         time.Duration = 30 * time.Second
+	IdleTimeout         time.Duration = 120 * time.Second
+	MaxHeaderBytes      int           = 1 << 20
+	StartupCheckTimeout time.Duration = 30 * time.Second
+	ReadinessInterval   time.Duration = 30 * time.Second
+	ReadinessTimeout    time.Duration = 10 * time.Second
+	QueueSize           int           = 100
+	QueueWorkers        int           = 4
+	MaxDeadLetters      int           = 100
+	DashboardCacheTTL   time.Duration = 60 * time.Second
 )
 
 func main() {
+	// Secret sources like Vault use the same TLS, proxy and tracing setup as the API clients
+	settings.NewHttpClient = httpclient.New
+
 	app := &cli.App{
 		Name:        "gitea-sonarqube-bot",
 		Usage:       "Improve your experience with SonarQube and Gitea",
 		Description: `Start an instance of gitea-sonarqube-bot to integrate SonarQube analysis into Gitea Pull Requests.`,
 		Action:      serveApi,
+		Before: func(c *cli.Context) error {
+			return logging.Setup(os.Stderr, c.String("log-format"), c.String("log-level"))
+		},
+		Commands: []*cli.Command{
+			{
+				Name:  "check-config",
+				Usage: "Validate the configuration file without starting the server",
+				Description: `Load and validate the configuration file and report all problems. With --live, additionally check
+that Gitea and SonarQube are reachable with the configured tokens. Exits non-zero if any check fails.`,
+				Action: checkConfig,
+				Flags: []cli.Flag{
+					configFlag(),
+					&cli.BoolFlag{
+						Name:  "live",
+						Usage: "Additionally check access to Gitea and SonarQube.",
+					},
+				},
+			},
+			{
+				Name:      "review",
+				Usage:     "Run the review of a single pull request",
+				UsageText: "gitea-sonarqube-bot review --repo owner/name --pr 42 [--dry-run | --apply]",
+				Description: `Run the same pipeline as the "/sq-bot review" command. By default, the rendered comment and commit status
+are only printed. With --apply, they are written to Gitea.`,
+				Action: reviewPullRequest,
+				Flags: []cli.Flag{
+					configFlag(),
+					&cli.StringFlag{
+						Name:     "repo",
+						Usage:    "Configured Gitea repository in the form owner/name.",
+						Required: true,
+					},
+					&cli.Int64Flag{
+						Name:     "pr",
+						Usage:    "Index of the pull request.",
+						Required: true,
+					},
+					&cli.BoolFlag{
+						Name:  "dry-run",
+						Usage: "Only print comment and status. This is the default.",
+					},
+					&cli.BoolFlag{
+						Name:  "apply",
+						Usage: "Post the comment and set the commit status in Gitea.",
+					},
+				},
+			},
+			{
+				Name:  "setup-webhooks",
+				Usage: "Create or update the bot webhooks in Gitea and SonarQube",
+				Description: `For each configured project, create or update the Gitea repository webhook and the SonarQube project
+webhook pointing to the bot and report any drift. Gitea does not expose secrets of existing webhooks, so a
+changed Gitea secret is only applied when the webhook is created or updated for other reasons.`,
+				Action: setupWebhooks,
+				Flags: []cli.Flag{
+					configFlag(),
+					publicUrlFlag(),
+					&cli.BoolFlag{
+						Name:  "dry-run",
+						Usage: "Only report missing and drifted webhooks.",
+					},
+				},
+			},
+		},
 		Flags: []cli.Flag{
-			&cli.PathFlag{
-				Name:      "config",
-				Aliases:   []string{"c"},
-				Value:     "./config/config.yaml",
-				Usage:     "Full path to configuration file.",
-				EnvVars:   []string{"GITEA_SQ_BOT_CONFIG_PATH"},
-				TakesFile: true,
+			configFlag(),
+			publicUrlFlag(),
+			&cli.StringFlag{
+				Name:    "admin-token",
+				Usage:   "Bearer token for the admin API below /api/v1. The admin API is disabled if empty.",
+				EnvVars: []string{"GITEA_SQ_BOT_ADMIN_TOKEN"},
+			},
+			&cli.BoolFlag{
+				Name:    "dashboard",
+				Usage:   "Serve an overview of all open pull requests at /dashboard. It has no authentication.",
+				EnvVars: []string{"GITEA_SQ_BOT_DASHBOARD"},
+			},
+			&cli.BoolFlag{
+				Name:    "metrics",
+				Usage:   "Serve Prometheus metrics at /metrics. They have no authentication.",
+				EnvVars: []string{"GITEA_SQ_BOT_METRICS"},
+			},
+			&cli.BoolFlag{
+				Name:    "reconcile-webhooks",
+				Usage:   "Create or update the bot webhooks in Gitea and SonarQube on startup. Requires --public-url.",
+				EnvVars: []string{"GITEA_SQ_BOT_RECONCILE_WEBHOOKS"},
 			},
 			&cli.IntFlag{
 				Name:    "port",
@@ -46,12 +148,234 @@ func main() {
 				Usage:   "Port the bot will listen on.",
 				EnvVars: []string{"GITEA_SQ_BOT_PORT"},
 			},
+			&cli.PathFlag{
+				Name:      "tls-cert-file",
+				Usage:     "Full path to PEM encoded certificate. Enables HTTPS together with --tls-key-file. Changes are picked up without restart.",
+				EnvVars:   []string{"GITEA_SQ_BOT_TLS_CERT_FILE"},
+				TakesFile: true,
+			},
+			&cli.PathFlag{
+				Name:      "tls-key-file",
+				Usage:     "Full path to PEM encoded private key matching --tls-cert-file.",
+				EnvVars:   []string{"GITEA_SQ_BOT_TLS_KEY_FILE"},
+				TakesFile: true,
+			},
+			&cli.PathFlag{
+				Name:      "tls-client-ca-file",
+				Usage:     "Full path to PEM encoded CA certificates. If set, webhook senders must present a client certificate signed by one of them.",
+				EnvVars:   []string{"GITEA_SQ_BOT_TLS_CLIENT_CA_FILE"},
+				TakesFile: true,
+			},
+			&cli.StringFlag{
+				Name:    "log-format",
+				Value:   "text",
+				Usage:   "Log format. One of text, json.",
+				EnvVars: []string{"GITEA_SQ_BOT_LOG_FORMAT"},
+			},
+			&cli.StringFlag{
+				Name:    "log-level",
+				Value:   "info",
+				Usage:   "Minimum log level. One of debug, info, warn, error.",
+				EnvVars: []string{"GITEA_SQ_BOT_LOG_LEVEL"},
+			},
+			&cli.BoolFlag{
+				Name:    "strict-startup-check",
+				Usage:   "Refuse to start if the startup check of Gitea and SonarQube access fails.",
+				EnvVars: []string{"GITEA_SQ_BOT_STRICT_STARTUP_CHECK"},
+			},
 		},
 	}
 
 	err := app.Run(os.Args)
 	if err != nil {
-		log.Fatal(err)
+		slog.Error(err.Error())
+		os.Exit(1)
+	}
+}
+
+func configFlag() cli.Flag {
+	return &cli.PathFlag{
+		Name:      "config",
+		Aliases:   []string{"c"},
+		Value:     "./config/config.yaml",
+		Usage:     "Full path to configuration file.",
+		EnvVars:   []string{"GITEA_SQ_BOT_CONFIG_PATH"},
+		TakesFile: true,
+	}
+}
+
+func publicUrlFlag() cli.Flag {
+	return &cli.StringFlag{
+		Name:    "public-url",
+		Usage:   "URL Gitea and SonarQube use to reach the bot, e.g. https://bot.example.com.",
+		EnvVars: []string{"GITEA_SQ_BOT_PUBLIC_URL"},
+	}
+}
+
+func checkConfig(c *cli.Context) error {
+	config := c.Path("config")
+	out := c.App.Writer
+
+	problems := settings.Validate(config)
+	if len(problems) != 0 {
+		fmt.Fprintf(out, "Configuration file '%s' is invalid:\n", config)
+		for _, p := range problems {
+			fmt.Fprintf(out, "  - %s\n", p)
+		}
+		return cli.Exit("", 1)
+	}
+
+	fmt.Fprintf(out, "Configuration file '%s' is valid.\n", config)
+
+	if !c.Bool("live") {
+		return nil
+	}
+
+	// Validating does not apply the configuration
+	settings.Load(config)
+	report, err := runSelfCheck()
+	if err != nil {
+		return cli.Exit(err.Error(), 1)
+	}
+
+	fmt.Fprint(out, report)
+	if report.Failed() {
+		return cli.Exit("", 1)
+	}
+
+	return nil
+}
+
+func reviewPullRequest(c *cli.Context) error {
+	if c.Bool("dry-run") && c.Bool("apply") {
+		return cli.Exit("--dry-run and --apply are mutually exclusive", 1)
+	}
+
+	owner, name, found := strings.Cut(c.String("repo"), "/")
+	if !found || owner == "" || name == "" {
+		return cli.Exit(fmt.Sprintf("invalid repository '%s', expected owner/name", c.String("repo")), 1)
+	}
+
+	settings.Load(c.Path("config"))
+
+	var project *settings.Project
+	projects := settings.Current().Projects
+	for i, p := range projects {
+		if p.Gitea.Owner == owner && p.Gitea.Name == name {
+			project = &projects[i]
+			break
+		}
+	}
+	if project == nil {
+		return cli.Exit(fmt.Sprintf("repository '%s/%s' is not configured", owner, name), 1)
+	}
+
+	// Writing is explicitly requested by --apply, so the dry run mode of the configuration does not apply
+	service := review.NewService(giteaSdk.New(currentGitea, gitea.NewClient), sonarQubeSdk.New(currentSonarQube))
+	index := c.Int64("pr")
+
+	// The result still contains the commit status if only composing the comment failed
+	r, err := service.Prepare(c.Context, *project, index)
+	if r == nil {
+		return cli.Exit(err.Error(), 1)
+	}
+
+	out := c.App.Writer
+	fmt.Fprintf(out, "Commit status for %s:\n  State:   %s\n  Message: %s\n  Url:     %s\n\n", r.HeadRef, r.Status.State, r.Status.Message, r.Status.Url)
+	if err == nil {
+		fmt.Fprintf(out, "Comment:\n%s\n", r.Comment)
+	}
+
+	if c.Bool("apply") {
+		if applyErr := service.Apply(c.Context, *project, index, r); applyErr != nil {
+			return cli.Exit(errors.Join(err, applyErr).Error(), 1)
+		}
+
+		if err == nil {
+			fmt.Fprintf(out, "\nPosted comment and updated status of pull request %s/%s#%d.\n", owner, name, index)
+		} else {
+			fmt.Fprintf(out, "Updated status of pull request %s/%s#%d.\n", owner, name, index)
+		}
+	}
+
+	if err != nil {
+		return cli.Exit(err.Error(), 1)
+	}
+
+	return nil
+}
+
+func setupWebhooks(c *cli.Context) error {
+	if c.String("public-url") == "" {
+		return cli.Exit("--public-url is required", 1)
+	}
+
+	settings.Load(c.Path("config"))
+
+	// Writing is explicitly requested, so Gitea and SonarQube webhooks are both written unless --dry-run is set
+	g := giteaSdk.New(currentGitea, gitea.NewClient)
+	sq := sonarQubeSdk.New(currentSonarQube)
+
+	dryRun := func(settings.GiteaRepository) bool { return c.Bool("dry-run") }
+	report := provisioning.New(g, sq, c.String("public-url"), dryRun).Run(c.Context, settings.Current().Projects)
+
+	fmt.Fprint(c.App.Writer, report)
+	if report.Failed() {
+		return cli.Exit("", 1)
+	}
+
+	return nil
+}
+
+func currentGitea() *settings.GiteaConfig {
+	return &settings.Current().Gitea
+}
+
+func currentSonarQube() *settings.SonarQubeConfig {
+	return &settings.Current().SonarQube
+}
+
+// newGiteaSdk creates a Gitea client that only records writes to repositories in dry run mode.
+func newGiteaSdk() *giteaSdk.RecordingGiteaSdk {
+	return giteaSdk.NewRecordingGiteaSdk(giteaSdk.New(currentGitea, gitea.NewClient), settings.IsDryRun)
+}
+
+func runSelfCheck() (report *selfcheck.Report, err error) {
+	// The SDK constructors panic on invalid client settings like unreadable certificates
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%v", r)
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), StartupCheckTimeout)
+	defer cancel()
+
+	g := giteaSdk.New(currentGitea, gitea.NewClient)
+	sq := sonarQubeSdk.New(currentSonarQube)
+
+	return selfcheck.Run(ctx, g, sq, settings.Current().Projects), nil
+}
+
+// refreshSecrets periodically resolves all secret references again, so rotated tokens and webhook secrets are used
+// without restart. The interval is not changed by configuration reloads.
+func refreshSecrets(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			changed, problems := settings.RefreshSecrets(ctx)
+			for _, p := range problems {
+				slog.Error("Secret refresh failed", "problem", p)
+			}
+			if len(changed) != 0 {
+				slog.Info("Secrets refreshed", "secrets", changed)
+			}
+		}
 	}
 }
 
@@ -59,36 +383,175 @@ func serveApi(c *cli.Context) error {
 	config := c.Path("config")
 	settings.Load(config)
 
-	log.Println("Hi! I'm Gitea SonarQube Bot. At your service.")
-	log.Println("Config file in use:", config)
+	slog.Info("Hi! I'm Gitea SonarQube Bot. At your service.", "config", config)
+
+	shutdownTracing, err := tracing.Setup(context.Background(), &settings.Current().Tracing)
+	if err != nil {
+		return fmt.Errorf("cannot initialize tracing: %w", err)
+	}
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), HammerTime)
+		defer cancel()
+		if err := shutdownTracing(ctx); err != nil {
+			slog.Error("Error flushing traces", "error", err)
+		}
+	}()
+
+	g := newGiteaSdk()
+	sq := sonarQubeSdk.New(currentSonarQube)
 
-	giteaHandler := api.NewGiteaWebhookHandler(giteaSdk.New(&settings.Gitea, gitea.NewClient), sonarQubeSdk.New(&settings.SonarQube))
-	sqHandler := api.NewSonarQubeWebhookHandler(giteaSdk.New(&settings.Gitea, gitea.NewClient), sonarQubeSdk.New(&settings.SonarQube))
+	checkCtx, cancelCheck := context.WithTimeout(context.Background(), StartupCheckTimeout)
+	report := selfcheck.Run(checkCtx, g, sq, settings.Current().Projects)
+	cancelCheck()
+
+	for _, r := range report.Results {
+		if r.Err != nil {
+			slog.Error("Startup check failed", "target", r.Target, "error", r.Err)
+		} else {
+			slog.Info("Startup check passed", "target", r.Target)
+		}
+	}
+	if report.Failed() {
+		if c.Bool("strict-startup-check") {
+			return fmt.Errorf("startup check failed")
+		}
+		slog.Warn("Startup check failed. Affected webhooks will not be processed successfully.")
+	}
+
+	if c.Bool("reconcile-webhooks") {
+		if c.String("public-url") == "" {
+			return fmt.Errorf("--reconcile-webhooks requires --public-url")
+		}
+
+		reconcileCtx, cancelReconcile := context.WithTimeout(context.Background(), StartupCheckTimeout)
+		reconciliation := provisioning.New(g, sq, c.String("public-url"), settings.IsDryRun).Run(reconcileCtx, settings.Current().Projects)
+		cancelReconcile()
+
+		for _, r := range reconciliation.Results {
+			if r.Err != nil {
+				slog.Error("Webhook reconciliation failed", "target", r.Target, "error", r.Err)
+			} else {
+				slog.Info("Webhook reconciled", "target", r.Target, "action", r.Action, "drift", r.Drift, "dryRun", r.DryRun)
+			}
+		}
+	}
+
+	workerCtx, stopWorkers := context.WithCancel(context.Background())
+	defer stopWorkers()
+
+	jobs := queue.New(QueueSize, MaxDeadLetters)
+	jobs.Start(workerCtx, QueueWorkers)
+
+	giteaHandler := api.NewGiteaWebhookHandler(g, sq, jobs)
+	sqHandler := api.NewSonarQubeWebhookHandler(g, sq, jobs)
 	server := api.New(giteaHandler, sqHandler)
+	jobs.OnComplete(server.CompleteDelivery)
+
+	checker := health.NewChecker(ReadinessTimeout, health.Config(), health.Gitea(g), health.SonarQube(sq), health.Queue(jobs))
+	checker.Start(workerCtx, ReadinessInterval)
+	server.EnableReadinessChecks(checker)
+
+	if interval := settings.Current().Secrets.RefreshInterval; interval > 0 {
+		go refreshSecrets(workerCtx, interval)
+	}
+
+	if c.Bool("metrics") {
+		server.EnableMetrics()
+	}
+
+	if c.Bool("dashboard") {
+		server.EnableDashboard(dashboard.NewService(g, sq, g, DashboardCacheTTL))
+	}
+
+	if token := c.String("admin-token"); token != "" {
+		server.EnableAdminApi(token, api.AdminOptions{
+			Recorder: g,
+			Queue:    jobs,
+			Reviewer: review.NewService(g, sq),
+			ReloadConfig: func() []string {
+				problems := settings.Reload(config)
+				for _, p := range problems {
+					slog.Error("Configuration reload failed", "problem", p)
+				}
+				if len(problems) == 0 {
+					slog.Info("Configuration reloaded", "config", config)
+				}
+
+				return problems
+			},
+		})
+	}
+
+	for _, p := range settings.Current().Projects {
+		if p.DryRun {
+			slog.Info("Dry run mode active. Comments and statuses are only recorded.", "repository", p.Gitea.Owner+"/"+p.Gitea.Name)
+		}
+	}
 
 	srv := &http.Server{
-		Addr:    fmt.Sprintf(":%d", c.Int("port")),
-		Handler: server.Engine,
+		Addr:              fmt.Sprintf(":%d", c.Int("port")),
+		Handler:           server.Engine,
+		ReadHeaderTimeout: ReadHeaderTimeout,
+		ReadTimeout:       ReadTimeout,
+		IdleTimeout:       IdleTimeout,
+		MaxHeaderBytes:    MaxHeaderBytes,
+	}
+
+	certFile, keyFile := c.Path("tls-cert-file"), c.Path("tls-key-file")
+	if (certFile == "") != (keyFile == "") {
+		return fmt.Errorf("--tls-cert-file and --tls-key-file must be set together")
+	}
+
+	if certFile == "" && c.Path("tls-client-ca-file") != "" {
+		return fmt.Errorf("--tls-client-ca-file requires --tls-cert-file and --tls-key-file")
+	}
+
+	if certFile != "" {
+		clientCAFile := c.Path("tls-client-ca-file")
+		tlsConfig, err := api.NewTLSConfig(certFile, keyFile, clientCAFile)
+		if err != nil {
+			return err
+		}
+		srv.TLSConfig = tlsConfig
+
+		if clientCAFile != "" {
+			server.RequireClientCertificates()
+		}
 	}
 
 	go func() {
-		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
-			log.Fatalln(err)
+		var err error
+		if srv.TLSConfig != nil {
+			// Certificates are served by the TLS config to support reloading
+			err = srv.ListenAndServeTLS("", "")
+		} else {
+			err = srv.ListenAndServe()
+		}
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			slog.Error(err.Error())
+			os.Exit(1)
 		}
 	}()
 
-	log.Println("Listen on", srv.Addr)
+	slog.Info("Listen", "address", srv.Addr, "tls", srv.TLSConfig != nil)
 
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
 	<-quit
-	log.Println("Shutting down server...")
+	slog.Info("Shutting down server...")
 
 	ctx, cancel := context.WithTimeout(context.Background(), HammerTime)
 	defer cancel()
 
 	if err := srv.Shutdown(ctx); err != nil {
-		log.Fatal("[STOP - Hammer Time] Forcefully shutting down\n", err)
+		slog.Error("[STOP - Hammer Time] Forcefully shutting down", "error", err)
+		os.Exit(1)
+	}
+
+	// Webhooks were already acknowledged, so their jobs are processed before stopping the workers
+	if err := jobs.Shutdown(ctx); err != nil {
+		stats := jobs.Stats()
+		slog.Warn("Dropping unprocessed jobs", "pending", stats.Pending, "waiting", stats.Waiting, "running", stats.Running, "error", err)
 	}
 
 	return nil
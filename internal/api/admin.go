@@ -0,0 +1,236 @@
+package api
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	giteaSdk "codeberg.org/justusbunsi/gitea-sonarqube-bot/internal/clients/gitea"
+	"codeberg.org/justusbunsi/gitea-sonarqube-bot/internal/deliveries"
+	"codeberg.org/justusbunsi/gitea-sonarqube-bot/internal/queue"
+	"codeberg.org/justusbunsi/gitea-sonarqube-bot/internal/settings"
+	"github.com/gin-gonic/gin"
+)
+
+type DryRunRecorderInferface interface {
+	Actions() []giteaSdk.RecordedAction
+}
+
+type ReviewServiceInferface interface {
+	Run(ctx context.Context, project settings.Project, index int64) error
+}
+
+type AdminOptions struct {
+	Recorder DryRunRecorderInferface
+	Queue    JobQueueInferface
+	Reviewer ReviewServiceInferface
+	// Reloads the configuration file and returns the detected problems
+	ReloadConfig func() []string
+}
+
+type projectMapping struct {
+	SonarQube    string                      `json:"sonarqube"`
+	Gitea        settings.GiteaRepository    `json:"gitea"`
+	Metrics      []settings.MetricGroup      `json:"metrics"`
+	Hotspots     settings.HotspotsConfig     `json:"hotspots"`
+	Coverage     settings.CoverageConfig     `json:"coverage"`
+	Duplications settings.DuplicationsConfig `json:"duplications"`
+	DryRun       bool                        `json:"dryRun"`
+}
+
+// bearerAuth rejects requests without the given token in the Authorization header.
+func bearerAuth(token string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		header := c.GetHeader("Authorization")
+		provided := strings.TrimPrefix(header, "Bearer ")
+		if provided == header || subtle.ConstantTimeCompare([]byte(provided), []byte(token)) != 1 {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+				"message": "Missing or invalid admin token.",
+			})
+			return
+		}
+
+		c.Next()
+	}
+}
+
+func findProject(owner, name string) (settings.Project, bool) {
+	for _, p := range settings.Current().Projects {
+		if p.Gitea.Owner == owner && p.Gitea.Name == name {
+			return p, true
+		}
+	}
+
+	return settings.Project{}, false
+}
+
+// EnableAdminApi registers the admin endpoints below /api/v1, protected by the given bearer token.
+func (s *ApiServer) EnableAdminApi(token string, options AdminOptions) {
+	admin := s.Engine.Group("/api/v1", bearerAuth(token))
+
+	admin.GET("/projects", func(c *gin.Context) {
+		config := settings.Current()
+		mappings := []projectMapping{}
+		for _, p := range config.Projects {
+			mappings = append(mappings, projectMapping{
+				SonarQube:    p.SonarQube.Key,
+				Gitea:        p.Gitea,
+				Metrics:      config.SonarQube.GetMetricGroups(&p),
+				Hotspots:     p.Hotspots,
+				Coverage:     p.Coverage,
+				Duplications: p.Duplications,
+				DryRun:       p.DryRun,
+			})
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"projects": mappings,
+		})
+	})
+
+	admin.POST("/projects/:owner/:name/pulls/:index/review", func(c *gin.Context) {
+		project, found := findProject(c.Param("owner"), c.Param("name"))
+		if !found {
+			c.JSON(http.StatusNotFound, gin.H{
+				"message": "Repository not in configured list.",
+			})
+			return
+		}
+
+		index, err := strconv.ParseInt(c.Param("index"), 10, 64)
+		if err != nil || index < 1 {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"message": "Invalid pull request index.",
+			})
+			return
+		}
+
+		name := fmt.Sprintf("review %s/%s#%d", project.Gitea.Owner, project.Gitea.Name, index)
+		job, err := options.Queue.Enqueue(c.Request.Context(), pullRequestKey(project.Gitea, index), name, func(ctx context.Context) error {
+			return options.Reviewer.Run(ctx, project, index)
+		})
+		if err != nil {
+			c.JSON(http.StatusServiceUnavailable, gin.H{
+				"message": "Processing queue is full.",
+			})
+			return
+		}
+
+		c.JSON(http.StatusAccepted, gin.H{
+			"job": job,
+		})
+	})
+
+	admin.GET("/deliveries", func(c *gin.Context) {
+		list := []deliveries.RedactedDelivery{}
+		for _, d := range s.deliveries.List() {
+			r := d.Redacted(nil)
+			r.Body = ""
+			list = append(list, r)
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"deliveries": list,
+		})
+	})
+
+	admin.GET("/deliveries/:id", func(c *gin.Context) {
+		d, found := s.deliveries.Get(c.Param("id"))
+		if !found {
+			c.JSON(http.StatusNotFound, gin.H{
+				"message": "Delivery not found.",
+			})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"delivery": d.Redacted(settings.Current().DeliveryLog.RedactFields),
+		})
+	})
+
+	admin.POST("/deliveries/:id/replay", func(c *gin.Context) {
+		d, found := s.deliveries.Get(c.Param("id"))
+		if !found {
+			c.JSON(http.StatusNotFound, gin.H{
+				"message": "Delivery not found.",
+			})
+			return
+		}
+
+		if d.Body == nil {
+			c.JSON(http.StatusConflict, gin.H{
+				"message": "Request body of the delivery was not stored. Cannot replay.",
+			})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"replay": s.replay(c.Request.Context(), d),
+		})
+	})
+
+	admin.GET("/queue", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{
+			"stats":   options.Queue.Stats(),
+			"pending": options.Queue.Pending(),
+		})
+	})
+
+	admin.GET("/queue/dead-letters", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{
+			"deadLetters": options.Queue.DeadLetters(),
+		})
+	})
+
+	admin.POST("/queue/dead-letters/:id/retry", func(c *gin.Context) {
+		id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"message": "Invalid job ID.",
+			})
+			return
+		}
+
+		job, err := options.Queue.Retry(id)
+		if errors.Is(err, queue.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{
+				"message": "Dead letter not found.",
+			})
+			return
+		} else if err != nil {
+			c.JSON(http.StatusServiceUnavailable, gin.H{
+				"message": "Processing queue is full.",
+			})
+			return
+		}
+
+		c.JSON(http.StatusAccepted, gin.H{
+			"job": job,
+		})
+	})
+
+	admin.POST("/config/reload", func(c *gin.Context) {
+		problems := options.ReloadConfig()
+		if len(problems) != 0 {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{
+				"message":  "Invalid configuration. Keeping the current one.",
+				"problems": problems,
+			})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"message": "Configuration reloaded.",
+		})
+	})
+
+	admin.GET("/dry-run/actions", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{
+			"actions": options.Recorder.Actions(),
+		})
+	})
+}
@@ -0,0 +1,215 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	giteaSdk "codeberg.org/justusbunsi/gitea-sonarqube-bot/internal/clients/gitea"
+	"codeberg.org/justusbunsi/gitea-sonarqube-bot/internal/settings"
+	"github.com/stretchr/testify/assert"
+)
+
+type DryRunRecorderMock struct{}
+
+func (*DryRunRecorderMock) Actions() []giteaSdk.RecordedAction {
+	return []giteaSdk.RecordedAction{
+		{
+			Type:       giteaSdk.RecordedComment,
+			Repository: settings.GiteaRepository{Owner: "test-owner", Name: "test-repo"},
+			Index:      42,
+			Comment:    "comment",
+		},
+	}
+}
+
+type ReviewServiceMock struct {
+	project settings.Project
+	index   int64
+}
+
+func (m *ReviewServiceMock) Run(_ context.Context, project settings.Project, index int64) error {
+	m.project, m.index = project, index
+	return nil
+}
+
+func adminRequest(router *ApiServer, method, path string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(method, path, nil)
+	req.Header.Add("Authorization", "Bearer admin-token")
+	router.Engine.ServeHTTP(w, req)
+
+	return w
+}
+
+func TestAdminApi(t *testing.T) {
+	reviewer := &ReviewServiceMock{}
+	var reloadProblems []string
+
+	router := New(new(GiteaHandlerMock), new(SonarQubeHandlerMock))
+	router.EnableAdminApi("admin-token", AdminOptions{
+		Recorder:     &DryRunRecorderMock{},
+		Queue:        &JobQueueMock{},
+		Reviewer:     reviewer,
+		ReloadConfig: func() []string { return reloadProblems },
+	})
+
+	settings.Current().SonarQube = settings.SonarQubeConfig{}
+	settings.Current().Projects = []settings.Project{
+		{
+			SonarQube: struct{ Key string }{
+				Key: "test-project",
+			},
+			Gitea: settings.GiteaRepository{
+				Owner: "test-owner",
+				Name:  "test-repo",
+			},
+			Metrics: []settings.MetricGroup{{Metrics: []string{"coverage"}}},
+			DryRun:  true,
+		},
+	}
+
+	t.Run("Missing token", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/api/v1/dry-run/actions", nil)
+		router.Engine.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+	})
+
+	t.Run("Invalid token", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/api/v1/dry-run/actions", nil)
+		req.Header.Add("Authorization", "Bearer wrong-token")
+		router.Engine.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+	})
+
+	t.Run("Dry run actions", func(t *testing.T) {
+		w := adminRequest(router, "GET", "/api/v1/dry-run/actions")
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.JSONEq(t, `{"actions":[{"time":"0001-01-01T00:00:00Z","type":"comment","repository":{"owner":"test-owner","name":"test-repo"},"index":42,"comment":"comment"}]}`, w.Body.String())
+	})
+
+	t.Run("Projects", func(t *testing.T) {
+		w := adminRequest(router, "GET", "/api/v1/projects")
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.JSONEq(t, `{"projects":[{"sonarqube":"test-project","gitea":{"owner":"test-owner","name":"test-repo"},"metrics":[{"metrics":["coverage"]}],"hotspots":{"enabled":false},"coverage":{"enabled":false,"maxFiles":0},"duplications":{"enabled":false,"maxFiles":0},"dryRun":true}]}`, w.Body.String())
+	})
+
+	t.Run("Review", func(t *testing.T) {
+		w := adminRequest(router, "POST", "/api/v1/projects/test-owner/test-repo/pulls/42/review")
+
+		assert.Equal(t, http.StatusAccepted, w.Code)
+		assert.Equal(t, "test-project", reviewer.project.SonarQube.Key)
+		assert.Equal(t, int64(42), reviewer.index)
+	})
+
+	t.Run("Review of unknown repository", func(t *testing.T) {
+		w := adminRequest(router, "POST", "/api/v1/projects/test-owner/other-repo/pulls/42/review")
+
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+
+	t.Run("Review with invalid index", func(t *testing.T) {
+		w := adminRequest(router, "POST", "/api/v1/projects/test-owner/test-repo/pulls/abc/review")
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("Deliveries", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/hooks/gitea", nil)
+		req.Header.Add("X-Gitea-Event", "push")
+		req.Header.Add("X-Gitea-Delivery", "test-delivery")
+		router.Engine.ServeHTTP(w, req)
+
+		w = adminRequest(router, "GET", "/api/v1/deliveries")
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), `"id":"`+router.deliveries.List()[0].ID+`","deliveryId":"test-delivery","time":`)
+		assert.Contains(t, w.Body.String(), `"endpoint":"/hooks/gitea","platform":"Gitea","event":"push","headers":{"X-Gitea-Delivery":["test-delivery"],"X-Gitea-Event":["push"]},"statusCode":200,"message":"ignore unknown event","outcome":"ignored"}`)
+	})
+
+	t.Run("Delivery details", func(t *testing.T) {
+		settings.Current().DeliveryLog.StoreBodies = true
+		settings.Current().DeliveryLog.RedactFields = []string{"email"}
+		defer func() {
+			settings.Current().DeliveryLog = settings.DeliveryLogConfig{}
+		}()
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/hooks/gitea", bytes.NewBufferString(`{"sender":{"email":"bot@example.com"}}`))
+		req.Header.Add("X-Gitea-Event", "push")
+		req.Header.Add("X-Gitea-Delivery", "stored-delivery")
+		req.Header.Add("X-Gitea-Signature", "abc")
+		router.Engine.ServeHTTP(w, req)
+
+		w = adminRequest(router, "GET", "/api/v1/deliveries/"+router.deliveries.List()[0].ID)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), `"X-Gitea-Signature":["REDACTED"]`)
+		assert.Contains(t, w.Body.String(), `"body":"{\"sender\":{\"email\":\"REDACTED\"}}"`)
+
+		assert.Equal(t, http.StatusNotFound, adminRequest(router, "GET", "/api/v1/deliveries/unknown").Code)
+	})
+
+	t.Run("Replay delivery", func(t *testing.T) {
+		original := router.deliveries.List()[0].ID
+		w := adminRequest(router, "POST", "/api/v1/deliveries/"+original+"/replay")
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), `"id":"`+router.deliveries.List()[0].ID+`"`)
+		assert.Contains(t, w.Body.String(), `"statusCode":200,"message":"ignore unknown event"`)
+		assert.NotContains(t, w.Body.String(), `"delivery":"stored-delivery"`)
+
+		list := adminRequest(router, "GET", "/api/v1/deliveries")
+		assert.Contains(t, list.Body.String(), `"replayOf":"`+original+`"`)
+	})
+
+	t.Run("Replay delivery without body", func(t *testing.T) {
+		withoutBody := router.deliveries.List()[len(router.deliveries.List())-1].ID
+		assert.Equal(t, http.StatusConflict, adminRequest(router, "POST", "/api/v1/deliveries/"+withoutBody+"/replay").Code)
+		assert.Equal(t, http.StatusNotFound, adminRequest(router, "POST", "/api/v1/deliveries/unknown/replay").Code)
+	})
+
+	t.Run("Queue", func(t *testing.T) {
+		w := adminRequest(router, "GET", "/api/v1/queue")
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.JSONEq(t, `{"stats":{"pending":0,"waiting":0,"running":0,"capacity":100,"deadLetters":1},"pending":[]}`, w.Body.String())
+	})
+
+	t.Run("Dead letters", func(t *testing.T) {
+		w := adminRequest(router, "GET", "/api/v1/queue/dead-letters")
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.JSONEq(t, `{"deadLetters":[{"id":1,"name":"review test-owner/test-repo#42","enqueuedAt":"0001-01-01T00:00:00Z","attempts":1,"lastError":"Gitea unreachable"}]}`, w.Body.String())
+	})
+
+	t.Run("Retry dead letter", func(t *testing.T) {
+		assert.Equal(t, http.StatusAccepted, adminRequest(router, "POST", "/api/v1/queue/dead-letters/1/retry").Code)
+		assert.Equal(t, http.StatusNotFound, adminRequest(router, "POST", "/api/v1/queue/dead-letters/2/retry").Code)
+		assert.Equal(t, http.StatusBadRequest, adminRequest(router, "POST", "/api/v1/queue/dead-letters/abc/retry").Code)
+	})
+
+	t.Run("Reload configuration", func(t *testing.T) {
+		reloadProblems = nil
+		w := adminRequest(router, "POST", "/api/v1/config/reload")
+
+		assert.Equal(t, http.StatusOK, w.Code)
+	})
+
+	t.Run("Reload invalid configuration", func(t *testing.T) {
+		reloadProblems = []string{"Invalid configuration. At least one project mapping is necessary."}
+		w := adminRequest(router, "POST", "/api/v1/config/reload")
+
+		assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+		assert.JSONEq(t, `{"message":"Invalid configuration. Keeping the current one.","problems":["Invalid configuration. At least one project mapping is necessary."]}`, w.Body.String())
+	})
+}
@@ -0,0 +1,40 @@
+package api
+
+import (
+	"context"
+	"net/http"
+
+	"codeberg.org/justusbunsi/gitea-sonarqube-bot/internal/dashboard"
+	"codeberg.org/justusbunsi/gitea-sonarqube-bot/internal/settings"
+	"github.com/gin-gonic/gin"
+)
+
+type DashboardInferface interface {
+	Overview(ctx context.Context) *dashboard.Overview
+}
+
+// EnableDashboard registers the HTML dashboard of open pull requests at /dashboard.
+func (s *ApiServer) EnableDashboard(d DashboardInferface) {
+	s.Engine.SetHTMLTemplate(dashboard.Templates())
+	s.Engine.StaticFS("/dashboard/static", http.FS(dashboard.Static()))
+
+	s.Engine.GET("/dashboard", func(c *gin.Context) {
+		projects := []string{}
+		for _, p := range settings.Current().Projects {
+			projects = append(projects, p.Gitea.Owner+"/"+p.Gitea.Name)
+		}
+
+		project, status := c.Query("project"), c.Query("status")
+		overview := d.Overview(c.Request.Context())
+
+		c.HTML(http.StatusOK, "dashboard.html", gin.H{
+			"Projects": projects,
+			"Project":  project,
+			"Statuses": []string{"OK", "ERROR", dashboard.StatusNone},
+			"Status":   status,
+			"Rows":     dashboard.Filter(overview.Rows, project, status),
+			"Errors":   overview.Errors,
+			"LoadedAt": overview.LoadedAt,
+		})
+	})
+}
@@ -0,0 +1,58 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"codeberg.org/justusbunsi/gitea-sonarqube-bot/internal/dashboard"
+	"codeberg.org/justusbunsi/gitea-sonarqube-bot/internal/settings"
+	"github.com/stretchr/testify/assert"
+)
+
+type DashboardMock struct{}
+
+func (DashboardMock) Overview(_ context.Context) *dashboard.Overview {
+	return &dashboard.Overview{
+		Rows: []dashboard.Row{
+			{Repository: settings.GiteaRepository{Owner: "test-owner", Name: "test-repo"}, Index: 1, Title: "Passing", QualityGate: "OK"},
+			{Repository: settings.GiteaRepository{Owner: "test-owner", Name: "test-repo"}, Index: 2, Title: "Failing", QualityGate: "ERROR"},
+		},
+		LoadedAt: time.Now(),
+	}
+}
+
+func TestDashboard(t *testing.T) {
+	router := New(new(GiteaHandlerMock), new(SonarQubeHandlerMock))
+	router.EnableDashboard(DashboardMock{})
+
+	t.Run("All pull requests", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/dashboard", nil)
+		router.Engine.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), "Passing")
+		assert.Contains(t, w.Body.String(), "Failing")
+	})
+
+	t.Run("Filtered by status", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/dashboard?status=ERROR", nil)
+		router.Engine.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.NotContains(t, w.Body.String(), "Passing")
+		assert.Contains(t, w.Body.String(), "Failing")
+	})
+
+	t.Run("Static assets", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/dashboard/static/style.css", nil)
+		router.Engine.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+	})
+}
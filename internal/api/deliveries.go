@@ -0,0 +1,209 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"codeberg.org/justusbunsi/gitea-sonarqube-bot/internal/dedup"
+	"codeberg.org/justusbunsi/gitea-sonarqube-bot/internal/deliveries"
+	"codeberg.org/justusbunsi/gitea-sonarqube-bot/internal/logging"
+	"codeberg.org/justusbunsi/gitea-sonarqube-bot/internal/queue"
+	"codeberg.org/justusbunsi/gitea-sonarqube-bot/internal/settings"
+	"github.com/gin-gonic/gin"
+)
+
+const deliveryMessageKey = "deliveryMessage"
+
+// Credentials of the sender are not needed for handling webhooks and never stored.
+var unrecordedHeaders = []string{"Authorization", "Cookie", "Proxy-Authorization"}
+
+type deliveryStateKey struct{}
+
+type replayOfKey struct{}
+
+// deliveryState is shared between the delivery recorder and the webhook handlers of a request.
+type deliveryState struct {
+	job       int64
+	duplicate bool
+}
+
+// markScheduled notes the job that processes the webhook of the request.
+func markScheduled(ctx context.Context, job *queue.Job) {
+	if state, ok := ctx.Value(deliveryStateKey{}).(*deliveryState); ok {
+		state.job = job.ID
+	}
+}
+
+// markDuplicate notes that the webhook of the request was ignored as it had been received before.
+func markDuplicate(ctx context.Context) {
+	if state, ok := ctx.Value(deliveryStateKey{}).(*deliveryState); ok {
+		state.duplicate = true
+	}
+}
+
+// isReplay reports whether the request replays a recorded delivery. Replays are explicitly requested and therefore
+// never treated as duplicates.
+func isReplay(ctx context.Context) bool {
+	_, ok := ctx.Value(replayOfKey{}).(string)
+	return ok
+}
+
+// recordDeliveries adds every webhook request and its outcome to the delivery log.
+func recordDeliveries(log *deliveries.Log) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx := c.Request.Context()
+		// Replays bring the ID of their entry to return it
+		id := deliveries.RecordID(ctx)
+		if id == "" {
+			id = deliveries.NewRecordID()
+			ctx = deliveries.WithRecordID(ctx, id)
+		}
+
+		d := deliveries.Delivery{
+			ID:         id,
+			DeliveryID: logging.DeliveryID(ctx),
+			Time:       time.Now(),
+			Endpoint:   c.Request.URL.Path,
+			Header:     c.Request.Header.Clone(),
+			Outcome:    deliveries.OutcomeReceived,
+		}
+		if p, found := detectPlatform(c.Request.Header); found {
+			d.Platform = p.Name
+			d.Event = p.Event(c.Request.Header)
+		}
+		for _, h := range unrecordedHeaders {
+			d.Header.Del(h)
+		}
+		if replayOf, ok := ctx.Value(replayOfKey{}).(string); ok {
+			d.ReplayOf = replayOf
+		}
+
+		if settings.Current().DeliveryLog.StoreBodies && c.Request.Body != nil {
+			body, err := io.ReadAll(c.Request.Body)
+			c.Request.Body.Close()
+			if err != nil {
+				c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+					"message": err.Error(),
+				})
+				return
+			}
+			c.Request.Body = io.NopCloser(bytes.NewReader(body))
+			d.Body = body
+		}
+
+		state := &deliveryState{}
+		c.Request = c.Request.WithContext(context.WithValue(ctx, deliveryStateKey{}, state))
+
+		log.Add(d)
+
+		c.Next()
+
+		log.Update(id, func(d *deliveries.Delivery) {
+			d.StatusCode = c.Writer.Status()
+			d.Message = c.GetString(deliveryMessageKey)
+			d.Job = state.job
+
+			// The job may have finished already
+			if d.Outcome != deliveries.OutcomeReceived {
+				return
+			}
+
+			switch {
+			case d.StatusCode >= http.StatusBadRequest:
+				d.Outcome = deliveries.OutcomeRejected
+			case state.duplicate:
+				d.Outcome = deliveries.OutcomeDuplicate
+			case state.job != 0:
+				d.Outcome = deliveries.OutcomeQueued
+			default:
+				d.Outcome = deliveries.OutcomeIgnored
+			}
+		})
+	}
+}
+
+// deduplicateDeliveries ignores webhooks whose delivery ID assigned by the sender was seen before, e.g. because the
+// sender retried a delivery that timed out. Rejected deliveries are forgotten, so a retry is processed again.
+func deduplicateDeliveries(seen *dedup.Cache) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := ""
+		for _, h := range deliveryHeaders {
+			if id = c.GetHeader(h); id != "" {
+				break
+			}
+		}
+
+		if id == "" || isReplay(c.Request.Context()) {
+			c.Next()
+			return
+		}
+
+		if !seen.Claim(id) {
+			slog.InfoContext(c.Request.Context(), "Received duplicate delivery. Request ignored.")
+			markDuplicate(c.Request.Context())
+			respondToWebhook(c, http.StatusOK, "Duplicate delivery. Request ignored.")
+			c.Abort()
+			return
+		}
+
+		c.Next()
+
+		if c.Writer.Status() >= http.StatusBadRequest {
+			seen.Release(id)
+		}
+	}
+}
+
+// respondToWebhook sends the result of a webhook handler and keeps it for the delivery log.
+func respondToWebhook(c *gin.Context, status int, message string) {
+	c.Set(deliveryMessageKey, message)
+	c.JSON(status, gin.H{
+		"message": message,
+	})
+}
+
+// CompleteDelivery records the result of the job that processed a webhook delivery.
+func (s *ApiServer) CompleteDelivery(job queue.Job, err error) {
+	s.deliveries.Complete(job.Record, err)
+}
+
+type replayResult struct {
+	// ID of the log entry of the replay
+	ID         string `json:"id"`
+	Delivery   string `json:"delivery"`
+	StatusCode int    `json:"statusCode"`
+	Message    string `json:"message"`
+}
+
+// replay sends a recorded delivery through the engine again, so it passes the same validation and handlers as the
+// original request. The replay gets its own delivery ID and log entry.
+func (s *ApiServer) replay(ctx context.Context, d deliveries.Delivery) replayResult {
+	id := deliveries.NewRecordID()
+	req := httptest.NewRequest(http.MethodPost, d.Endpoint, bytes.NewReader(d.Body))
+	req = req.WithContext(deliveries.WithRecordID(context.WithValue(ctx, replayOfKey{}, d.ID), id))
+	req.Header = d.Header.Clone()
+	for _, h := range deliveryHeaders {
+		req.Header.Del(h)
+	}
+
+	w := httptest.NewRecorder()
+	s.Engine.ServeHTTP(w, req)
+
+	response := struct {
+		Message string `json:"message"`
+	}{}
+	_ = json.Unmarshal(w.Body.Bytes(), &response)
+
+	return replayResult{
+		ID:         id,
+		Delivery:   w.Header().Get("X-Request-Id"),
+		StatusCode: w.Code,
+		Message:    response.Message,
+	}
+}
@@ -1,12 +1,15 @@
 package api
 
 import (
+	"context"
+	"fmt"
 	"io/ioutil"
-	"log"
+	"log/slog"
 	"net/http"
 
 	giteaSdk "codeberg.org/justusbunsi/gitea-sonarqube-bot/internal/clients/gitea"
 	sqSdk "codeberg.org/justusbunsi/gitea-sonarqube-bot/internal/clients/sonarqube"
+	"codeberg.org/justusbunsi/gitea-sonarqube-bot/internal/ratelimit"
 	"codeberg.org/justusbunsi/gitea-sonarqube-bot/internal/settings"
 	webhook "codeberg.org/justusbunsi/gitea-sonarqube-bot/internal/webhooks/gitea"
 )
@@ -19,6 +22,9 @@ type GiteaWebhookHandlerInferface interface {
 type GiteaWebhookHandler struct {
 	giteaSdk giteaSdk.GiteaSdkInterface
 	sqSdk    sqSdk.SonarQubeSdkInterface
+	queue    JobQueueInferface
+	// Limits validated webhooks per repository
+	repositories *ratelimit.Limiter
 }
 
 func (h *GiteaWebhookHandler) parseBody(r *http.Request) ([]byte, error) {
@@ -29,26 +35,43 @@ func (h *GiteaWebhookHandler) parseBody(r *http.Request) ([]byte, error) {
 	raw, err := ioutil.ReadAll(r.Body)
 
 	if err != nil {
-		log.Printf("Error reading request body %s", err.Error())
+		slog.ErrorContext(r.Context(), "Error reading request body", "error", err)
 		return nil, err
 	}
 
 	return raw, nil
 }
 
+// schedule hands the processing of a validated webhook for a pull request over to the job queue.
+func (h *GiteaWebhookHandler) schedule(r *http.Request, repo settings.GiteaRepository, index int64, name string, run func(context.Context) error) (int, string) {
+	if !allowRepository(r, h.repositories, repo) {
+		return http.StatusTooManyRequests, "Rate limit for repository exceeded. Request rejected."
+	}
+
+	job, err := h.queue.Enqueue(r.Context(), pullRequestKey(repo, index), name, run)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error scheduling webhook processing", "error", err)
+		return http.StatusServiceUnavailable, "Processing queue is full. Request rejected."
+	}
+	markScheduled(r.Context(), job)
+
+	return http.StatusOK, "Processing data. See bot logs for details."
+}
+
 func (h *GiteaWebhookHandler) HandleSynchronize(r *http.Request) (int, string) {
 	raw, err := h.parseBody(r)
 	if err != nil {
 		return http.StatusInternalServerError, err.Error()
 	}
 
-	ok, err := isValidWebhook(raw, settings.Gitea.Webhook.Secret, r.Header.Get("X-Gitea-Signature"), "Gitea")
+	p, _ := detectPlatform(r.Header)
+	ok, _, err := isValidWebhook(raw, settings.Current().Gitea.Webhook.Secrets(), p.Signature(r.Header), p.Name)
 	if !ok {
-		log.Print(err.Error())
+		slog.WarnContext(r.Context(), "Webhook validation failed", "error", err)
 		return http.StatusPreconditionFailed, "Webhook validation failed. Request rejected."
 	}
 
-	w, ok := webhook.NewPullWebhook(raw)
+	w, ok := webhook.NewPullWebhook(r.Context(), raw)
 	if !ok {
 		return http.StatusUnprocessableEntity, "Error parsing POST body."
 	}
@@ -57,9 +80,11 @@ func (h *GiteaWebhookHandler) HandleSynchronize(r *http.Request) (int, string) {
 		return http.StatusOK, err.Error()
 	}
 
-	w.ProcessData(h.giteaSdk, h.sqSdk)
+	name := fmt.Sprintf("pending status %s/%s@%s", w.Repository.Owner, w.Repository.Name, w.PullRequest.Head.Sha)
 
-	return http.StatusOK, "Processing data. See bot logs for details."
+	return h.schedule(r, w.Repository, w.PullRequest.Number, name, func(ctx context.Context) error {
+		return w.ProcessData(ctx, h.giteaSdk, h.sqSdk)
+	})
 }
 
 func (h *GiteaWebhookHandler) HandleComment(r *http.Request) (int, string) {
@@ -68,13 +93,14 @@ func (h *GiteaWebhookHandler) HandleComment(r *http.Request) (int, string) {
 		return http.StatusInternalServerError, err.Error()
 	}
 
-	ok, err := isValidWebhook(raw, settings.Gitea.Webhook.Secret, r.Header.Get("X-Gitea-Signature"), "Gitea")
+	p, _ := detectPlatform(r.Header)
+	ok, _, err := isValidWebhook(raw, settings.Current().Gitea.Webhook.Secrets(), p.Signature(r.Header), p.Name)
 	if !ok {
-		log.Print(err.Error())
+		slog.WarnContext(r.Context(), "Webhook validation failed", "error", err)
 		return http.StatusPreconditionFailed, "Webhook validation failed. Request rejected."
 	}
 
-	w, ok := webhook.NewCommentWebhook(raw)
+	w, ok := webhook.NewCommentWebhook(r.Context(), raw)
 	if !ok {
 		return http.StatusUnprocessableEntity, "Error parsing POST body."
 	}
@@ -83,14 +109,18 @@ func (h *GiteaWebhookHandler) HandleComment(r *http.Request) (int, string) {
 		return http.StatusOK, err.Error()
 	}
 
-	w.ProcessData(h.giteaSdk, h.sqSdk)
+	name := fmt.Sprintf("review %s/%s#%d", w.Issue.Repository.Owner, w.Issue.Repository.Name, w.Issue.Number)
 
-	return http.StatusOK, "Processing data. See bot logs for details."
+	return h.schedule(r, w.Issue.Repository, w.Issue.Number, name, func(ctx context.Context) error {
+		return w.ProcessData(ctx, h.giteaSdk, h.sqSdk)
+	})
 }
 
-func NewGiteaWebhookHandler(g giteaSdk.GiteaSdkInterface, sq sqSdk.SonarQubeSdkInterface) GiteaWebhookHandlerInferface {
+func NewGiteaWebhookHandler(g giteaSdk.GiteaSdkInterface, sq sqSdk.SonarQubeSdkInterface, q JobQueueInferface) GiteaWebhookHandlerInferface {
 	return &GiteaWebhookHandler{
-		giteaSdk: g,
-		sqSdk:    sq,
+		giteaSdk:     g,
+		sqSdk:        sq,
+		queue:        q,
+		repositories: ratelimit.New(rateLimitWindow),
 	}
 }
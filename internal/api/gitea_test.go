@@ -2,10 +2,14 @@ package api
 
 import (
 	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 
 	"codeberg.org/justusbunsi/gitea-sonarqube-bot/internal/settings"
@@ -14,7 +18,7 @@ import (
 
 func TestHandleGiteaCommentWebhook(t *testing.T) {
 	withValidRequestData := func(t *testing.T, jsonBody []byte) (*http.Request, *httptest.ResponseRecorder, http.HandlerFunc) {
-		webhookHandler := NewGiteaWebhookHandler(new(GiteaSdkMock), new(SQSdkMock))
+		webhookHandler := NewGiteaWebhookHandler(new(GiteaSdkMock), new(SQSdkMock), new(JobQueueMock))
 
 		req, err := http.NewRequest("POST", "/hooks/gitea", bytes.NewBuffer(jsonBody))
 		if err != nil {
@@ -33,15 +37,15 @@ func TestHandleGiteaCommentWebhook(t *testing.T) {
 	}
 
 	t.Run("On success", func(t *testing.T) {
-		settings.Pattern = &settings.PatternConfig{
+		settings.Current().Pattern = &settings.PatternConfig{
 			Template: "PR-%d",
 		}
-		settings.Gitea = settings.GiteaConfig{
+		settings.Current().Gitea = settings.GiteaConfig{
 			Webhook: &settings.Webhook{
 				Secret: "",
 			},
 		}
-		settings.Projects = []settings.Project{
+		settings.Current().Projects = []settings.Project{
 			{
 				SonarQube: struct{ Key string }{
 					Key: "gitea-sonarqube-bot",
@@ -59,20 +63,20 @@ func TestHandleGiteaCommentWebhook(t *testing.T) {
 		assert.Equal(t, `{"message": "Processing data. See bot logs for details."}`, rr.Body.String())
 
 		t.Cleanup(func() {
-			settings.Pattern = nil
+			settings.Current().Pattern = nil
 		})
 	})
 
 	t.Run("With invalid JSON body", func(t *testing.T) {
-		settings.Pattern = &settings.PatternConfig{
+		settings.Current().Pattern = &settings.PatternConfig{
 			Template: "PR-%d",
 		}
-		settings.Gitea = settings.GiteaConfig{
+		settings.Current().Gitea = settings.GiteaConfig{
 			Webhook: &settings.Webhook{
 				Secret: "",
 			},
 		}
-		settings.Projects = []settings.Project{
+		settings.Current().Projects = []settings.Project{
 			{
 				SonarQube: struct{ Key string }{
 					Key: "gitea-sonarqube-bot",
@@ -87,17 +91,17 @@ func TestHandleGiteaCommentWebhook(t *testing.T) {
 		assert.Equal(t, `{"message": "Error parsing POST body."}`, rr.Body.String())
 
 		t.Cleanup(func() {
-			settings.Pattern = nil
+			settings.Current().Pattern = nil
 		})
 	})
 
 	t.Run("With invalid signature", func(t *testing.T) {
-		settings.Gitea = settings.GiteaConfig{
+		settings.Current().Gitea = settings.GiteaConfig{
 			Webhook: &settings.Webhook{
 				Secret: "gitea-comment-test-webhook",
 			},
 		}
-		settings.Projects = []settings.Project{
+		settings.Current().Projects = []settings.Project{
 			{
 				SonarQube: struct{ Key string }{
 					Key: "pr-bot",
@@ -113,12 +117,12 @@ func TestHandleGiteaCommentWebhook(t *testing.T) {
 	})
 
 	t.Run("With ignored project", func(t *testing.T) {
-		settings.Gitea = settings.GiteaConfig{
+		settings.Current().Gitea = settings.GiteaConfig{
 			Webhook: &settings.Webhook{
 				Secret: "",
 			},
 		}
-		settings.Projects = []settings.Project{
+		settings.Current().Projects = []settings.Project{
 			{
 				SonarQube: struct{ Key string }{
 					Key: "gitea-sonarqube-bot",
@@ -135,7 +139,7 @@ func TestHandleGiteaCommentWebhook(t *testing.T) {
 
 func TestHandleGiteaSynchronizeWebhook(t *testing.T) {
 	withValidRequestData := func(t *testing.T, jsonBody []byte) (*http.Request, *httptest.ResponseRecorder, http.HandlerFunc) {
-		webhookHandler := NewGiteaWebhookHandler(new(GiteaSdkMock), new(SQSdkMock))
+		webhookHandler := NewGiteaWebhookHandler(new(GiteaSdkMock), new(SQSdkMock), new(JobQueueMock))
 
 		req, err := http.NewRequest("POST", "/hooks/gitea", bytes.NewBuffer(jsonBody))
 		if err != nil {
@@ -154,12 +158,12 @@ func TestHandleGiteaSynchronizeWebhook(t *testing.T) {
 	}
 
 	t.Run("On success", func(t *testing.T) {
-		settings.Gitea = settings.GiteaConfig{
+		settings.Current().Gitea = settings.GiteaConfig{
 			Webhook: &settings.Webhook{
 				Secret: "",
 			},
 		}
-		settings.Projects = []settings.Project{
+		settings.Current().Projects = []settings.Project{
 			{
 				SonarQube: struct{ Key string }{
 					Key: "gitea-sonarqube-bot",
@@ -178,12 +182,12 @@ func TestHandleGiteaSynchronizeWebhook(t *testing.T) {
 	})
 
 	t.Run("With invalid JSON body", func(t *testing.T) {
-		settings.Gitea = settings.GiteaConfig{
+		settings.Current().Gitea = settings.GiteaConfig{
 			Webhook: &settings.Webhook{
 				Secret: "",
 			},
 		}
-		settings.Projects = []settings.Project{
+		settings.Current().Projects = []settings.Project{
 			{
 				SonarQube: struct{ Key string }{
 					Key: "gitea-sonarqube-bot",
@@ -199,12 +203,12 @@ func TestHandleGiteaSynchronizeWebhook(t *testing.T) {
 	})
 
 	t.Run("With invalid signature", func(t *testing.T) {
-		settings.Gitea = settings.GiteaConfig{
+		settings.Current().Gitea = settings.GiteaConfig{
 			Webhook: &settings.Webhook{
 				Secret: "gitea-synchronize-test-webhook",
 			},
 		}
-		settings.Projects = []settings.Project{
+		settings.Current().Projects = []settings.Project{
 			{
 				SonarQube: struct{ Key string }{
 					Key: "pr-bot",
@@ -220,12 +224,12 @@ func TestHandleGiteaSynchronizeWebhook(t *testing.T) {
 	})
 
 	t.Run("With ignored project", func(t *testing.T) {
-		settings.Gitea = settings.GiteaConfig{
+		settings.Current().Gitea = settings.GiteaConfig{
 			Webhook: &settings.Webhook{
 				Secret: "",
 			},
 		}
-		settings.Projects = []settings.Project{
+		settings.Current().Projects = []settings.Project{
 			{
 				SonarQube: struct{ Key string }{
 					Key: "gitea-sonarqube-bot",
@@ -239,3 +243,73 @@ func TestHandleGiteaSynchronizeWebhook(t *testing.T) {
 		assert.Equal(t, `{"message": "ignore hook for non-configured project 'test-user/gitea-sonarqube-bot'"}`, rr.Body.String())
 	})
 }
+
+func TestHandleGiteaWebhookQueueFull(t *testing.T) {
+	settings.Current().Gitea = settings.GiteaConfig{
+		Webhook: &settings.Webhook{
+			Secret: "",
+		},
+	}
+	settings.Current().Projects = []settings.Project{
+		{
+			SonarQube: struct{ Key string }{
+				Key: "gitea-sonarqube-bot",
+			},
+			Gitea: settings.GiteaRepository{
+				Owner: "test-user",
+				Name:  "gitea-sonarqube-bot",
+			},
+		},
+	}
+
+	webhookHandler := NewGiteaWebhookHandler(new(GiteaSdkMock), new(SQSdkMock), &JobQueueMock{full: true})
+	req := httptest.NewRequest("POST", "/hooks/gitea", bytes.NewBufferString(`{"action":"opened","pull_request":{"number":1,"head":{"sha":"4d3f126f7f6b76c01187a06ec704a8a3055591de"}},"repository":{"name":"gitea-sonarqube-bot","owner":{"login":"test-user"}}}`))
+	status, response := webhookHandler.HandleSynchronize(req)
+
+	assert.Equal(t, http.StatusServiceUnavailable, status)
+	assert.Equal(t, "Processing queue is full. Request rejected.", response)
+}
+
+func TestGiteaWebhookSignatureHeaders(t *testing.T) {
+	settings.Current().Gitea = settings.GiteaConfig{
+		Webhook: &settings.Webhook{
+			Secret: "gitea-test-webhook-secret",
+		},
+	}
+	settings.Current().Projects = []settings.Project{}
+
+	body := []byte(`{"action":"opened","repository":{"name":"gitea-sonarqube-bot","owner":{"login":"test-user"}}}`)
+	mac := hmac.New(sha256.New, []byte("gitea-test-webhook-secret"))
+	mac.Write(body)
+	signature := hex.EncodeToString(mac.Sum(nil))
+
+	for _, tc := range []struct {
+		name     string
+		headers  map[string]string
+		expected int
+	}{
+		{"Gitea", map[string]string{"X-Gitea-Event": "pull_request", "X-Gitea-Signature": signature}, http.StatusOK},
+		{"Forgejo", map[string]string{"X-Forgejo-Event": "pull_request", "X-Forgejo-Signature": signature}, http.StatusOK},
+		{"Forgejo with Gitea compatibility headers", map[string]string{"X-Forgejo-Event": "pull_request", "X-Forgejo-Signature": signature, "X-Gitea-Event": "pull_request", "X-Gitea-Signature": signature}, http.StatusOK},
+		{"GitHub style", map[string]string{"X-Gitea-Event": "pull_request", "X-Hub-Signature-256": "sha256=" + signature}, http.StatusOK},
+		{"Forgejo with GitHub style", map[string]string{"X-Forgejo-Event": "pull_request", "X-Hub-Signature-256": "sha256=" + signature}, http.StatusOK},
+		{"Gogs", map[string]string{"X-Gogs-Event": "pull_request", "X-Gogs-Signature": signature}, http.StatusOK},
+		{"GitHub", map[string]string{"X-GitHub-Event": "pull_request", "X-Hub-Signature-256": "sha256=" + signature}, http.StatusOK},
+		{"Invalid Gogs", map[string]string{"X-Gogs-Event": "pull_request", "X-Gogs-Signature": strings.Repeat("0", 64)}, http.StatusPreconditionFailed},
+		{"Signature of other platform", map[string]string{"X-Forgejo-Event": "pull_request", "X-Gitea-Signature": signature}, http.StatusPreconditionFailed},
+		{"Invalid GitHub style", map[string]string{"X-Gitea-Event": "pull_request", "X-Hub-Signature-256": "sha256=" + strings.Repeat("0", 64)}, http.StatusPreconditionFailed},
+		{"Missing", map[string]string{"X-Gitea-Event": "pull_request"}, http.StatusPreconditionFailed},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			webhookHandler := NewGiteaWebhookHandler(new(GiteaSdkMock), new(SQSdkMock), new(JobQueueMock))
+			req := httptest.NewRequest("POST", "/hooks/gitea", bytes.NewBuffer(body))
+			for name, value := range tc.headers {
+				req.Header.Set(name, value)
+			}
+
+			status, _ := webhookHandler.HandleSynchronize(req)
+
+			assert.Equal(t, tc.expected, status)
+		})
+	}
+}
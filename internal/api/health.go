@@ -0,0 +1,29 @@
+package api
+
+import (
+	"net/http"
+
+	"codeberg.org/justusbunsi/gitea-sonarqube-bot/internal/health"
+	"github.com/gin-gonic/gin"
+)
+
+type ReadinessCheckerInferface interface {
+	Ready() (bool, map[string]health.Result)
+}
+
+// EnableReadinessChecks registers /readyz, reporting the cached results of the given checker.
+func (s *ApiServer) EnableReadinessChecks(checker ReadinessCheckerInferface) {
+	s.Engine.GET("/readyz", func(c *gin.Context) {
+		ready, results := checker.Ready()
+
+		status, state := http.StatusOK, health.StatusOk
+		if !ready {
+			status, state = http.StatusServiceUnavailable, health.StatusFailing
+		}
+
+		c.JSON(status, gin.H{
+			"status": state,
+			"checks": results,
+		})
+	})
+}
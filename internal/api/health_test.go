@@ -0,0 +1,67 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"codeberg.org/justusbunsi/gitea-sonarqube-bot/internal/health"
+	"github.com/stretchr/testify/assert"
+)
+
+type ReadinessCheckerMock struct {
+	ready   bool
+	results map[string]health.Result
+}
+
+func (m *ReadinessCheckerMock) Ready() (bool, map[string]health.Result) {
+	return m.ready, m.results
+}
+
+func TestHealthz(t *testing.T) {
+	router := New(new(GiteaHandlerMock), new(SonarQubeHandlerMock))
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/healthz", nil)
+	router.Engine.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"status":"ok"}`, w.Body.String())
+}
+
+func TestReadyz(t *testing.T) {
+	t.Run("Ready", func(t *testing.T) {
+		router := New(new(GiteaHandlerMock), new(SonarQubeHandlerMock))
+		router.EnableReadinessChecks(&ReadinessCheckerMock{
+			ready: true,
+			results: map[string]health.Result{
+				"gitea": {Status: health.StatusOk},
+			},
+		})
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/readyz", nil)
+		router.Engine.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.JSONEq(t, `{"status":"ok","checks":{"gitea":{"status":"ok"}}}`, w.Body.String())
+	})
+
+	t.Run("Not ready", func(t *testing.T) {
+		router := New(new(GiteaHandlerMock), new(SonarQubeHandlerMock))
+		router.EnableReadinessChecks(&ReadinessCheckerMock{
+			ready: false,
+			results: map[string]health.Result{
+				"gitea":     {Status: health.StatusOk},
+				"sonarqube": {Status: health.StatusFailing, Error: "system status is STARTING"},
+			},
+		})
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/readyz", nil)
+		router.Engine.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+		assert.JSONEq(t, `{"status":"failing","checks":{"gitea":{"status":"ok"},"sonarqube":{"status":"failing","error":"system status is STARTING"}}}`, w.Body.String())
+	})
+}
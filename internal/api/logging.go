@@ -0,0 +1,65 @@
+package api
+
+import (
+	"log/slog"
+	"time"
+
+	"codeberg.org/justusbunsi/gitea-sonarqube-bot/internal/logging"
+	"github.com/gin-gonic/gin"
+)
+
+// deliveryHeaders contain IDs senders assign to webhook deliveries. They are preferred over generated ones to be
+// able to match log lines with the delivery history of the sender.
+var deliveryHeaders = []string{
+	platformForgejo.DeliveryHeader,
+	platformGitea.DeliveryHeader,
+	platformGogs.DeliveryHeader,
+	platformGitHub.DeliveryHeader,
+}
+
+// withDelivery attaches a delivery ID to the request context and returns it as X-Request-Id header.
+func withDelivery() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var id string
+		for _, h := range deliveryHeaders {
+			if id = c.GetHeader(h); id != "" {
+				break
+			}
+		}
+		if id == "" {
+			id = logging.NewDeliveryID()
+		}
+
+		c.Request = c.Request.WithContext(logging.WithDeliveryID(c.Request.Context(), id))
+		c.Header("X-Request-Id", id)
+
+		c.Next()
+	}
+}
+
+// requestLogger writes one log record per request, except for the given paths.
+func requestLogger(skipPaths ...string) gin.HandlerFunc {
+	skip := make(map[string]bool, len(skipPaths))
+	for _, p := range skipPaths {
+		skip[p] = true
+	}
+
+	return func(c *gin.Context) {
+		start := time.Now()
+		path := c.Request.URL.Path
+
+		c.Next()
+
+		if skip[path] {
+			return
+		}
+
+		slog.InfoContext(c.Request.Context(), "Request handled",
+			"method", c.Request.Method,
+			"path", path,
+			"status", c.Writer.Status(),
+			"duration", time.Since(start),
+			"client", c.ClientIP(),
+		)
+	}
+}
@@ -1,8 +1,19 @@
 package api
 
 import (
+	"context"
+	"fmt"
+	"log/slog"
 	"net/http"
-
+	"time"
+
+	"codeberg.org/justusbunsi/gitea-sonarqube-bot/internal/dedup"
+	"codeberg.org/justusbunsi/gitea-sonarqube-bot/internal/deliveries"
+	"codeberg.org/justusbunsi/gitea-sonarqube-bot/internal/health"
+	"codeberg.org/justusbunsi/gitea-sonarqube-bot/internal/metrics"
+	"codeberg.org/justusbunsi/gitea-sonarqube-bot/internal/queue"
+	"codeberg.org/justusbunsi/gitea-sonarqube-bot/internal/ratelimit"
+	"codeberg.org/justusbunsi/gitea-sonarqube-bot/internal/settings"
 	"github.com/gin-gonic/gin"
 )
 
@@ -10,21 +21,45 @@ type validSonarQubeEndpointHeader struct {
 	SonarQubeProject string `header:"X-SonarQube-Project" binding:"required"`
 }
 
-type validGiteaEndpointHeader struct {
-	GiteaEvent string `header:"X-Gitea-Event" binding:"required"`
+// Requests to these paths are neither logged nor traced, as they are polled by monitoring and orchestration tools.
+var probePaths = []string{"/ping", "/favicon.ico", "/healthz", "/readyz", "/metrics"}
+
+// Number of webhook deliveries kept in memory for the admin API
+var DeliveryLogSize = 100
+
+// Duration for which delivery IDs and SonarQube analyses are remembered to ignore duplicate webhooks
+var DeduplicationTTL = 1 * time.Hour
+
+type JobQueueInferface interface {
+	Enqueue(ctx context.Context, key string, name string, run func(context.Context) error) (*queue.Job, error)
+	Retry(id int64) (*queue.Job, error)
+	Pending() []queue.Job
+	DeadLetters() []queue.Job
+	Stats() queue.Stats
+}
+
+// pullRequestKey serializes all jobs for the same pull request in the job queue.
+func pullRequestKey(repo settings.GiteaRepository, index int64) string {
+	return fmt.Sprintf("%s/%s#%d", repo.Owner, repo.Name, index)
 }
 
 type ApiServer struct {
 	Engine                  *gin.Engine
 	sonarQubeWebhookHandler SonarQubeWebhookHandlerInferface
 	giteaWebhookHandler     GiteaWebhookHandlerInferface
+	deliveries              *deliveries.Log
+	clientCertificates      bool
 }
 
 func (s *ApiServer) setup() {
+	if err := s.Engine.SetTrustedProxies(settings.Current().Webhooks.TrustedProxies); err != nil {
+		slog.Error("Cannot set trusted proxies", "error", err)
+	}
+
 	s.Engine.Use(gin.Recovery())
-	s.Engine.Use(gin.LoggerWithConfig(gin.LoggerConfig{
-		SkipPaths: []string{"/ping", "/favicon.ico"},
-	}))
+	s.Engine.Use(withDelivery())
+	s.Engine.Use(withTracing(probePaths...))
+	s.Engine.Use(requestLogger(probePaths...))
 
 	s.Engine.GET("/favicon.ico", func(c *gin.Context) {
 		c.Status(http.StatusNoContent)
@@ -32,7 +67,20 @@ func (s *ApiServer) setup() {
 		c.JSON(http.StatusOK, gin.H{
 			"message": "pong",
 		})
-	}).POST("/hooks/sonarqube", func(c *gin.Context) {
+	}).GET("/healthz", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{
+			"status": health.StatusOk,
+		})
+	})
+
+	hooks := s.Engine.Group("/hooks",
+		s.verifyClientCertificates(),
+		protectWebhooks(ratelimit.New(rateLimitWindow)),
+		recordDeliveries(s.deliveries),
+		deduplicateDeliveries(dedup.New(DeduplicationTTL)),
+	)
+
+	hooks.POST("/sonarqube", func(c *gin.Context) {
 		h := validSonarQubeEndpointHeader{}
 
 		if err := c.ShouldBindHeader(&h); err != nil {
@@ -41,13 +89,12 @@ func (s *ApiServer) setup() {
 		}
 
 		status, response := s.sonarQubeWebhookHandler.Handle(c.Request)
-		c.JSON(status, gin.H{
-			"message": response,
-		})
-	}).POST("/hooks/gitea", func(c *gin.Context) {
-		h := validGiteaEndpointHeader{}
+		respondToWebhook(c, status, response)
+	})
 
-		if err := c.ShouldBindHeader(&h); err != nil {
+	hooks.POST("/gitea", func(c *gin.Context) {
+		p, found := detectPlatform(c.Request.Header)
+		if !found {
 			c.Status(http.StatusNotFound)
 			return
 		}
@@ -55,7 +102,7 @@ func (s *ApiServer) setup() {
 		var status int
 		var response string
 
-		switch h.GiteaEvent {
+		switch p.Event(c.Request.Header) {
 		case "pull_request":
 			status, response = s.giteaWebhookHandler.HandleSynchronize(c.Request)
 		case "issue_comment":
@@ -65,17 +112,22 @@ func (s *ApiServer) setup() {
 			response = "ignore unknown event"
 		}
 
-		c.JSON(status, gin.H{
-			"message": response,
-		})
+		respondToWebhook(c, status, response)
 	})
 }
 
+// EnableMetrics registers the Prometheus metrics at /metrics. They have no authentication and include webhook secret
+// names and repository names.
+func (s *ApiServer) EnableMetrics() {
+	s.Engine.GET("/metrics", gin.WrapH(metrics.Handler()))
+}
+
 func New(giteaHandler GiteaWebhookHandlerInferface, sonarQubeHandler SonarQubeWebhookHandlerInferface) *ApiServer {
 	s := &ApiServer{
 		Engine:                  gin.New(),
 		giteaWebhookHandler:     giteaHandler,
 		sonarQubeWebhookHandler: sonarQubeHandler,
+		deliveries:              deliveries.NewLog(DeliveryLogSize),
 	}
 
 	s.setup()
@@ -2,6 +2,7 @@ package api
 
 import (
 	"bytes"
+	"context"
 	"io/ioutil"
 	"log"
 	"net/http"
@@ -11,6 +12,8 @@ import (
 
 	giteaSdk "codeberg.org/justusbunsi/gitea-sonarqube-bot/internal/clients/gitea"
 	sqSdk "codeberg.org/justusbunsi/gitea-sonarqube-bot/internal/clients/sonarqube"
+	"codeberg.org/justusbunsi/gitea-sonarqube-bot/internal/deliveries"
+	"codeberg.org/justusbunsi/gitea-sonarqube-bot/internal/queue"
 	"codeberg.org/justusbunsi/gitea-sonarqube-bot/internal/settings"
 
 	"github.com/gin-gonic/gin"
@@ -42,34 +45,78 @@ func (h *GiteaHandlerMock) HandleComment(r *http.Request) (int, string) {
 }
 
 type GiteaSdkMock struct {
+	head      string
+	comments  int
+	statusErr error
 	mock.Mock
 }
 
-func (h *GiteaSdkMock) PostComment(_ settings.GiteaRepository, _ int, _ string) error {
+func (h *GiteaSdkMock) PostComment(_ context.Context, _ settings.GiteaRepository, _ int, _ string) error {
+	h.comments++
 	return nil
 }
 
-func (h *GiteaSdkMock) DetermineHEAD(_ settings.GiteaRepository, _ int64) (string, error) {
-	return "", nil
+func (h *GiteaSdkMock) DetermineHEAD(_ context.Context, _ settings.GiteaRepository, _ int64) (string, error) {
+	return h.head, nil
+}
+
+func (h *GiteaSdkMock) GetBotUser(_ context.Context) (string, error) {
+	return "sonarqube-bot", nil
 }
 
-func (h *GiteaSdkMock) UpdateStatus(_ settings.GiteaRepository, _ string, _ giteaSdk.StatusDetails) error {
+func (h *GiteaSdkMock) CheckRepositoryAccess(_ context.Context, _ settings.GiteaRepository) error {
 	return nil
 }
 
+func (h *GiteaSdkMock) ListOpenPullRequests(_ context.Context, _ settings.GiteaRepository) ([]giteaSdk.PullRequest, error) {
+	return []giteaSdk.PullRequest{}, nil
+}
+
+func (h *GiteaSdkMock) ListHooks(_ context.Context, _ settings.GiteaRepository) ([]giteaSdk.Hook, error) {
+	return []giteaSdk.Hook{}, nil
+}
+
+func (h *GiteaSdkMock) CreateHook(_ context.Context, _ settings.GiteaRepository, _ giteaSdk.Hook, _ string) error {
+	return nil
+}
+
+func (h *GiteaSdkMock) EditHook(_ context.Context, _ settings.GiteaRepository, _ giteaSdk.Hook, _ string) error {
+	return nil
+}
+
+func (h *GiteaSdkMock) UpdateStatus(_ context.Context, _ settings.GiteaRepository, _ string, _ giteaSdk.StatusDetails) error {
+	return h.statusErr
+}
+
 type SQSdkMock struct {
 	mock.Mock
 }
 
-func (h *SQSdkMock) GetMeasures(project string, branch string) (*sqSdk.MeasuresResponse, error) {
+func (h *SQSdkMock) GetMeasures(ctx context.Context, project string, branch string, metrics []string) (*sqSdk.MeasuresResponse, error) {
 	return &sqSdk.MeasuresResponse{}, nil
 }
 
+func (h *SQSdkMock) GetHotspots(ctx context.Context, project string, branch string) (*sqSdk.HotspotsResponse, error) {
+	return &sqSdk.HotspotsResponse{}, nil
+}
+
+func (h *SQSdkMock) GetComponentTree(ctx context.Context, project string, branch string, metrics []string) (*sqSdk.ComponentTreeResponse, error) {
+	return &sqSdk.ComponentTreeResponse{}, nil
+}
+
+func (h *SQSdkMock) GetSourceLines(ctx context.Context, component string, branch string) (*sqSdk.SourceLinesResponse, error) {
+	return &sqSdk.SourceLinesResponse{}, nil
+}
+
+func (h *SQSdkMock) GetDuplications(ctx context.Context, component string, branch string) (*sqSdk.DuplicationsResponse, error) {
+	return &sqSdk.DuplicationsResponse{}, nil
+}
+
 func (h *SQSdkMock) GetPullRequestUrl(project string, index int64) string {
 	return ""
 }
 
-func (h *SQSdkMock) GetPullRequest(project string, index int64) (*sqSdk.PullRequest, error) {
+func (h *SQSdkMock) GetPullRequest(ctx context.Context, project string, index int64) (*sqSdk.PullRequest, error) {
 	return &sqSdk.PullRequest{
 		Status: struct {
 			QualityGateStatus string "json:\"qualityGateStatus\""
@@ -79,16 +126,80 @@ func (h *SQSdkMock) GetPullRequest(project string, index int64) (*sqSdk.PullRequ
 	}, nil
 }
 
-func (h *SQSdkMock) ComposeGiteaComment(data *sqSdk.CommentComposeData) (string, error) {
+func (h *SQSdkMock) ListPullRequests(ctx context.Context, project string) ([]sqSdk.PullRequest, error) {
+	return []sqSdk.PullRequest{}, nil
+}
+
+func (h *SQSdkMock) ValidateToken(ctx context.Context) error {
+	return nil
+}
+
+func (h *SQSdkMock) CheckProject(ctx context.Context, project string) error {
+	return nil
+}
+
+func (h *SQSdkMock) GetSystemStatus(ctx context.Context) (string, error) {
+	return "UP", nil
+}
+
+func (h *SQSdkMock) ListWebhooks(ctx context.Context, project string) ([]sqSdk.Webhook, error) {
+	return []sqSdk.Webhook{}, nil
+}
+
+func (h *SQSdkMock) CreateWebhook(ctx context.Context, project string, hook sqSdk.Webhook, secret string) error {
+	return nil
+}
+
+func (h *SQSdkMock) UpdateWebhook(ctx context.Context, hook sqSdk.Webhook, secret string) error {
+	return nil
+}
+
+func (h *SQSdkMock) ComposeGiteaComment(ctx context.Context, data *sqSdk.CommentComposeData) (string, error) {
 	return "", nil
 }
 
+// JobQueueMock runs jobs immediately instead of scheduling them.
+type JobQueueMock struct {
+	full bool
+}
+
+func (q *JobQueueMock) Enqueue(ctx context.Context, key string, name string, run func(context.Context) error) (*queue.Job, error) {
+	if q.full {
+		return nil, queue.ErrFull
+	}
+
+	_ = run(ctx)
+
+	return &queue.Job{ID: 1, Key: key, Name: name}, nil
+}
+
+func (q *JobQueueMock) Retry(id int64) (*queue.Job, error) {
+	if id != 1 {
+		return nil, queue.ErrNotFound
+	}
+
+	return &queue.Job{ID: 1, Name: "review test-owner/test-repo#42", Attempts: 1}, nil
+}
+
+func (q *JobQueueMock) Pending() []queue.Job {
+	return []queue.Job{}
+}
+
+func (q *JobQueueMock) DeadLetters() []queue.Job {
+	return []queue.Job{{ID: 1, Name: "review test-owner/test-repo#42", Attempts: 1, LastError: "Gitea unreachable"}}
+}
+
+func (q *JobQueueMock) Stats() queue.Stats {
+	return queue.Stats{Capacity: 100, DeadLetters: 1}
+}
+
 // SETUP: mute logs
 func TestMain(m *testing.M) {
 	gin.SetMode(gin.TestMode)
 	gin.DefaultWriter = ioutil.Discard
 	gin.DefaultErrorWriter = ioutil.Discard
 	log.SetOutput(ioutil.Discard)
+	settings.Current().Webhooks.MaxBodySize = 1 << 20
 	os.Exit(m.Run())
 }
 
@@ -187,6 +298,49 @@ func TestGiteaAPIRoute(t *testing.T) {
 		giteaHandlerMock.AssertExpectations(t)
 	})
 
+	t.Run("Processing Forgejo comment", func(t *testing.T) {
+		giteaHandlerMock := new(GiteaHandlerMock)
+		giteaHandlerMock.On("HandleSynchronize", mock.Anything, mock.Anything).Maybe()
+		giteaHandlerMock.On("HandleComment", mock.Anything, mock.Anything).Return(nil)
+
+		router := New(giteaHandlerMock, new(SonarQubeHandlerMock))
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/hooks/gitea", bytes.NewBuffer([]byte(`{}`)))
+		req.Header.Add("X-Forgejo-Event", "issue_comment")
+		req.Header.Add("X-Forgejo-Delivery", "forgejo-delivery")
+		router.Engine.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "forgejo-delivery", w.Header().Get("X-Request-Id"))
+		giteaHandlerMock.AssertNumberOfCalls(t, "HandleComment", 1)
+
+		d := router.deliveries.List()[0]
+		assert.Equal(t, "forgejo-delivery", d.DeliveryID)
+		assert.Equal(t, "Forgejo", d.Platform)
+		assert.Equal(t, "issue_comment", d.Event)
+	})
+
+	t.Run("Processing legacy headers", func(t *testing.T) {
+		for event, delivery := range map[string]string{"X-Gogs-Event": "X-Gogs-Delivery", "X-GitHub-Event": "X-GitHub-Delivery"} {
+			giteaHandlerMock := new(GiteaHandlerMock)
+			giteaHandlerMock.On("HandleSynchronize", mock.Anything, mock.Anything).Return(nil)
+			giteaHandlerMock.On("HandleComment", mock.Anything, mock.Anything).Maybe()
+
+			router := New(giteaHandlerMock, new(SonarQubeHandlerMock))
+
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("POST", "/hooks/gitea", bytes.NewBuffer([]byte(`{}`)))
+			req.Header.Add(event, "pull_request")
+			req.Header.Add(delivery, "legacy-delivery")
+			router.Engine.ServeHTTP(w, req)
+
+			assert.Equal(t, http.StatusOK, w.Code, event)
+			assert.Equal(t, "legacy-delivery", w.Header().Get("X-Request-Id"), event)
+			giteaHandlerMock.AssertNumberOfCalls(t, "HandleSynchronize", 1)
+		}
+	})
+
 	t.Run("Unknown event", func(t *testing.T) {
 		giteaHandlerMock := new(GiteaHandlerMock)
 		giteaHandlerMock.On("HandleSynchronize", mock.Anything, mock.Anything).Maybe()
@@ -205,3 +359,68 @@ func TestGiteaAPIRoute(t *testing.T) {
 		giteaHandlerMock.AssertExpectations(t)
 	})
 }
+
+func TestDeliveryID(t *testing.T) {
+	t.Run("Gitea delivery header", func(t *testing.T) {
+		router := New(new(GiteaHandlerMock), new(SonarQubeHandlerMock))
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/ping", nil)
+		req.Header.Add("X-Gitea-Delivery", "f6266f16-1d2b-4c23-b4b6-5a9f0d8e0a1c")
+		router.Engine.ServeHTTP(w, req)
+
+		assert.Equal(t, "f6266f16-1d2b-4c23-b4b6-5a9f0d8e0a1c", w.Header().Get("X-Request-Id"))
+	})
+
+	t.Run("Generated", func(t *testing.T) {
+		router := New(new(GiteaHandlerMock), new(SonarQubeHandlerMock))
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/ping", nil)
+		router.Engine.ServeHTTP(w, req)
+
+		assert.Len(t, w.Header().Get("X-Request-Id"), 32)
+	})
+}
+
+func TestDuplicateDeliveries(t *testing.T) {
+	send := func(router *ApiServer, event string, delivery string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/hooks/gitea", bytes.NewBuffer([]byte(`{}`)))
+		if event != "" {
+			req.Header.Add("X-Gitea-Event", event)
+		}
+		req.Header.Add("X-Gitea-Delivery", delivery)
+		router.Engine.ServeHTTP(w, req)
+
+		return w
+	}
+
+	t.Run("Ignored", func(t *testing.T) {
+		giteaHandlerMock := new(GiteaHandlerMock)
+		giteaHandlerMock.On("HandleSynchronize", mock.Anything, mock.Anything).Return(nil)
+		router := New(giteaHandlerMock, new(SonarQubeHandlerMock))
+
+		assert.Equal(t, http.StatusOK, send(router, "pull_request", "first").Code)
+		w := send(router, "pull_request", "first")
+		assert.Equal(t, http.StatusOK, send(router, "pull_request", "second").Code)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.JSONEq(t, `{"message":"Duplicate delivery. Request ignored."}`, w.Body.String())
+		giteaHandlerMock.AssertNumberOfCalls(t, "HandleSynchronize", 2)
+		assert.Equal(t, deliveries.OutcomeDuplicate, router.deliveries.List()[1].Outcome)
+		assert.Equal(t, deliveries.OutcomeIgnored, router.deliveries.List()[2].Outcome, "Duplicate changed the original delivery")
+		assert.NotEqual(t, router.deliveries.List()[1].ID, router.deliveries.List()[2].ID)
+	})
+
+	t.Run("Processed again after rejection", func(t *testing.T) {
+		giteaHandlerMock := new(GiteaHandlerMock)
+		giteaHandlerMock.On("HandleSynchronize", mock.Anything, mock.Anything).Return(nil)
+		router := New(giteaHandlerMock, new(SonarQubeHandlerMock))
+
+		assert.Equal(t, http.StatusNotFound, send(router, "", "first").Code)
+		assert.Equal(t, http.StatusOK, send(router, "pull_request", "first").Code)
+
+		giteaHandlerMock.AssertNumberOfCalls(t, "HandleSynchronize", 1)
+	})
+}
@@ -0,0 +1,76 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+)
+
+// Header of GitHub compatible senders and proxies, containing the signature prefixed by "sha256="
+const hubSignatureHeader = "X-Hub-Signature-256"
+
+// platform describes the webhook headers of a Gitea compatible forge sending to `/hooks/gitea`.
+type platform struct {
+	Name            string
+	EventHeader     string
+	SignatureHeader string
+	DeliveryHeader  string
+}
+
+var (
+	platformForgejo = platform{
+		Name:            "Forgejo",
+		EventHeader:     "X-Forgejo-Event",
+		SignatureHeader: "X-Forgejo-Signature",
+		DeliveryHeader:  "X-Forgejo-Delivery",
+	}
+	platformGitea = platform{
+		Name:            "Gitea",
+		EventHeader:     "X-Gitea-Event",
+		SignatureHeader: "X-Gitea-Signature",
+		DeliveryHeader:  "X-Gitea-Delivery",
+	}
+	// Headers of Gogs, which Gitea was forked from. Older Gitea versions and some proxies only send these.
+	platformGogs = platform{
+		Name:            "Gogs",
+		EventHeader:     "X-Gogs-Event",
+		SignatureHeader: "X-Gogs-Signature",
+		DeliveryHeader:  "X-Gogs-Delivery",
+	}
+	// Gitea payloads forwarded with GitHub style headers only, e.g. by proxies
+	platformGitHub = platform{
+		Name:            "GitHub",
+		EventHeader:     "X-GitHub-Event",
+		SignatureHeader: hubSignatureHeader,
+		DeliveryHeader:  "X-GitHub-Delivery",
+	}
+)
+
+// Forgejo and Gitea send the headers of their predecessors as well for compatibility, so they must be detected first.
+var platforms = []platform{platformForgejo, platformGitea, platformGogs, platformGitHub}
+
+// detectPlatform determines the sending forge by its event header.
+func detectPlatform(header http.Header) (platform, bool) {
+	for _, p := range platforms {
+		if header.Get(p.EventHeader) != "" {
+			return p, true
+		}
+	}
+
+	return platform{}, false
+}
+
+// Event returns the webhook event of the request.
+func (p platform) Event(header http.Header) string {
+	return header.Get(p.EventHeader)
+}
+
+// Signature returns the hex encoded signature of the request. The header of the platform takes precedence over the
+// GitHub style header.
+func (p platform) Signature(header http.Header) string {
+	signature := header.Get(p.SignatureHeader)
+	if signature == "" {
+		signature = header.Get(hubSignatureHeader)
+	}
+
+	return strings.TrimPrefix(signature, "sha256=")
+}
@@ -0,0 +1,121 @@
+package api
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDetectPlatform(t *testing.T) {
+	t.Run("Gitea", func(t *testing.T) {
+		header := http.Header{}
+		header.Set("X-Gitea-Event", "pull_request")
+
+		p, found := detectPlatform(header)
+
+		assert.True(t, found)
+		assert.Equal(t, "Gitea", p.Name)
+		assert.Equal(t, "pull_request", p.Event(header))
+	})
+
+	t.Run("Forgejo with Gitea compatibility headers", func(t *testing.T) {
+		header := http.Header{}
+		header.Set("X-Forgejo-Event", "issue_comment")
+		header.Set("X-Gitea-Event", "issue_comment")
+
+		p, found := detectPlatform(header)
+
+		assert.True(t, found)
+		assert.Equal(t, "Forgejo", p.Name)
+		assert.Equal(t, "issue_comment", p.Event(header))
+	})
+
+	t.Run("Gogs", func(t *testing.T) {
+		header := http.Header{}
+		header.Set("X-Gogs-Event", "pull_request")
+
+		p, found := detectPlatform(header)
+
+		assert.True(t, found)
+		assert.Equal(t, "Gogs", p.Name)
+		assert.Equal(t, "pull_request", p.Event(header))
+	})
+
+	t.Run("Gitea with compatibility headers", func(t *testing.T) {
+		header := http.Header{}
+		header.Set("X-Gitea-Event", "pull_request")
+		header.Set("X-Gogs-Event", "pull_request")
+		header.Set("X-GitHub-Event", "pull_request")
+
+		p, found := detectPlatform(header)
+
+		assert.True(t, found)
+		assert.Equal(t, "Gitea", p.Name)
+	})
+
+	t.Run("GitHub style", func(t *testing.T) {
+		header := http.Header{}
+		header.Set("X-GitHub-Event", "issue_comment")
+
+		p, found := detectPlatform(header)
+
+		assert.True(t, found)
+		assert.Equal(t, "GitHub", p.Name)
+		assert.Equal(t, "issue_comment", p.Event(header))
+	})
+
+	t.Run("Unknown", func(t *testing.T) {
+		header := http.Header{}
+		header.Set("X-GitLab-Event", "Merge Request Hook")
+
+		_, found := detectPlatform(header)
+
+		assert.False(t, found)
+	})
+}
+
+func TestPlatformSignature(t *testing.T) {
+	t.Run("Platform header", func(t *testing.T) {
+		header := http.Header{}
+		header.Set("X-Forgejo-Signature", "abc")
+		header.Set("X-Gitea-Signature", "def")
+
+		assert.Equal(t, "abc", platformForgejo.Signature(header))
+		assert.Equal(t, "def", platformGitea.Signature(header))
+	})
+
+	t.Run("Gogs header", func(t *testing.T) {
+		header := http.Header{}
+		header.Set("X-Gogs-Signature", "abc")
+
+		assert.Equal(t, "abc", platformGogs.Signature(header))
+		assert.Equal(t, "", platformGitea.Signature(header))
+	})
+
+	t.Run("GitHub platform", func(t *testing.T) {
+		header := http.Header{}
+		header.Set("X-Hub-Signature-256", "sha256=abc")
+
+		assert.Equal(t, "abc", platformGitHub.Signature(header))
+	})
+
+	t.Run("GitHub style header", func(t *testing.T) {
+		header := http.Header{}
+		header.Set("X-Hub-Signature-256", "sha256=abc")
+
+		assert.Equal(t, "abc", platformGitea.Signature(header))
+	})
+
+	t.Run("Platform header takes precedence", func(t *testing.T) {
+		header := http.Header{}
+		header.Set("X-Gitea-Signature", "abc")
+		header.Set("X-Hub-Signature-256", "sha256=def")
+
+		assert.Equal(t, "abc", platformGitea.Signature(header))
+	})
+
+	t.Run("Missing", func(t *testing.T) {
+		assert.Equal(t, "", platformGitea.Signature(http.Header{}))
+	})
+}
@@ -0,0 +1,99 @@
+package api
+
+import (
+	"bytes"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"codeberg.org/justusbunsi/gitea-sonarqube-bot/internal/metrics"
+	"codeberg.org/justusbunsi/gitea-sonarqube-bot/internal/ratelimit"
+	"codeberg.org/justusbunsi/gitea-sonarqube-bot/internal/settings"
+	"github.com/gin-gonic/gin"
+)
+
+// Rate limits are configured per minute
+const rateLimitWindow = time.Minute
+
+const (
+	rejectedSource              = "source_not_allowed"
+	rejectedBodySize            = "body_too_large"
+	rejectedRateLimitSource     = "rate_limited_source"
+	rejectedRateLimitRepository = "rate_limited_repository"
+	rejectedClientCertificate   = "client_certificate_missing"
+)
+
+var rejectedWebhooks = metrics.NewCounter(
+	"gitea_sonarqube_bot_webhooks_rejected_total",
+	"Webhook requests rejected by client certificate, source, size or rate limit checks.",
+	"endpoint", "reason",
+)
+
+// protectWebhooks rejects webhooks from unknown sources, above the per-source rate limit or with oversized bodies before
+// they are recorded as deliveries. Replays were already checked when received and are explicitly requested, so only
+// their size is checked.
+func protectWebhooks(sources *ratelimit.Limiter) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx := c.Request.Context()
+		config := settings.Current().Webhooks
+		client := c.ClientIP()
+
+		reject := func(status int, reason string, message string) {
+			slog.WarnContext(ctx, "Webhook rejected", "reason", reason, "client", client)
+			rejectedWebhooks.Inc(c.Request.URL.Path, reason)
+			c.AbortWithStatusJSON(status, gin.H{
+				"message": message,
+			})
+		}
+
+		if !isReplay(ctx) {
+			if !config.IsAllowedSource(client) {
+				reject(http.StatusForbidden, rejectedSource, "Source not allowed. Request rejected.")
+				return
+			}
+
+			if !sources.Allow(client, config.RateLimit.PerSource) {
+				reject(http.StatusTooManyRequests, rejectedRateLimitSource, "Rate limit exceeded. Request rejected.")
+				return
+			}
+		}
+
+		if c.Request.ContentLength > config.MaxBodySize {
+			reject(http.StatusRequestEntityTooLarge, rejectedBodySize, "Request body too large. Request rejected.")
+			return
+		}
+
+		if c.Request.Body != nil {
+			// The content length is not known for chunked requests, so the size is checked while reading
+			body, err := io.ReadAll(io.LimitReader(c.Request.Body, config.MaxBodySize+1))
+			c.Request.Body.Close()
+			if err != nil {
+				c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+					"message": err.Error(),
+				})
+				return
+			}
+
+			if int64(len(body)) > config.MaxBodySize {
+				reject(http.StatusRequestEntityTooLarge, rejectedBodySize, "Request body too large. Request rejected.")
+				return
+			}
+			c.Request.Body = io.NopCloser(bytes.NewReader(body))
+		}
+
+		c.Next()
+	}
+}
+
+// allowRepository applies the per-repository rate limit to a validated webhook.
+func allowRepository(r *http.Request, limiter *ratelimit.Limiter, repo settings.GiteaRepository) bool {
+	if limiter.Allow(repo.Owner+"/"+repo.Name, settings.Current().Webhooks.RateLimit.PerRepository) {
+		return true
+	}
+
+	slog.WarnContext(r.Context(), "Webhook rejected", "reason", rejectedRateLimitRepository, "repository", repo.Owner+"/"+repo.Name)
+	rejectedWebhooks.Inc(r.URL.Path, rejectedRateLimitRepository)
+
+	return false
+}
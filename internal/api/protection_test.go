@@ -0,0 +1,155 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"codeberg.org/justusbunsi/gitea-sonarqube-bot/internal/settings"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProtectWebhooks(t *testing.T) {
+	withWebhooksConfig := func(t *testing.T, c settings.WebhooksConfig) {
+		original := settings.Current().Webhooks
+		settings.Current().Webhooks = c
+		t.Cleanup(func() {
+			settings.Current().Webhooks = original
+		})
+	}
+
+	send := func(router *ApiServer, remoteAddr string, body io.Reader) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", "/hooks/gitea", body)
+		req.RemoteAddr = remoteAddr
+		req.Header.Add("X-Gitea-Event", "push")
+		router.Engine.ServeHTTP(w, req)
+
+		return w
+	}
+
+	t.Run("Allowed sources", func(t *testing.T) {
+		_, network, _ := net.ParseCIDR("192.0.2.0/24")
+		withWebhooksConfig(t, settings.WebhooksConfig{MaxBodySize: 1024, AllowedSources: []*net.IPNet{network}})
+		router := New(new(GiteaHandlerMock), new(SonarQubeHandlerMock))
+		before := rejectedWebhooks.Value("/hooks/gitea", rejectedSource)
+
+		assert.Equal(t, http.StatusOK, send(router, "192.0.2.10:4711", nil).Code)
+		w := send(router, "198.51.100.10:4711", nil)
+
+		assert.Equal(t, http.StatusForbidden, w.Code)
+		assert.JSONEq(t, `{"message":"Source not allowed. Request rejected."}`, w.Body.String())
+		assert.Equal(t, before+1, rejectedWebhooks.Value("/hooks/gitea", rejectedSource))
+		assert.Len(t, router.deliveries.List(), 1, "Rejected requests are not recorded as deliveries")
+	})
+
+	t.Run("Forwarded source of untrusted proxy", func(t *testing.T) {
+		_, network, _ := net.ParseCIDR("192.0.2.0/24")
+		withWebhooksConfig(t, settings.WebhooksConfig{MaxBodySize: 1024, AllowedSources: []*net.IPNet{network}})
+		router := New(new(GiteaHandlerMock), new(SonarQubeHandlerMock))
+
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", "/hooks/gitea", nil)
+		req.RemoteAddr = "198.51.100.10:4711"
+		req.Header.Add("X-Gitea-Event", "push")
+		req.Header.Add("X-Forwarded-For", "192.0.2.10")
+		router.Engine.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusForbidden, w.Code)
+	})
+
+	t.Run("Forwarded source of trusted proxy", func(t *testing.T) {
+		_, network, _ := net.ParseCIDR("192.0.2.0/24")
+		withWebhooksConfig(t, settings.WebhooksConfig{
+			MaxBodySize:    1024,
+			AllowedSources: []*net.IPNet{network},
+			TrustedProxies: []string{"198.51.100.10"},
+		})
+		router := New(new(GiteaHandlerMock), new(SonarQubeHandlerMock))
+
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", "/hooks/gitea", nil)
+		req.RemoteAddr = "198.51.100.10:4711"
+		req.Header.Add("X-Gitea-Event", "push")
+		req.Header.Add("X-Forwarded-For", "192.0.2.10")
+		router.Engine.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+	})
+
+	t.Run("Rate limit per source", func(t *testing.T) {
+		withWebhooksConfig(t, settings.WebhooksConfig{MaxBodySize: 1024, RateLimit: settings.RateLimitConfig{PerSource: 2}})
+		router := New(new(GiteaHandlerMock), new(SonarQubeHandlerMock))
+		before := rejectedWebhooks.Value("/hooks/gitea", rejectedRateLimitSource)
+
+		assert.Equal(t, http.StatusOK, send(router, "192.0.2.10:4711", nil).Code)
+		assert.Equal(t, http.StatusOK, send(router, "192.0.2.10:4711", nil).Code)
+		assert.Equal(t, http.StatusTooManyRequests, send(router, "192.0.2.10:4711", nil).Code)
+		assert.Equal(t, http.StatusOK, send(router, "192.0.2.11:4711", nil).Code)
+		assert.Equal(t, before+1, rejectedWebhooks.Value("/hooks/gitea", rejectedRateLimitSource))
+	})
+
+	t.Run("Body size", func(t *testing.T) {
+		withWebhooksConfig(t, settings.WebhooksConfig{MaxBodySize: 16})
+		router := New(new(GiteaHandlerMock), new(SonarQubeHandlerMock))
+		before := rejectedWebhooks.Value("/hooks/gitea", rejectedBodySize)
+
+		assert.Equal(t, http.StatusOK, send(router, "192.0.2.10:4711", strings.NewReader(`{"size":"small"}`)).Code)
+		assert.Equal(t, http.StatusRequestEntityTooLarge, send(router, "192.0.2.10:4711", strings.NewReader(`{"size":"too large"}`)).Code)
+
+		// Unknown content length
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", "/hooks/gitea", io.MultiReader(strings.NewReader(`{"size":`), strings.NewReader(`"too large"}`)))
+		req.ContentLength = -1
+		req.Header.Add("X-Gitea-Event", "push")
+		router.Engine.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+
+		assert.Equal(t, before+2, rejectedWebhooks.Value("/hooks/gitea", rejectedBodySize))
+	})
+
+	t.Run("Replays skip source checks", func(t *testing.T) {
+		_, network, _ := net.ParseCIDR("198.51.100.0/24")
+		withWebhooksConfig(t, settings.WebhooksConfig{MaxBodySize: 1024, AllowedSources: []*net.IPNet{network}})
+		router := New(new(GiteaHandlerMock), new(SonarQubeHandlerMock))
+
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", "/hooks/gitea", bytes.NewBufferString(`{}`))
+		req = req.WithContext(context.WithValue(req.Context(), replayOfKey{}, "original"))
+		req.Header.Add("X-Gitea-Event", "push")
+		router.Engine.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+	})
+}
+
+func TestMetricsRoute(t *testing.T) {
+	t.Run("Enabled", func(t *testing.T) {
+		router := New(new(GiteaHandlerMock), new(SonarQubeHandlerMock))
+		router.EnableMetrics()
+		rejectedWebhooks.Inc("/hooks/sonarqube", rejectedBodySize)
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/metrics", nil)
+		router.Engine.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), "# TYPE gitea_sonarqube_bot_webhooks_rejected_total counter\n")
+		assert.Contains(t, w.Body.String(), `gitea_sonarqube_bot_webhooks_rejected_total{endpoint="/hooks/sonarqube",reason="body_too_large"}`)
+	})
+
+	t.Run("Disabled", func(t *testing.T) {
+		router := New(new(GiteaHandlerMock), new(SonarQubeHandlerMock))
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/metrics", nil)
+		router.Engine.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+}
@@ -5,34 +5,56 @@ import (
 	"crypto/sha256"
 	"encoding/hex"
 	"fmt"
+	"time"
+
+	"codeberg.org/justusbunsi/gitea-sonarqube-bot/internal/metrics"
+	"codeberg.org/justusbunsi/gitea-sonarqube-bot/internal/settings"
+)
+
+var validatedSignatures = metrics.NewCounter(
+	"gitea_sonarqube_bot_webhook_signatures_total",
+	"Webhook signatures validated per configured secret. Shows whether an old secret is still in use during rotation.",
+	"platform", "secret",
 )
 
-func isValidWebhook(message []byte, key string, signature string, component string) (bool, error) {
-	if key == "" && signature == "" {
+// isValidWebhook validates the signature against all secrets that are not expired and returns the name of the
+// matching one. Unsigned webhooks are accepted if no secret is configured at all.
+func isValidWebhook(message []byte, secrets []settings.WebhookSecret, signature string, component string) (bool, string, error) {
+	if len(secrets) == 0 && signature == "" {
 		// No webhook token configured and no signature header received. Skipping request validation.
-		return true, nil
+		return true, "", nil
 	}
 
-	if key == "" && signature != "" {
-		return false, fmt.Errorf("Signature header received but no %s webhook secret configured. Request rejected due to possible configuration mismatch.", component)
+	if len(secrets) == 0 && signature != "" {
+		return false, "", fmt.Errorf("Signature header received but no %s webhook secret configured. Request rejected due to possible configuration mismatch.", component)
 	}
 
-	if key != "" && signature == "" {
-		return false, fmt.Errorf("%s webhook secret configured but no signature header received. Request rejected due to possible configuration mismatch.", component)
+	if len(secrets) != 0 && signature == "" {
+		return false, "", fmt.Errorf("%s webhook secret configured but no signature header received. Request rejected due to possible configuration mismatch.", component)
 	}
 
 	decodedSignature, err := hex.DecodeString(signature)
 	if err != nil {
-		return false, fmt.Errorf("Error decoding signature for %s webhook.", component)
+		return false, "", fmt.Errorf("Error decoding signature for %s webhook.", component)
 	}
 
-	mac := hmac.New(sha256.New, []byte(key))
-	mac.Write(message)
-	sum := mac.Sum(nil)
+	now := time.Now()
+	for _, secret := range secrets {
+		mac := hmac.New(sha256.New, []byte(secret.Value))
+		mac.Write(message)
+
+		if !hmac.Equal(decodedSignature, mac.Sum(nil)) {
+			continue
+		}
+
+		if secret.IsExpired(now) {
+			return false, secret.Name, fmt.Errorf("Signature of %s webhook matches expired secret '%s'. Request rejected.", component, secret.Name)
+		}
+
+		validatedSignatures.Inc(component, secret.Name)
 
-	if !hmac.Equal(decodedSignature, sum) {
-		return false, fmt.Errorf("Signature header does not match the received %s webhook content. Request rejected.", component)
+		return true, secret.Name, nil
 	}
 
-	return true, nil
+	return false, "", fmt.Errorf("Signature header does not match the received %s webhook content. Request rejected.", component)
 }
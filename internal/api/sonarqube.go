@@ -1,16 +1,23 @@
 package api
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"io/ioutil"
-	"log"
+	"log/slog"
 	"net/http"
 	"strings"
 
 	giteaSdk "codeberg.org/justusbunsi/gitea-sonarqube-bot/internal/clients/gitea"
 	sqSdk "codeberg.org/justusbunsi/gitea-sonarqube-bot/internal/clients/sonarqube"
+	"codeberg.org/justusbunsi/gitea-sonarqube-bot/internal/dedup"
+	"codeberg.org/justusbunsi/gitea-sonarqube-bot/internal/ratelimit"
 	"codeberg.org/justusbunsi/gitea-sonarqube-bot/internal/settings"
+	"codeberg.org/justusbunsi/gitea-sonarqube-bot/internal/tracing"
 	webhook "codeberg.org/justusbunsi/gitea-sonarqube-bot/internal/webhooks/sonarqube"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type SonarQubeWebhookHandlerInferface interface {
@@ -20,6 +27,10 @@ type SonarQubeWebhookHandlerInferface interface {
 type SonarQubeWebhookHandler struct {
 	giteaSdk giteaSdk.GiteaSdkInterface
 	sqSdk    sqSdk.SonarQubeSdkInterface
+	queue    JobQueueInferface
+	analyses *dedup.Cache
+	// Limits validated webhooks per repository
+	repositories *ratelimit.Limiter
 }
 
 func (*SonarQubeWebhookHandler) inProjectsMapping(p []settings.Project, n string) (bool, int) {
@@ -32,38 +43,65 @@ func (*SonarQubeWebhookHandler) inProjectsMapping(p []settings.Project, n string
 	return false, 0
 }
 
-func (h *SonarQubeWebhookHandler) processData(w *webhook.Webhook, repo settings.GiteaRepository) {
+func (h *SonarQubeWebhookHandler) processData(ctx context.Context, w *webhook.Webhook, project settings.Project) error {
+	ctx, span := tracing.Start(ctx, "sonarqube.ProcessWebhook", trace.WithAttributes(
+		attribute.String("sonarqube.project", w.Project.Key),
+		attribute.String("sonarqube.pull_request", w.Branch.Name),
+		attribute.String("gitea.revision", w.GetRevision()),
+	))
+	defer span.End()
+
+	repo := project.Gitea
 	status := giteaSdk.StatusOK
 	if w.QualityGate.Status != "OK" {
 		status = giteaSdk.StatusFailure
 	}
-	_ = h.giteaSdk.UpdateStatus(repo, w.GetRevision(), giteaSdk.StatusDetails{
+	statusErr := h.giteaSdk.UpdateStatus(ctx, repo, w.GetRevision(), giteaSdk.StatusDetails{
 		Url:     w.Branch.Url,
 		Message: w.QualityGate.Status,
 		State:   status,
 	})
 
-	comment, err := h.sqSdk.ComposeGiteaComment(&sqSdk.CommentComposeData{
-		Key:         w.Project.Key,
-		PRName:      w.Branch.Name,
-		Url:         w.Branch.Url,
-		QualityGate: w.QualityGate.Status,
+	// A newer commit may have been pushed while the analysis ran. Its status stays valid for the analyzed commit, but
+	// the comment must not present it as the current state of the pull request.
+	head, err := h.giteaSdk.DetermineHEAD(ctx, repo, int64(w.PRIndex))
+	if err != nil {
+		slog.WarnContext(ctx, "Error retrieving HEAD ref. Assuming analysis is current.", "error", err)
+	} else if head != w.GetRevision() {
+		slog.InfoContext(ctx, "Analysis is outdated. Skip commenting.", "revision", w.GetRevision(), "head", head)
+		return statusErr
+	}
+
+	config := settings.Current()
+	comment, err := h.sqSdk.ComposeGiteaComment(ctx, &sqSdk.CommentComposeData{
+		Key:            w.Project.Key,
+		PRName:         w.Branch.Name,
+		Url:            w.Branch.Url,
+		QualityGate:    w.QualityGate.Status,
+		Metrics:        config.SonarQube.GetMetricGroups(&project),
+		Hotspots:       project.Hotspots,
+		Coverage:       project.Coverage,
+		Duplications:   project.Duplications,
+		PullRequestUrl: config.Gitea.GetPullRequestUrl(repo, int64(w.PRIndex)),
+		SourceUrl:      config.Gitea.GetSourceUrl(repo, w.GetRevision()),
 	})
 	if err != nil {
-		return
+		return errors.Join(statusErr, err)
 	}
-	h.giteaSdk.PostComment(repo, w.PRIndex, comment)
+
+	return errors.Join(statusErr, h.giteaSdk.PostComment(ctx, repo, w.PRIndex, comment))
 }
 
 func (h *SonarQubeWebhookHandler) Handle(r *http.Request) (int, string) {
+	config := settings.Current()
 	projectName := r.Header.Get("X-SonarQube-Project")
-	found, pIdx := h.inProjectsMapping(settings.Projects, projectName)
+	found, pIdx := h.inProjectsMapping(config.Projects, projectName)
 	if !found {
-		log.Printf("Received hook for project '%s' which is not configured. Request ignored.", projectName)
+		slog.InfoContext(r.Context(), "Received hook for project which is not configured. Request ignored.", "project", projectName)
 		return http.StatusOK, fmt.Sprintf("Project '%s' not in configured list. Request ignored.", projectName)
 	}
 
-	log.Printf("Received hook for project '%s'. Processing data.", projectName)
+	slog.InfoContext(r.Context(), "Received hook. Processing data.", "project", projectName)
 
 	if r.Body != nil {
 		defer r.Body.Close()
@@ -71,34 +109,62 @@ func (h *SonarQubeWebhookHandler) Handle(r *http.Request) (int, string) {
 
 	raw, err := ioutil.ReadAll(r.Body)
 	if err != nil {
-		log.Printf("Error reading request body %s", err.Error())
+		slog.ErrorContext(r.Context(), "Error reading request body", "error", err)
 		return http.StatusInternalServerError, err.Error()
 	}
 
-	ok, err := isValidWebhook(raw, settings.SonarQube.Webhook.Secret, r.Header.Get("X-Sonar-Webhook-HMAC-SHA256"), "SonarQube")
+	ok, _, err := isValidWebhook(raw, config.SonarQube.Webhook.Secrets(), r.Header.Get("X-Sonar-Webhook-HMAC-SHA256"), "SonarQube")
 	if !ok {
-		log.Print(err.Error())
+		slog.WarnContext(r.Context(), "Webhook validation failed", "error", err)
 		return http.StatusPreconditionFailed, "Webhook validation failed. Request rejected."
 	}
 
-	w, ok := webhook.New(raw)
+	w, ok := webhook.New(r.Context(), raw)
 	if !ok {
 		return http.StatusUnprocessableEntity, "Error parsing POST body."
 	}
 
 	if strings.ToLower(w.Branch.Type) != "pull_request" {
-		log.Println("Ignore Hook for non-PR analysis")
+		slog.InfoContext(r.Context(), "Ignore hook for non-PR analysis")
 		return http.StatusOK, "Ignore Hook for non-PR analysis."
 	}
 
-	h.processData(w, settings.Projects[pIdx].Gitea)
+	project := config.Projects[pIdx]
+	if !allowRepository(r, h.repositories, project.Gitea) {
+		return http.StatusTooManyRequests, "Rate limit for repository exceeded. Request rejected."
+	}
+
+	key := w.AnalysisKey()
+	if !isReplay(r.Context()) && !h.analyses.Claim(key) {
+		slog.InfoContext(r.Context(), "Received hook for already processed analysis. Request ignored.", "analysis", key)
+		markDuplicate(r.Context())
+		return http.StatusOK, "Analysis already processed. Request ignored."
+	}
+
+	job, err := h.queue.Enqueue(r.Context(), pullRequestKey(project.Gitea, int64(w.PRIndex)), fmt.Sprintf("analysis %s %s", w.Project.Key, w.Branch.Name), func(ctx context.Context) error {
+		err := h.processData(ctx, w, project)
+		if err != nil {
+			// Allow SonarQube or a replay to deliver the failed analysis again
+			h.analyses.Release(key)
+		}
+		return err
+	})
+	if err != nil {
+		h.analyses.Release(key)
+		slog.ErrorContext(r.Context(), "Error scheduling webhook processing", "error", err)
+		return http.StatusServiceUnavailable, "Processing queue is full. Request rejected."
+	}
+	markScheduled(r.Context(), job)
 
 	return http.StatusOK, "Processing data. See bot logs for details."
 }
 
-func NewSonarQubeWebhookHandler(g giteaSdk.GiteaSdkInterface, sq sqSdk.SonarQubeSdkInterface) SonarQubeWebhookHandlerInferface {
+func NewSonarQubeWebhookHandler(g giteaSdk.GiteaSdkInterface, sq sqSdk.SonarQubeSdkInterface, q JobQueueInferface) SonarQubeWebhookHandlerInferface {
 	return &SonarQubeWebhookHandler{
-		giteaSdk: g,
-		sqSdk:    sq,
+		giteaSdk:     g,
+		sqSdk:        sq,
+		queue:        q,
+		analyses:     dedup.New(DeduplicationTTL),
+		repositories: ratelimit.New(rateLimitWindow),
 	}
 }
@@ -2,6 +2,7 @@ package api
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"io"
 	"net/http"
@@ -10,11 +11,12 @@ import (
 	"testing"
 
 	"codeberg.org/justusbunsi/gitea-sonarqube-bot/internal/settings"
+	webhook "codeberg.org/justusbunsi/gitea-sonarqube-bot/internal/webhooks/sonarqube"
 	"github.com/stretchr/testify/assert"
 )
 
 func withValidSonarQubeRequestData(t *testing.T, jsonBody []byte) (*http.Request, *httptest.ResponseRecorder, http.HandlerFunc) {
-	webhookHandler := NewSonarQubeWebhookHandler(new(GiteaSdkMock), new(SQSdkMock))
+	webhookHandler := NewSonarQubeWebhookHandler(new(GiteaSdkMock), new(SQSdkMock), new(JobQueueMock))
 
 	req, err := http.NewRequest("POST", "/hooks/sonarqube", bytes.NewBuffer(jsonBody))
 	if err != nil {
@@ -35,15 +37,15 @@ func withValidSonarQubeRequestData(t *testing.T, jsonBody []byte) (*http.Request
 
 func TestHandleSonarQubeWebhook(t *testing.T) {
 	t.Run("With mapped Project", func(t *testing.T) {
-		settings.Pattern = &settings.PatternConfig{
+		settings.Current().Pattern = &settings.PatternConfig{
 			RegExp: regexp.MustCompile(`^PR-(\d+)$`),
 		}
-		settings.SonarQube = settings.SonarQubeConfig{
+		settings.Current().SonarQube = settings.SonarQubeConfig{
 			Webhook: &settings.Webhook{
 				Secret: "",
 			},
 		}
-		settings.Projects = []settings.Project{
+		settings.Current().Projects = []settings.Project{
 			{
 				SonarQube: struct{ Key string }{
 					Key: "pr-bot",
@@ -57,12 +59,12 @@ func TestHandleSonarQubeWebhook(t *testing.T) {
 		assert.Equal(t, `{"message": "Processing data. See bot logs for details."}`, rr.Body.String())
 
 		t.Cleanup(func() {
-			settings.Pattern = nil
+			settings.Current().Pattern = nil
 		})
 	})
 
 	t.Run("Without mapped project", func(t *testing.T) {
-		settings.Projects = []settings.Project{
+		settings.Current().Projects = []settings.Project{
 			{
 				SonarQube: struct{ Key string }{
 					Key: "another-project",
@@ -77,7 +79,7 @@ func TestHandleSonarQubeWebhook(t *testing.T) {
 	})
 
 	t.Run("With invalid JSON body", func(t *testing.T) {
-		settings.Projects = []settings.Project{
+		settings.Current().Projects = []settings.Project{
 			{
 				SonarQube: struct{ Key string }{
 					Key: "pr-bot",
@@ -93,12 +95,12 @@ func TestHandleSonarQubeWebhook(t *testing.T) {
 	})
 
 	t.Run("With invalid webhook signature", func(t *testing.T) {
-		settings.SonarQube = settings.SonarQubeConfig{
+		settings.Current().SonarQube = settings.SonarQubeConfig{
 			Webhook: &settings.Webhook{
 				Secret: "sonarqube-test-webhook-secret",
 			},
 		}
-		settings.Projects = []settings.Project{
+		settings.Current().Projects = []settings.Project{
 			{
 				SonarQube: struct{ Key string }{
 					Key: "pr-bot",
@@ -114,15 +116,15 @@ func TestHandleSonarQubeWebhook(t *testing.T) {
 	})
 
 	t.Run("Running for Pull Request", func(t *testing.T) {
-		settings.Pattern = &settings.PatternConfig{
+		settings.Current().Pattern = &settings.PatternConfig{
 			RegExp: regexp.MustCompile(`^PR-(\d+)$`),
 		}
-		settings.SonarQube = settings.SonarQubeConfig{
+		settings.Current().SonarQube = settings.SonarQubeConfig{
 			Webhook: &settings.Webhook{
 				Secret: "",
 			},
 		}
-		settings.Projects = []settings.Project{
+		settings.Current().Projects = []settings.Project{
 			{
 				SonarQube: struct{ Key string }{
 					Key: "pr-bot",
@@ -137,20 +139,165 @@ func TestHandleSonarQubeWebhook(t *testing.T) {
 		assert.Equal(t, `{"message": "Processing data. See bot logs for details."}`, rr.Body.String())
 
 		t.Cleanup(func() {
-			settings.Pattern = nil
+			settings.Current().Pattern = nil
+		})
+	})
+
+	t.Run("Queue full", func(t *testing.T) {
+		settings.Current().Pattern = &settings.PatternConfig{
+			RegExp: regexp.MustCompile(`^PR-(\d+)$`),
+		}
+		settings.Current().SonarQube = settings.SonarQubeConfig{
+			Webhook: &settings.Webhook{
+				Secret: "",
+			},
+		}
+		settings.Current().Projects = []settings.Project{
+			{
+				SonarQube: struct{ Key string }{
+					Key: "pr-bot",
+				},
+			},
+		}
+
+		webhookHandler := NewSonarQubeWebhookHandler(new(GiteaSdkMock), new(SQSdkMock), &JobQueueMock{full: true})
+		req := httptest.NewRequest("POST", "/hooks/sonarqube", bytes.NewBufferString(`{"project":{"key":"pr-bot"},"branch":{"name":"PR-1337","type":"PULL_REQUEST"},"qualityGate":{"status":"OK"}}`))
+		req.Header.Set("X-SonarQube-Project", "pr-bot")
+		status, response := webhookHandler.Handle(req)
+
+		assert.Equal(t, http.StatusServiceUnavailable, status)
+		assert.Equal(t, "Processing queue is full. Request rejected.", response)
+
+		t.Cleanup(func() {
+			settings.Current().Pattern = nil
+		})
+	})
+
+	t.Run("Duplicate analysis", func(t *testing.T) {
+		settings.Current().Pattern = &settings.PatternConfig{
+			RegExp: regexp.MustCompile(`^PR-(\d+)$`),
+		}
+		settings.Current().SonarQube = settings.SonarQubeConfig{
+			Webhook: &settings.Webhook{
+				Secret: "",
+			},
+		}
+		settings.Current().Projects = []settings.Project{
+			{
+				SonarQube: struct{ Key string }{
+					Key: "pr-bot",
+				},
+			},
+		}
+
+		webhookHandler := NewSonarQubeWebhookHandler(new(GiteaSdkMock), new(SQSdkMock), new(JobQueueMock))
+		handle := func(body string) (int, string) {
+			req := httptest.NewRequest("POST", "/hooks/sonarqube", bytes.NewBufferString(body))
+			req.Header.Set("X-SonarQube-Project", "pr-bot")
+			return webhookHandler.Handle(req)
+		}
+
+		_, response := handle(`{"taskId":"AXouyxDpizdp4B1K","revision":"f84442009c09b1adc278b6aa80a3853419f54007","project":{"key":"pr-bot"},"branch":{"name":"PR-1337","type":"PULL_REQUEST"},"qualityGate":{"status":"OK"}}`)
+		assert.Equal(t, "Processing data. See bot logs for details.", response)
+
+		status, response := handle(`{"taskId":"AXouyxDpizdp4B1K","revision":"f84442009c09b1adc278b6aa80a3853419f54007","project":{"key":"pr-bot"},"branch":{"name":"PR-1337","type":"PULL_REQUEST"},"qualityGate":{"status":"OK"}}`)
+		assert.Equal(t, http.StatusOK, status)
+		assert.Equal(t, "Analysis already processed. Request ignored.", response)
+
+		_, response = handle(`{"taskId":"AXouyxDpizdp4B1L","revision":"f84442009c09b1adc278b6aa80a3853419f54007","project":{"key":"pr-bot"},"branch":{"name":"PR-1337","type":"PULL_REQUEST"},"qualityGate":{"status":"OK"}}`)
+		assert.Equal(t, "Processing data. See bot logs for details.", response)
+
+		t.Cleanup(func() {
+			settings.Current().Pattern = nil
+		})
+	})
+
+	t.Run("Failed analysis", func(t *testing.T) {
+		settings.Current().Pattern = &settings.PatternConfig{
+			RegExp: regexp.MustCompile(`^PR-(\d+)$`),
+		}
+		settings.Current().SonarQube = settings.SonarQubeConfig{
+			Webhook: &settings.Webhook{
+				Secret: "",
+			},
+		}
+		settings.Current().Projects = []settings.Project{
+			{
+				SonarQube: struct{ Key string }{
+					Key: "pr-bot",
+				},
+			},
+		}
+
+		webhookHandler := NewSonarQubeWebhookHandler(&GiteaSdkMock{statusErr: fmt.Errorf("Gitea unreachable")}, new(SQSdkMock), new(JobQueueMock))
+		handle := func(body string) (int, string) {
+			req := httptest.NewRequest("POST", "/hooks/sonarqube", bytes.NewBufferString(body))
+			req.Header.Set("X-SonarQube-Project", "pr-bot")
+			return webhookHandler.Handle(req)
+		}
+
+		_, response := handle(`{"taskId":"AXouyxDpizdp4B1K","revision":"f84442009c09b1adc278b6aa80a3853419f54007","project":{"key":"pr-bot"},"branch":{"name":"PR-1337","type":"PULL_REQUEST"},"qualityGate":{"status":"OK"}}`)
+		assert.Equal(t, "Processing data. See bot logs for details.", response)
+
+		_, response = handle(`{"taskId":"AXouyxDpizdp4B1K","revision":"f84442009c09b1adc278b6aa80a3853419f54007","project":{"key":"pr-bot"},"branch":{"name":"PR-1337","type":"PULL_REQUEST"},"qualityGate":{"status":"OK"}}`)
+		assert.Equal(t, "Processing data. See bot logs for details.", response, "Failed analysis rejected as duplicate")
+
+		t.Cleanup(func() {
+			settings.Current().Pattern = nil
+		})
+	})
+
+	t.Run("Repository rate limit", func(t *testing.T) {
+		settings.Current().Pattern = &settings.PatternConfig{
+			RegExp: regexp.MustCompile(`^PR-(\d+)$`),
+		}
+		settings.Current().SonarQube = settings.SonarQubeConfig{
+			Webhook: &settings.Webhook{
+				Secret: "",
+			},
+		}
+		settings.Current().Projects = []settings.Project{
+			{
+				SonarQube: struct{ Key string }{
+					Key: "pr-bot",
+				},
+				Gitea: settings.GiteaRepository{Owner: "test-owner", Name: "rate-limited"},
+			},
+		}
+		settings.Current().Webhooks.RateLimit.PerRepository = 1
+		before := rejectedWebhooks.Value("/hooks/sonarqube", rejectedRateLimitRepository)
+
+		webhookHandler := NewSonarQubeWebhookHandler(new(GiteaSdkMock), new(SQSdkMock), new(JobQueueMock))
+		handle := func(body string) (int, string) {
+			req := httptest.NewRequest("POST", "/hooks/sonarqube", bytes.NewBufferString(body))
+			req.Header.Set("X-SonarQube-Project", "pr-bot")
+			return webhookHandler.Handle(req)
+		}
+
+		status, _ := handle(`{"taskId":"AXouyxDpizdp4B1K","project":{"key":"pr-bot"},"branch":{"name":"PR-1337","type":"PULL_REQUEST"},"qualityGate":{"status":"OK"}}`)
+		assert.Equal(t, http.StatusOK, status)
+
+		status, response := handle(`{"taskId":"AXouyxDpizdp4B1L","project":{"key":"pr-bot"},"branch":{"name":"PR-1337","type":"PULL_REQUEST"},"qualityGate":{"status":"OK"}}`)
+		assert.Equal(t, http.StatusTooManyRequests, status)
+		assert.Equal(t, "Rate limit for repository exceeded. Request rejected.", response)
+		assert.Equal(t, before+1, rejectedWebhooks.Value("/hooks/sonarqube", rejectedRateLimitRepository))
+
+		t.Cleanup(func() {
+			settings.Current().Pattern = nil
+			settings.Current().Webhooks.RateLimit.PerRepository = 0
 		})
 	})
 
 	t.Run("Running for branch", func(t *testing.T) {
-		settings.Pattern = &settings.PatternConfig{
+		settings.Current().Pattern = &settings.PatternConfig{
 			RegExp: regexp.MustCompile(`^PR-(\d+)$`),
 		}
-		settings.SonarQube = settings.SonarQubeConfig{
+		settings.Current().SonarQube = settings.SonarQubeConfig{
 			Webhook: &settings.Webhook{
 				Secret: "",
 			},
 		}
-		settings.Projects = []settings.Project{
+		settings.Current().Projects = []settings.Project{
 			{
 				SonarQube: struct{ Key string }{
 					Key: "pr-bot",
@@ -165,7 +312,39 @@ func TestHandleSonarQubeWebhook(t *testing.T) {
 		assert.Equal(t, `{"message": "Ignore Hook for non-PR analysis."}`, rr.Body.String())
 
 		t.Cleanup(func() {
-			settings.Pattern = nil
+			settings.Current().Pattern = nil
 		})
 	})
 }
+
+func TestProcessSonarQubeAnalysis(t *testing.T) {
+	settings.Current().Pattern = &settings.PatternConfig{
+		RegExp: regexp.MustCompile(`^PR-(\d+)$`),
+	}
+	t.Cleanup(func() {
+		settings.Current().Pattern = nil
+	})
+
+	w := &webhook.Webhook{
+		Revision: "f84442009c09b1adc278b6aa80a3853419f54007",
+		PRIndex:  1337,
+	}
+	w.Branch.Name = "PR-1337"
+	w.QualityGate.Status = "OK"
+
+	t.Run("Current analysis", func(t *testing.T) {
+		g := &GiteaSdkMock{head: "f84442009c09b1adc278b6aa80a3853419f54007"}
+		h := &SonarQubeWebhookHandler{giteaSdk: g, sqSdk: new(SQSdkMock)}
+
+		assert.Nil(t, h.processData(context.Background(), w, settings.Project{}))
+		assert.Equal(t, 1, g.comments)
+	})
+
+	t.Run("Outdated analysis", func(t *testing.T) {
+		g := &GiteaSdkMock{head: "a84442009c09b1adc278b6bb80a3853419f54007"}
+		h := &SonarQubeWebhookHandler{giteaSdk: g, sqSdk: new(SQSdkMock)}
+
+		assert.Nil(t, h.processData(context.Background(), w, settings.Project{}))
+		assert.Equal(t, 0, g.comments)
+	})
+}
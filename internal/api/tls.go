@@ -0,0 +1,161 @@
+package api
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CertificateCheckInterval defines how often the certificate files are checked for changes.
+var CertificateCheckInterval = 10 * time.Second
+
+// CertificateReloader serves the TLS certificate of the bot and reloads it as soon as the certificate or key file
+// changes. This allows rotating certificates without restarting the bot.
+type CertificateReloader struct {
+	certFile    string
+	keyFile     string
+	mutex       sync.RWMutex
+	certificate *tls.Certificate
+	modTime     time.Time
+	lastCheck   time.Time
+}
+
+func latestModTime(files ...string) (time.Time, error) {
+	var latest time.Time
+	for _, f := range files {
+		info, err := os.Stat(f)
+		if err != nil {
+			return latest, err
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest, nil
+}
+
+func (r *CertificateReloader) load() error {
+	modTime, err := latestModTime(r.certFile, r.keyFile)
+	if err != nil {
+		return err
+	}
+
+	certificate, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return err
+	}
+
+	r.certificate = &certificate
+	r.modTime = modTime
+
+	return nil
+}
+
+func (r *CertificateReloader) reloadIfChanged() {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if time.Since(r.lastCheck) < CertificateCheckInterval {
+		return
+	}
+	r.lastCheck = time.Now()
+
+	modTime, err := latestModTime(r.certFile, r.keyFile)
+	if err != nil || modTime.Equal(r.modTime) {
+		return
+	}
+
+	if err := r.load(); err != nil {
+		slog.Error("Error reloading TLS certificate, keep using the previous one", "error", err)
+		return
+	}
+
+	slog.Info("Reloaded TLS certificate")
+}
+
+func (r *CertificateReloader) GetCertificate(_ *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.reloadIfChanged()
+
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	return r.certificate, nil
+}
+
+func NewCertificateReloader(certFile string, keyFile string) (*CertificateReloader, error) {
+	r := &CertificateReloader{
+		certFile:  certFile,
+		keyFile:   keyFile,
+		lastCheck: time.Now(),
+	}
+
+	if err := r.load(); err != nil {
+		return nil, fmt.Errorf("cannot load TLS certificate: %w", err)
+	}
+
+	return r, nil
+}
+
+// NewTLSConfig builds the TLS configuration of the bot server. If clientCAFile is set, client certificates are verified
+// against the contained CAs. They are only requested, so probes and other endpoints work without certificate. Use
+// ApiServer.RequireClientCertificates to enforce them for webhooks.
+func NewTLSConfig(certFile string, keyFile string, clientCAFile string) (*tls.Config, error) {
+	reloader, err := NewCertificateReloader(certFile, keyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	config := &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: reloader.GetCertificate,
+	}
+
+	if clientCAFile != "" {
+		content, err := os.ReadFile(clientCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read client CA file: %w", err)
+		}
+
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(content) {
+			return nil, fmt.Errorf("no certificates found in client CA file '%s'", clientCAFile)
+		}
+
+		config.ClientCAs = pool
+		config.ClientAuth = tls.VerifyClientCertIfGiven
+	}
+
+	return config, nil
+}
+
+// RequireClientCertificates rejects webhooks without a client certificate verified by the TLS configuration. Other
+// endpoints like probes, metrics and the admin API do not require a certificate.
+func (s *ApiServer) RequireClientCertificates() {
+	s.clientCertificates = true
+}
+
+// verifyClientCertificates rejects webhooks without verified client certificate if required. Replays were already
+// checked when received.
+func (s *ApiServer) verifyClientCertificates() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx := c.Request.Context()
+		if !s.clientCertificates || isReplay(ctx) {
+			return
+		}
+
+		if c.Request.TLS == nil || len(c.Request.TLS.VerifiedChains) == 0 {
+			slog.WarnContext(ctx, "Webhook rejected", "reason", rejectedClientCertificate, "client", c.ClientIP())
+			rejectedWebhooks.Inc(c.Request.URL.Path, rejectedClientCertificate)
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+				"message": "Client certificate required. Request rejected.",
+			})
+		}
+	}
+}
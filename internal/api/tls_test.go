@@ -0,0 +1,207 @@
+package api
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func writeCertificate(t *testing.T, dir string, commonName string) (string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IsCA:         true,
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rawKey, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certFile := path.Join(dir, "tls.crt")
+	keyFile := path.Join(dir, "tls.key")
+	_ = ioutil.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600)
+	_ = ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: rawKey}), 0600)
+
+	return certFile, keyFile
+}
+
+func commonName(t *testing.T, c *tls.Certificate) string {
+	parsed, err := x509.ParseCertificate(c.Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return parsed.Subject.CommonName
+}
+
+func TestCertificateReloader(t *testing.T) {
+	t.Run("Initial load", func(t *testing.T) {
+		certFile, keyFile := writeCertificate(t, t.TempDir(), "initial")
+
+		r, err := NewCertificateReloader(certFile, keyFile)
+		assert.Nil(t, err)
+
+		c, err := r.GetCertificate(nil)
+		assert.Nil(t, err)
+		assert.Equal(t, "initial", commonName(t, c))
+	})
+
+	t.Run("Missing files", func(t *testing.T) {
+		dir := t.TempDir()
+		_, err := NewCertificateReloader(path.Join(dir, "tls.crt"), path.Join(dir, "tls.key"))
+
+		assert.ErrorContains(t, err, "cannot load TLS certificate")
+	})
+
+	t.Run("Reload on change", func(t *testing.T) {
+		CertificateCheckInterval = 0
+		dir := t.TempDir()
+		certFile, keyFile := writeCertificate(t, dir, "initial")
+
+		r, _ := NewCertificateReloader(certFile, keyFile)
+
+		writeCertificate(t, dir, "rotated")
+		future := time.Now().Add(time.Minute)
+		_ = os.Chtimes(certFile, future, future)
+
+		c, _ := r.GetCertificate(nil)
+		assert.Equal(t, "rotated", commonName(t, c), "Changed certificate not reloaded")
+
+		t.Cleanup(func() {
+			CertificateCheckInterval = 10 * time.Second
+		})
+	})
+
+	t.Run("Keep certificate on broken change", func(t *testing.T) {
+		CertificateCheckInterval = 0
+		dir := t.TempDir()
+		certFile, keyFile := writeCertificate(t, dir, "initial")
+
+		r, _ := NewCertificateReloader(certFile, keyFile)
+
+		_ = ioutil.WriteFile(certFile, []byte("broken"), 0600)
+		future := time.Now().Add(time.Minute)
+		_ = os.Chtimes(certFile, future, future)
+
+		c, _ := r.GetCertificate(nil)
+		assert.Equal(t, "initial", commonName(t, c), "Broken certificate replaced working one")
+
+		t.Cleanup(func() {
+			CertificateCheckInterval = 10 * time.Second
+		})
+	})
+}
+
+func TestNewTLSConfig(t *testing.T) {
+	t.Run("Server certificate only", func(t *testing.T) {
+		certFile, keyFile := writeCertificate(t, t.TempDir(), "bot")
+
+		actual, err := NewTLSConfig(certFile, keyFile, "")
+
+		assert.Nil(t, err)
+		assert.Equal(t, tls.NoClientCert, actual.ClientAuth)
+		assert.NotNil(t, actual.GetCertificate)
+	})
+
+	t.Run("Client certificate verification", func(t *testing.T) {
+		certFile, keyFile := writeCertificate(t, t.TempDir(), "bot")
+		caFile, _ := writeCertificate(t, t.TempDir(), "webhook-ca")
+
+		actual, err := NewTLSConfig(certFile, keyFile, caFile)
+
+		assert.Nil(t, err)
+		assert.Equal(t, tls.VerifyClientCertIfGiven, actual.ClientAuth)
+		assert.NotNil(t, actual.ClientCAs)
+	})
+
+	t.Run("Invalid client CA", func(t *testing.T) {
+		dir := t.TempDir()
+		certFile, keyFile := writeCertificate(t, dir, "bot")
+		caFile := path.Join(dir, "ca.pem")
+		_ = ioutil.WriteFile(caFile, []byte("no certificate"), 0600)
+
+		_, err := NewTLSConfig(certFile, keyFile, caFile)
+
+		assert.ErrorContains(t, err, "no certificates found in client CA file")
+	})
+}
+
+func TestRequireClientCertificates(t *testing.T) {
+	send := func(router *ApiServer, path string, state *tls.ConnectionState) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", path, nil)
+		req.Header.Add("X-Gitea-Event", "push")
+		req.TLS = state
+		router.Engine.ServeHTTP(w, req)
+
+		return w
+	}
+
+	t.Run("Not required", func(t *testing.T) {
+		router := New(new(GiteaHandlerMock), new(SonarQubeHandlerMock))
+
+		assert.Equal(t, http.StatusOK, send(router, "/hooks/gitea", &tls.ConnectionState{}).Code)
+	})
+
+	t.Run("Webhooks without certificate", func(t *testing.T) {
+		router := New(new(GiteaHandlerMock), new(SonarQubeHandlerMock))
+		router.RequireClientCertificates()
+		before := rejectedWebhooks.Value("/hooks/gitea", rejectedClientCertificate)
+
+		w := send(router, "/hooks/gitea", &tls.ConnectionState{})
+
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+		assert.JSONEq(t, `{"message":"Client certificate required. Request rejected."}`, w.Body.String())
+		assert.Equal(t, before+1, rejectedWebhooks.Value("/hooks/gitea", rejectedClientCertificate))
+		assert.Empty(t, router.deliveries.List(), "Rejected requests are not recorded as deliveries")
+	})
+
+	t.Run("Webhooks with verified certificate", func(t *testing.T) {
+		router := New(new(GiteaHandlerMock), new(SonarQubeHandlerMock))
+		router.RequireClientCertificates()
+
+		w := send(router, "/hooks/gitea", &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{{}}}})
+
+		assert.Equal(t, http.StatusOK, w.Code)
+	})
+
+	t.Run("Other endpoints without certificate", func(t *testing.T) {
+		router := New(new(GiteaHandlerMock), new(SonarQubeHandlerMock))
+		router.RequireClientCertificates()
+
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "/healthz", nil)
+		req.TLS = &tls.ConnectionState{}
+		router.Engine.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+	})
+}
@@ -0,0 +1,57 @@
+package api
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"codeberg.org/justusbunsi/gitea-sonarqube-bot/internal/tracing"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+func TestTracing(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	tracing.Register(sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter)))
+
+	t.Cleanup(func() {
+		tracing.Register(noop.NewTracerProvider())
+	})
+
+	t.Run("Server span", func(t *testing.T) {
+		exporter.Reset()
+		sonarQubeHandlerMock := new(SonarQubeHandlerMock)
+		sonarQubeHandlerMock.On("Handle", mock.IsType(&http.Request{}))
+		router := New(new(GiteaHandlerMock), sonarQubeHandlerMock)
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/hooks/sonarqube", bytes.NewBuffer([]byte(`{}`)))
+		req.Header.Add("X-SonarQube-Project", "gitea-sonarqube-bot")
+		req.Header.Add("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+		router.Engine.ServeHTTP(w, req)
+
+		spans := exporter.GetSpans()
+		assert.Len(t, spans, 1)
+		assert.Equal(t, "POST /hooks/sonarqube", spans[0].Name)
+		assert.Equal(t, trace.SpanKindServer, spans[0].SpanKind)
+		assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", spans[0].SpanContext.TraceID().String(), "Incoming trace context ignored")
+		assert.Contains(t, spans[0].Attributes, attribute.Int("http.response.status_code", http.StatusOK))
+	})
+
+	t.Run("Skipped paths", func(t *testing.T) {
+		exporter.Reset()
+		router := New(new(GiteaHandlerMock), new(SonarQubeHandlerMock))
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/ping", nil)
+		router.Engine.ServeHTTP(w, req)
+
+		assert.Empty(t, exporter.GetSpans())
+	})
+}
@@ -1,57 +1,136 @@
 package gitea
 
 import (
+	"context"
 	"fmt"
-	"log"
+	"log/slog"
+	"net/http"
+	"sync"
 
 	"code.gitea.io/sdk/gitea"
+	"codeberg.org/justusbunsi/gitea-sonarqube-bot/internal/clients/httpclient"
 	"codeberg.org/justusbunsi/gitea-sonarqube-bot/internal/settings"
 )
 
 type GiteaSdkInterface interface {
-	PostComment(settings.GiteaRepository, int, string) error
-	UpdateStatus(settings.GiteaRepository, string, StatusDetails) error
-	DetermineHEAD(settings.GiteaRepository, int64) (string, error)
+	PostComment(context.Context, settings.GiteaRepository, int, string) error
+	UpdateStatus(context.Context, settings.GiteaRepository, string, StatusDetails) error
+	DetermineHEAD(context.Context, settings.GiteaRepository, int64) (string, error)
+	GetBotUser(context.Context) (string, error)
+	CheckRepositoryAccess(context.Context, settings.GiteaRepository) error
+	ListOpenPullRequests(context.Context, settings.GiteaRepository) ([]PullRequest, error)
+	ListHooks(context.Context, settings.GiteaRepository) ([]Hook, error)
+	CreateHook(context.Context, settings.GiteaRepository, Hook, string) error
+	EditHook(context.Context, settings.GiteaRepository, Hook, string) error
 }
 
 type ClientInterface interface {
+	ServerVersion() (string, *gitea.Response, error)
 	CreateIssueComment(owner, repo string, index int64, opt gitea.CreateIssueCommentOption) (*gitea.Comment, *gitea.Response, error)
 	CreateStatus(owner, repo, sha string, opts gitea.CreateStatusOption) (*gitea.Status, *gitea.Response, error)
+	GetCombinedStatus(owner, repo, ref string) (*gitea.CombinedStatus, *gitea.Response, error)
 	GetPullRequest(owner, repo string, index int64) (*gitea.PullRequest, *gitea.Response, error)
+	GetMyUserInfo() (*gitea.User, *gitea.Response, error)
+	GetRepo(owner, reponame string) (*gitea.Repository, *gitea.Response, error)
+	ListRepoPullRequests(owner, repo string, opt gitea.ListPullRequestsOptions) ([]*gitea.PullRequest, *gitea.Response, error)
+	ListRepoHooks(user, repo string, opt gitea.ListHooksOptions) ([]*gitea.Hook, *gitea.Response, error)
+	CreateRepoHook(user, repo string, opt gitea.CreateHookOption) (*gitea.Hook, *gitea.Response, error)
+	EditRepoHook(user, repo string, id int64, opt gitea.EditHookOption) (*gitea.Response, error)
 }
 
+// Context of the commit statuses written by the bot
+const statusContext = "gitea-sonarqube-bot"
+
 type GiteaSdk struct {
-	client ClientInterface
+	// client returns a client bound to the given context. The Gitea client holds the request context as state, so
+	// every call uses its own client to not mix up or serialize concurrently processed webhooks.
+	client func(ctx context.Context) (ClientInterface, error)
 }
 
-func (sdk *GiteaSdk) PostComment(repo settings.GiteaRepository, idx int, msg string) error {
+// withContext calls fn with a client bound to the given context.
+func (sdk *GiteaSdk) withContext(ctx context.Context, fn func(client ClientInterface) error) error {
+	client, err := sdk.client(ctx)
+	if err != nil {
+		return fmt.Errorf("cannot initialize Gitea client: %w", err)
+	}
+
+	return fn(client)
+}
+
+func (sdk *GiteaSdk) PostComment(ctx context.Context, repo settings.GiteaRepository, idx int, msg string) error {
 	opt := gitea.CreateIssueCommentOption{
 		Body: msg,
 	}
 
-	_, _, err := sdk.client.CreateIssueComment(repo.Owner, repo.Name, int64(idx), opt)
+	return sdk.withContext(ctx, func(client ClientInterface) error {
+		_, _, err := client.CreateIssueComment(repo.Owner, repo.Name, int64(idx), opt)
+		return err
+	})
+}
 
-	return err
+// currentStatus returns the latest commit status of the bot for the ref, or nil if there is none.
+func (sdk *GiteaSdk) currentStatus(ctx context.Context, repo settings.GiteaRepository, ref string) (*gitea.Status, error) {
+	var combined *gitea.CombinedStatus
+	var err error
+	err = sdk.withContext(ctx, func(client ClientInterface) error {
+		combined, _, err = client.GetCombinedStatus(repo.Owner, repo.Name, ref)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, status := range combined.Statuses {
+		if status.Context == statusContext {
+			return status, nil
+		}
+	}
+
+	return nil, nil
 }
 
-func (sdk *GiteaSdk) UpdateStatus(repo settings.GiteaRepository, ref string, details StatusDetails) error {
+// UpdateStatus writes the commit status of the bot. Writing is skipped if the ref already has the same state and
+// description, e.g. because a webhook was delivered twice.
+func (sdk *GiteaSdk) UpdateStatus(ctx context.Context, repo settings.GiteaRepository, ref string, details StatusDetails) error {
 	opt := gitea.CreateStatusOption{
 		TargetURL:   details.Url,
-		Context:     "gitea-sonarqube-bot",
+		Context:     statusContext,
 		Description: details.Message,
 		State:       gitea.StatusState(details.State),
 	}
 
-	_, r, err := sdk.client.CreateStatus(repo.Owner, repo.Name, ref, opt)
+	current, err := sdk.currentStatus(ctx, repo, ref)
 	if err != nil {
-		log.Printf("Error updating status: response code: %d | error: '%s'", r.StatusCode, err.Error())
+		slog.WarnContext(ctx, "Error reading current status. Writing status anyway.", "repository", repo.Owner+"/"+repo.Name, "ref", ref, "error", err)
+	} else if current != nil && current.State == opt.State && current.Description == opt.Description {
+		slog.DebugContext(ctx, "Status unchanged. Skip writing.", "repository", repo.Owner+"/"+repo.Name, "ref", ref)
+		return nil
+	}
+
+	var r *gitea.Response
+	err = sdk.withContext(ctx, func(client ClientInterface) error {
+		_, r, err = client.CreateStatus(repo.Owner, repo.Name, ref, opt)
+		return err
+	})
+	if err != nil {
+		// The response is missing if the request failed before Gitea answered
+		statusCode := 0
+		if r != nil && r.Response != nil {
+			statusCode = r.StatusCode
+		}
+		slog.ErrorContext(ctx, "Error updating status", "repository", repo.Owner+"/"+repo.Name, "ref", ref, "statusCode", statusCode, "error", err)
 	}
 
 	return err
 }
 
-func (sdk *GiteaSdk) DetermineHEAD(repo settings.GiteaRepository, idx int64) (string, error) {
-	pr, _, err := sdk.client.GetPullRequest(repo.Owner, repo.Name, idx)
+func (sdk *GiteaSdk) DetermineHEAD(ctx context.Context, repo settings.GiteaRepository, idx int64) (string, error) {
+	var pr *gitea.PullRequest
+	var err error
+	err = sdk.withContext(ctx, func(client ClientInterface) error {
+		pr, _, err = client.GetPullRequest(repo.Owner, repo.Name, idx)
+		return err
+	})
 	if err != nil {
 		return "", err
 	}
@@ -59,11 +138,182 @@ func (sdk *GiteaSdk) DetermineHEAD(repo settings.GiteaRepository, idx int64) (st
 	return pr.Head.Sha, nil
 }
 
-func New[T ClientInterface](configuration *settings.GiteaConfig, newClient func(url string, options ...gitea.ClientOption) (T, error)) *GiteaSdk {
-	client, err := newClient(configuration.Url, gitea.SetToken(configuration.Token.Value))
+// GetBotUser returns the login name of the user the configured token belongs to.
+func (sdk *GiteaSdk) GetBotUser(ctx context.Context) (string, error) {
+	var user *gitea.User
+	var err error
+	err = sdk.withContext(ctx, func(client ClientInterface) error {
+		user, _, err = client.GetMyUserInfo()
+		return err
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return user.UserName, nil
+}
+
+// CheckRepositoryAccess verifies that the bot user can read the repository and its pull requests, comment on them
+// and write commit statuses.
+func (sdk *GiteaSdk) CheckRepositoryAccess(ctx context.Context, repo settings.GiteaRepository) error {
+	var r *gitea.Repository
+	var err error
+	err = sdk.withContext(ctx, func(client ClientInterface) error {
+		r, _, err = client.GetRepo(repo.Owner, repo.Name)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("cannot read repository: %w", err)
+	}
+
+	if !r.HasPullRequests {
+		return fmt.Errorf("pull requests are disabled for this repository")
+	}
+
+	err = sdk.withContext(ctx, func(client ClientInterface) error {
+		_, _, err = client.ListRepoPullRequests(repo.Owner, repo.Name, gitea.ListPullRequestsOptions{
+			ListOptions: gitea.ListOptions{Page: 1, PageSize: 1},
+		})
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("cannot read pull requests: %w", err)
+	}
+
+	if r.Permissions == nil || !r.Permissions.Pull {
+		return fmt.Errorf("missing read permission required for commenting")
+	}
+
+	if !r.Permissions.Push {
+		return fmt.Errorf("missing write permission required for commit statuses")
+	}
+
+	return nil
+}
+
+// ListOpenPullRequests returns all open pull requests of the repository.
+func (sdk *GiteaSdk) ListOpenPullRequests(ctx context.Context, repo settings.GiteaRepository) ([]PullRequest, error) {
+	result := []PullRequest{}
+
+	for page := 1; ; page++ {
+		var prs []*gitea.PullRequest
+		var err error
+		err = sdk.withContext(ctx, func(client ClientInterface) error {
+			prs, _, err = client.ListRepoPullRequests(repo.Owner, repo.Name, gitea.ListPullRequestsOptions{
+				ListOptions: gitea.ListOptions{Page: page, PageSize: pullRequestsPageSize},
+				State:       gitea.StateOpen,
+			})
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		for _, pr := range prs {
+			p := PullRequest{
+				Index: pr.Index,
+				Title: pr.Title,
+				Url:   pr.HTMLURL,
+			}
+			if pr.Head != nil {
+				p.HeadSha = pr.Head.Sha
+			}
+			if pr.Poster != nil {
+				p.Author = pr.Poster.UserName
+			}
+			result = append(result, p)
+		}
+
+		if len(prs) < pullRequestsPageSize {
+			return result, nil
+		}
+	}
+}
+
+// tokenTransport authenticates every request with the current token, so refreshed tokens are used without restart.
+type tokenTransport struct {
+	base  http.RoundTripper
+	token func() string
+}
+
+func (t *tokenTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.Header.Set("Authorization", "token "+t.token())
+
+	return t.base.RoundTrip(req)
+}
+
+// clientFactory creates the clients bound to a request context.
+type clientFactory struct {
+	url        string
+	httpClient *http.Client
+	newClient  func(url string, options ...gitea.ClientOption) (ClientInterface, error)
+	// The server version is requested once and passed to later clients. Each client would request it again otherwise.
+	mutex   sync.Mutex
+	version string
+}
+
+func (f *clientFactory) serverVersion(ctx context.Context) string {
+	f.mutex.Lock()
+	version := f.version
+	f.mutex.Unlock()
+	if version != "" {
+		return version
+	}
+
+	client, err := f.newClient(f.url, gitea.SetHTTPClient(f.httpClient), gitea.SetContext(ctx), gitea.SetGiteaVersion(""))
+	if err != nil {
+		return ""
+	}
+	version, _, err = client.ServerVersion()
 	if err != nil {
+		slog.DebugContext(ctx, "Cannot determine Gitea version", "error", err)
+		return ""
+	}
+
+	f.mutex.Lock()
+	f.version = version
+	f.mutex.Unlock()
+
+	return version
+}
+
+func (f *clientFactory) forContext(ctx context.Context) (ClientInterface, error) {
+	options := []gitea.ClientOption{gitea.SetHTTPClient(f.httpClient), gitea.SetContext(ctx)}
+	// Without a known version, the client determines it on its own if necessary
+	if version := f.serverVersion(ctx); version != "" {
+		options = append(options, gitea.SetGiteaVersion(version))
+	}
+
+	return f.newClient(f.url, options...)
+}
+
+// New creates a client for the configuration returned by configuration. URL and HTTP settings are only read once, the
+// token on every request.
+func New[T ClientInterface](configuration func() *settings.GiteaConfig, newClient func(url string, options ...gitea.ClientOption) (T, error)) *GiteaSdk {
+	config := configuration()
+	httpClient, err := httpclient.New(config.Http)
+	if err != nil {
+		panic(fmt.Errorf("cannot initialize Gitea client: %w", err))
+	}
+
+	httpClient.Transport = &tokenTransport{
+		base:  httpClient.Transport,
+		token: func() string { return configuration().Token.Value },
+	}
+
+	// Fail early on invalid options instead of on the first request
+	if _, err := newClient(config.Url, gitea.SetHTTPClient(httpClient), gitea.SetGiteaVersion("")); err != nil {
 		panic(fmt.Errorf("cannot initialize Gitea client: %w", err))
 	}
 
-	return &GiteaSdk{client}
+	factory := &clientFactory{
+		url:        config.Url,
+		httpClient: httpClient,
+		newClient: func(url string, options ...gitea.ClientOption) (ClientInterface, error) {
+			return newClient(url, options...)
+		},
+	}
+
+	return &GiteaSdk{client: factory.forContext}
 }
@@ -1,9 +1,13 @@
 package gitea
 
 import (
+	"context"
 	"errors"
 	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"code.gitea.io/sdk/gitea"
 	"codeberg.org/justusbunsi/gitea-sonarqube-bot/internal/settings"
@@ -13,9 +17,26 @@ import (
 
 type SdkMock struct {
 	simulatedError error
+	ctx            context.Context
+	repository     *gitea.Repository
+	hooks          []*gitea.Hook
+	pullRequests   []*gitea.PullRequest
+	statuses       []*gitea.Status
 	mock.Mock
 }
 
+// clientFor hands the mock out as client for every context and remembers the context.
+func clientFor(m *SdkMock) func(ctx context.Context) (ClientInterface, error) {
+	return func(ctx context.Context) (ClientInterface, error) {
+		m.ctx = ctx
+		return m, nil
+	}
+}
+
+func (m *SdkMock) ServerVersion() (string, *gitea.Response, error) {
+	return "1.20.0", nil, nil
+}
+
 func (m *SdkMock) CreateIssueComment(owner, repo string, index int64, opt gitea.CreateIssueCommentOption) (*gitea.Comment, *gitea.Response, error) {
 	m.Called(owner, repo, index, opt)
 	return nil, nil, m.simulatedError
@@ -32,6 +53,9 @@ func (m *SdkMock) CreateStatus(owner, repo, sha string, opts gitea.CreateStatusO
 	}
 	return nil, r, m.simulatedError
 }
+func (m *SdkMock) GetCombinedStatus(owner, repo, ref string) (*gitea.CombinedStatus, *gitea.Response, error) {
+	return &gitea.CombinedStatus{Statuses: m.statuses}, nil, m.simulatedError
+}
 func (m *SdkMock) GetPullRequest(owner, repo string, index int64) (*gitea.PullRequest, *gitea.Response, error) {
 	m.Called(owner, repo, index)
 	return &gitea.PullRequest{
@@ -41,6 +65,36 @@ func (m *SdkMock) GetPullRequest(owner, repo string, index int64) (*gitea.PullRe
 	}, nil, m.simulatedError
 }
 
+func (m *SdkMock) GetMyUserInfo() (*gitea.User, *gitea.Response, error) {
+	m.Called()
+	return &gitea.User{UserName: "sonarqube-bot"}, nil, m.simulatedError
+}
+func (m *SdkMock) GetRepo(owner, reponame string) (*gitea.Repository, *gitea.Response, error) {
+	m.Called(owner, reponame)
+	return m.repository, nil, m.simulatedError
+}
+func (m *SdkMock) ListRepoPullRequests(owner, repo string, opt gitea.ListPullRequestsOptions) ([]*gitea.PullRequest, *gitea.Response, error) {
+	m.Called(owner, repo, opt)
+	start := min((opt.Page-1)*opt.PageSize, len(m.pullRequests))
+	end := min(start+opt.PageSize, len(m.pullRequests))
+	return m.pullRequests[start:end], nil, m.simulatedError
+}
+
+func (m *SdkMock) ListRepoHooks(user, repo string, opt gitea.ListHooksOptions) ([]*gitea.Hook, *gitea.Response, error) {
+	m.Called(user, repo, opt)
+	start := min((opt.Page-1)*opt.PageSize, len(m.hooks))
+	end := min(start+opt.PageSize, len(m.hooks))
+	return m.hooks[start:end], nil, m.simulatedError
+}
+func (m *SdkMock) CreateRepoHook(user, repo string, opt gitea.CreateHookOption) (*gitea.Hook, *gitea.Response, error) {
+	m.Called(user, repo, opt)
+	return nil, nil, m.simulatedError
+}
+func (m *SdkMock) EditRepoHook(user, repo string, id int64, opt gitea.EditHookOption) (*gitea.Response, error) {
+	m.Called(user, repo, id, opt)
+	return nil, m.simulatedError
+}
+
 func TestNew(t *testing.T) {
 	t.Run("Success", func(t *testing.T) {
 		config := &settings.GiteaConfig{
@@ -53,7 +107,7 @@ func TestNew(t *testing.T) {
 		callback := func(url string, options ...gitea.ClientOption) (*SdkMock, error) {
 			return &SdkMock{}, nil
 		}
-		assert.IsType(t, &GiteaSdk{}, New(config, callback), "")
+		assert.IsType(t, &GiteaSdk{}, New(func() *settings.GiteaConfig { return config }, callback), "")
 	})
 
 	t.Run("Initialization errors", func(t *testing.T) {
@@ -67,7 +121,83 @@ func TestNew(t *testing.T) {
 		callback := func(url string, options ...gitea.ClientOption) (*SdkMock, error) {
 			return nil, errors.New("Simulated initialization error")
 		}
-		assert.PanicsWithError(t, "cannot initialize Gitea client: Simulated initialization error", func() { New(config, callback) })
+		assert.PanicsWithError(t, "cannot initialize Gitea client: Simulated initialization error", func() { New(func() *settings.GiteaConfig { return config }, callback) })
+	})
+
+	t.Run("Refreshed token", func(t *testing.T) {
+		var authorization []string
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			authorization = append(authorization, r.Header.Get("Authorization"))
+			_, _ = w.Write([]byte(`{"login":"sonarqube-bot","version":"1.20.0"}`))
+		}))
+		t.Cleanup(server.Close)
+
+		config := &settings.GiteaConfig{
+			Url: server.URL,
+			Token: &settings.Token{
+				Value: "first-token",
+			},
+		}
+		sdk := New(func() *settings.GiteaConfig { return config }, gitea.NewClient)
+
+		_, err := sdk.GetBotUser(context.Background())
+		assert.NoError(t, err)
+
+		config.Token = &settings.Token{Value: "second-token"}
+		_, err = sdk.GetBotUser(context.Background())
+		assert.NoError(t, err)
+
+		assert.Equal(t, "token first-token", authorization[0])
+		assert.Equal(t, "token second-token", authorization[len(authorization)-1])
+	})
+
+	t.Run("Concurrent calls", func(t *testing.T) {
+		release := make(chan struct{})
+		var versionRequests atomic.Int32
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.URL.Path {
+			case "/api/v1/version":
+				versionRequests.Add(1)
+				_, _ = w.Write([]byte(`{"version":"1.20.0"}`))
+			case "/api/v1/repos/test-owner/slow/pulls/1":
+				select {
+				case <-release:
+				case <-r.Context().Done():
+				}
+			default:
+				_, _ = w.Write([]byte(`{"login":"sonarqube-bot"}`))
+			}
+		}))
+		t.Cleanup(server.Close)
+		t.Cleanup(func() { close(release) })
+
+		config := &settings.GiteaConfig{
+			Url:   server.URL,
+			Token: &settings.Token{Value: "test-token"},
+		}
+		sdk := New(func() *settings.GiteaConfig { return config }, gitea.NewClient)
+		_, err := sdk.GetBotUser(context.Background())
+		assert.NoError(t, err)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		slow := make(chan error)
+		go func() {
+			_, err := sdk.DetermineHEAD(ctx, settings.GiteaRepository{Owner: "test-owner", Name: "slow"}, 1)
+			slow <- err
+		}()
+
+		user, err := sdk.GetBotUser(context.Background())
+		assert.NoError(t, err)
+		assert.Equal(t, "sonarqube-bot", user, "Call blocked by a pending one")
+
+		cancel()
+		select {
+		case err := <-slow:
+			assert.ErrorIs(t, err, context.Canceled)
+		case <-time.After(5 * time.Second):
+			assert.Fail(t, "Canceled call still pending")
+		}
+		assert.Equal(t, int32(1), versionRequests.Load(), "Version requested more than once")
 	})
 }
 
@@ -76,10 +206,10 @@ func TestDetermineHEAD(t *testing.T) {
 		clientMock := &SdkMock{}
 		clientMock.On("GetPullRequest", "test-owner", "test-repo", int64(1)).Once()
 
-		sdk := GiteaSdk{
-			client: clientMock,
+		sdk := &GiteaSdk{
+			client: clientFor(clientMock),
 		}
-		sha, err := sdk.DetermineHEAD(settings.GiteaRepository{
+		sha, err := sdk.DetermineHEAD(context.Background(), settings.GiteaRepository{
 			Owner: "test-owner",
 			Name:  "test-repo",
 		}, 1)
@@ -89,17 +219,35 @@ func TestDetermineHEAD(t *testing.T) {
 		clientMock.AssertExpectations(t)
 	})
 
+	t.Run("Context", func(t *testing.T) {
+		type ctxKey struct{}
+		ctx := context.WithValue(context.Background(), ctxKey{}, "webhook")
+		clientMock := &SdkMock{}
+		clientMock.On("GetPullRequest", "test-owner", "test-repo", int64(1)).Once()
+
+		sdk := &GiteaSdk{
+			client: clientFor(clientMock),
+		}
+		_, _ = sdk.DetermineHEAD(ctx, settings.GiteaRepository{
+			Owner: "test-owner",
+			Name:  "test-repo",
+		}, 1)
+
+		assert.Equal(t, ctx, clientMock.ctx, "Context not handed over to client")
+		clientMock.AssertExpectations(t)
+	})
+
 	t.Run("API error", func(t *testing.T) {
 		clientMock := &SdkMock{
 			simulatedError: errors.New("Simulated error"),
 		}
 		clientMock.On("GetPullRequest", "test-owner", "test-repo", int64(1)).Once()
 
-		sdk := GiteaSdk{
-			client: clientMock,
+		sdk := &GiteaSdk{
+			client: clientFor(clientMock),
 		}
 
-		_, err := sdk.DetermineHEAD(settings.GiteaRepository{
+		_, err := sdk.DetermineHEAD(context.Background(), settings.GiteaRepository{
 			Owner: "test-owner",
 			Name:  "test-repo",
 		}, 1)
@@ -113,11 +261,11 @@ func TestUpdateStatus(t *testing.T) {
 	t.Run("Success", func(t *testing.T) {
 		clientMock := &SdkMock{}
 		clientMock.On("CreateStatus", "test-owner", "test-repo", "a1aada0b7b19e58ae539b4812d960bca35ev78cb", mock.Anything).Once()
-		sdk := GiteaSdk{
-			client: clientMock,
+		sdk := &GiteaSdk{
+			client: clientFor(clientMock),
 		}
 
-		err := sdk.UpdateStatus(settings.GiteaRepository{
+		err := sdk.UpdateStatus(context.Background(), settings.GiteaRepository{
 			Owner: "test-owner",
 			Name:  "test-repo",
 		}, "a1aada0b7b19e58ae539b4812d960bca35ev78cb", StatusDetails{
@@ -135,16 +283,64 @@ func TestUpdateStatus(t *testing.T) {
 		assert.Equal(t, gitea.StatusSuccess, actualStatusOption.State)
 	})
 
+	t.Run("Unchanged", func(t *testing.T) {
+		clientMock := &SdkMock{
+			statuses: []*gitea.Status{
+				{Context: "other-ci", State: gitea.StatusFailure, Description: "failed"},
+				{Context: "gitea-sonarqube-bot", State: gitea.StatusSuccess, Description: "expected message"},
+			},
+		}
+		sdk := &GiteaSdk{
+			client: clientFor(clientMock),
+		}
+
+		err := sdk.UpdateStatus(context.Background(), settings.GiteaRepository{
+			Owner: "test-owner",
+			Name:  "test-repo",
+		}, "a1aada0b7b19e58ae539b4812d960bca35ev78cb", StatusDetails{
+			Url:     "http://example.com",
+			Message: "expected message",
+			State:   StatusOK,
+		})
+
+		assert.Nil(t, err)
+		clientMock.AssertNotCalled(t, "CreateStatus")
+	})
+
+	t.Run("Changed state", func(t *testing.T) {
+		clientMock := &SdkMock{
+			statuses: []*gitea.Status{
+				{Context: "gitea-sonarqube-bot", State: gitea.StatusPending, Description: "expected message"},
+			},
+		}
+		clientMock.On("CreateStatus", "test-owner", "test-repo", "a1aada0b7b19e58ae539b4812d960bca35ev78cb", mock.Anything).Once()
+		sdk := &GiteaSdk{
+			client: clientFor(clientMock),
+		}
+
+		err := sdk.UpdateStatus(context.Background(), settings.GiteaRepository{
+			Owner: "test-owner",
+			Name:  "test-repo",
+		}, "a1aada0b7b19e58ae539b4812d960bca35ev78cb", StatusDetails{
+			Url:     "http://example.com",
+			Message: "expected message",
+			State:   StatusOK,
+		})
+
+		assert.Nil(t, err)
+		clientMock.AssertExpectations(t)
+	})
+
 	t.Run("API error", func(t *testing.T) {
 		clientMock := &SdkMock{
 			simulatedError: errors.New("Simulated error"),
 		}
 		clientMock.On("CreateStatus", "test-owner", "test-repo", "a1aada0b7b19e58ae539b4812d960bca35ev78cb", mock.Anything).Once()
-		sdk := GiteaSdk{
-			client: clientMock,
+		sdk := &GiteaSdk{
+			client: clientFor(clientMock),
 		}
 
-		err := sdk.UpdateStatus(settings.GiteaRepository{
+		err := sdk.UpdateStatus(context.Background(), settings.GiteaRepository{
 			Owner: "test-owner",
 			Name:  "test-repo",
 		}, "a1aada0b7b19e58ae539b4812d960bca35ev78cb", StatusDetails{
@@ -162,11 +358,11 @@ func TestPostComment(t *testing.T) {
 	t.Run("Success", func(t *testing.T) {
 		clientMock := &SdkMock{}
 		clientMock.On("CreateIssueComment", "test-owner", "test-repo", int64(1), mock.Anything).Once()
-		sdk := GiteaSdk{
-			client: clientMock,
+		sdk := &GiteaSdk{
+			client: clientFor(clientMock),
 		}
 
-		err := sdk.PostComment(settings.GiteaRepository{
+		err := sdk.PostComment(context.Background(), settings.GiteaRepository{
 			Owner: "test-owner",
 			Name:  "test-repo",
 		}, 1, "test post comment")
@@ -183,11 +379,11 @@ func TestPostComment(t *testing.T) {
 			simulatedError: errors.New("Simulated error"),
 		}
 		clientMock.On("CreateIssueComment", "test-owner", "test-repo", int64(1), mock.Anything).Once()
-		sdk := GiteaSdk{
-			client: clientMock,
+		sdk := &GiteaSdk{
+			client: clientFor(clientMock),
 		}
 
-		err := sdk.PostComment(settings.GiteaRepository{
+		err := sdk.PostComment(context.Background(), settings.GiteaRepository{
 			Owner: "test-owner",
 			Name:  "test-repo",
 		}, 1, "test post comment")
@@ -196,3 +392,350 @@ func TestPostComment(t *testing.T) {
 		clientMock.AssertExpectations(t)
 	})
 }
+
+func TestGetBotUser(t *testing.T) {
+	t.Run("Success", func(t *testing.T) {
+		clientMock := &SdkMock{}
+		clientMock.On("GetMyUserInfo").Once()
+
+		sdk := &GiteaSdk{
+			client: clientFor(clientMock),
+		}
+		user, err := sdk.GetBotUser(context.Background())
+
+		assert.Nil(t, err)
+		assert.Equal(t, "sonarqube-bot", user)
+		clientMock.AssertExpectations(t)
+	})
+
+	t.Run("API error", func(t *testing.T) {
+		clientMock := &SdkMock{
+			simulatedError: errors.New("Simulated error"),
+		}
+		clientMock.On("GetMyUserInfo").Once()
+
+		sdk := &GiteaSdk{
+			client: clientFor(clientMock),
+		}
+		_, err := sdk.GetBotUser(context.Background())
+
+		assert.Errorf(t, err, "Simulated error")
+		clientMock.AssertExpectations(t)
+	})
+}
+
+func TestCheckRepositoryAccess(t *testing.T) {
+	repo := settings.GiteaRepository{
+		Owner: "test-owner",
+		Name:  "test-repo",
+	}
+
+	t.Run("Success", func(t *testing.T) {
+		clientMock := &SdkMock{
+			repository: &gitea.Repository{
+				HasPullRequests: true,
+				Permissions:     &gitea.Permission{Pull: true, Push: true},
+			},
+		}
+		clientMock.On("GetRepo", "test-owner", "test-repo").Once()
+		clientMock.On("ListRepoPullRequests", "test-owner", "test-repo", mock.Anything).Once()
+
+		sdk := &GiteaSdk{
+			client: clientFor(clientMock),
+		}
+
+		assert.Nil(t, sdk.CheckRepositoryAccess(context.Background(), repo))
+		clientMock.AssertExpectations(t)
+	})
+
+	t.Run("Unreadable repository", func(t *testing.T) {
+		clientMock := &SdkMock{
+			simulatedError: errors.New("404 Not Found"),
+		}
+		clientMock.On("GetRepo", "test-owner", "test-repo").Once()
+
+		sdk := &GiteaSdk{
+			client: clientFor(clientMock),
+		}
+
+		assert.EqualError(t, sdk.CheckRepositoryAccess(context.Background(), repo), "cannot read repository: 404 Not Found")
+		clientMock.AssertExpectations(t)
+	})
+
+	t.Run("Pull requests disabled", func(t *testing.T) {
+		clientMock := &SdkMock{
+			repository: &gitea.Repository{
+				HasPullRequests: false,
+				Permissions:     &gitea.Permission{Pull: true, Push: true},
+			},
+		}
+		clientMock.On("GetRepo", "test-owner", "test-repo").Once()
+
+		sdk := &GiteaSdk{
+			client: clientFor(clientMock),
+		}
+
+		assert.EqualError(t, sdk.CheckRepositoryAccess(context.Background(), repo), "pull requests are disabled for this repository")
+		clientMock.AssertExpectations(t)
+	})
+
+	t.Run("Missing write permission", func(t *testing.T) {
+		clientMock := &SdkMock{
+			repository: &gitea.Repository{
+				HasPullRequests: true,
+				Permissions:     &gitea.Permission{Pull: true},
+			},
+		}
+		clientMock.On("GetRepo", "test-owner", "test-repo").Once()
+		clientMock.On("ListRepoPullRequests", "test-owner", "test-repo", mock.Anything).Once()
+
+		sdk := &GiteaSdk{
+			client: clientFor(clientMock),
+		}
+
+		assert.EqualError(t, sdk.CheckRepositoryAccess(context.Background(), repo), "missing write permission required for commit statuses")
+		clientMock.AssertExpectations(t)
+	})
+}
+
+func TestListOpenPullRequests(t *testing.T) {
+	repo := settings.GiteaRepository{
+		Owner: "test-owner",
+		Name:  "test-repo",
+	}
+
+	t.Run("Paginated", func(t *testing.T) {
+		prs := []*gitea.PullRequest{}
+		for i := 1; i <= pullRequestsPageSize+1; i++ {
+			prs = append(prs, &gitea.PullRequest{
+				Index:   int64(i),
+				Title:   "Change README",
+				HTMLURL: "https://gitea.example.com/test-owner/test-repo/pulls/1",
+				Head:    &gitea.PRBranchInfo{Sha: "a1aada0b"},
+				Poster:  &gitea.User{UserName: "test-user"},
+			})
+		}
+
+		clientMock := &SdkMock{pullRequests: prs}
+		clientMock.On("ListRepoPullRequests", "test-owner", "test-repo", mock.MatchedBy(func(opt gitea.ListPullRequestsOptions) bool {
+			return opt.State == gitea.StateOpen
+		})).Twice()
+
+		sdk := &GiteaSdk{
+			client: clientFor(clientMock),
+		}
+
+		result, err := sdk.ListOpenPullRequests(context.Background(), repo)
+		assert.Nil(t, err)
+		assert.Len(t, result, pullRequestsPageSize+1)
+		assert.Equal(t, PullRequest{
+			Index:   1,
+			Title:   "Change README",
+			Url:     "https://gitea.example.com/test-owner/test-repo/pulls/1",
+			HeadSha: "a1aada0b",
+			Author:  "test-user",
+		}, result[0])
+		clientMock.AssertExpectations(t)
+	})
+
+	t.Run("Error", func(t *testing.T) {
+		clientMock := &SdkMock{simulatedError: errors.New("404 Not Found")}
+		clientMock.On("ListRepoPullRequests", "test-owner", "test-repo", mock.Anything).Once()
+
+		sdk := &GiteaSdk{
+			client: clientFor(clientMock),
+		}
+
+		_, err := sdk.ListOpenPullRequests(context.Background(), repo)
+		assert.EqualError(t, err, "404 Not Found")
+	})
+}
+
+func TestListHooks(t *testing.T) {
+	repo := settings.GiteaRepository{
+		Owner: "test-owner",
+		Name:  "test-repo",
+	}
+
+	t.Run("Success", func(t *testing.T) {
+		clientMock := &SdkMock{
+			hooks: []*gitea.Hook{
+				{
+					ID:     7,
+					Config: map[string]string{"url": "https://bot.example.com/hooks/gitea", "content_type": "json"},
+					Events: []string{"pull_request", "issue_comment"},
+					Active: true,
+				},
+			},
+		}
+		clientMock.On("ListRepoHooks", "test-owner", "test-repo", gitea.ListHooksOptions{
+			ListOptions: gitea.ListOptions{Page: 1, PageSize: hooksPageSize},
+		}).Once()
+
+		sdk := &GiteaSdk{
+			client: clientFor(clientMock),
+		}
+		hooks, err := sdk.ListHooks(context.Background(), repo)
+
+		assert.Nil(t, err)
+		assert.Equal(t, []Hook{
+			{
+				ID:          7,
+				Url:         "https://bot.example.com/hooks/gitea",
+				ContentType: "json",
+				Events:      []string{"pull_request", "issue_comment"},
+				Active:      true,
+			},
+		}, hooks)
+		clientMock.AssertExpectations(t)
+	})
+
+	t.Run("Paginated", func(t *testing.T) {
+		hooks := []*gitea.Hook{}
+		for i := 1; i <= hooksPageSize+1; i++ {
+			hooks = append(hooks, &gitea.Hook{ID: int64(i)})
+		}
+
+		clientMock := &SdkMock{hooks: hooks}
+		clientMock.On("ListRepoHooks", "test-owner", "test-repo", mock.Anything).Twice()
+
+		sdk := &GiteaSdk{
+			client: clientFor(clientMock),
+		}
+
+		result, err := sdk.ListHooks(context.Background(), repo)
+		assert.Nil(t, err)
+		assert.Len(t, result, hooksPageSize+1)
+		assert.Equal(t, int64(hooksPageSize+1), result[hooksPageSize].ID)
+		clientMock.AssertExpectations(t)
+	})
+
+	t.Run("Error", func(t *testing.T) {
+		clientMock := &SdkMock{simulatedError: errors.New("404 Not Found")}
+		clientMock.On("ListRepoHooks", "test-owner", "test-repo", mock.Anything).Once()
+
+		sdk := &GiteaSdk{
+			client: clientFor(clientMock),
+		}
+
+		_, err := sdk.ListHooks(context.Background(), repo)
+		assert.EqualError(t, err, "404 Not Found")
+		clientMock.AssertExpectations(t)
+	})
+}
+
+func TestCreateHook(t *testing.T) {
+	clientMock := &SdkMock{}
+	clientMock.On("CreateRepoHook", "test-owner", "test-repo", gitea.CreateHookOption{
+		Type:   gitea.HookTypeGitea,
+		Config: map[string]string{"url": "https://bot.example.com/hooks/gitea", "content_type": "json", "secret": "haxxor"},
+		Events: []string{"pull_request", "issue_comment"},
+		Active: true,
+	}).Once()
+
+	sdk := &GiteaSdk{
+		client: clientFor(clientMock),
+	}
+	err := sdk.CreateHook(context.Background(), settings.GiteaRepository{
+		Owner: "test-owner",
+		Name:  "test-repo",
+	}, Hook{
+		Url:         "https://bot.example.com/hooks/gitea",
+		ContentType: "json",
+		Events:      []string{"pull_request", "issue_comment"},
+		Active:      true,
+	}, "haxxor")
+
+	assert.Nil(t, err)
+	clientMock.AssertExpectations(t)
+}
+
+type GiteaSdkStub struct {
+	GiteaSdkInterface
+	mock.Mock
+}
+
+func (s *GiteaSdkStub) PostComment(_ context.Context, repo settings.GiteaRepository, idx int, msg string) error {
+	s.Called(repo, idx, msg)
+	return nil
+}
+
+func (s *GiteaSdkStub) UpdateStatus(_ context.Context, repo settings.GiteaRepository, ref string, details StatusDetails) error {
+	s.Called(repo, ref, details)
+	return nil
+}
+
+func TestRecordingGiteaSdk(t *testing.T) {
+	dryRunRepo := settings.GiteaRepository{Owner: "test-owner", Name: "dry-run"}
+	liveRepo := settings.GiteaRepository{Owner: "test-owner", Name: "live"}
+	isDryRun := func(repo settings.GiteaRepository) bool {
+		return repo == dryRunRepo
+	}
+
+	t.Run("Records writes in dry run mode", func(t *testing.T) {
+		stub := &GiteaSdkStub{}
+		sdk := NewRecordingGiteaSdk(stub, isDryRun)
+
+		details := StatusDetails{Url: "https://sonarqube.example.com", Message: "OK", State: StatusOK}
+		assert.Nil(t, sdk.UpdateStatus(context.Background(), dryRunRepo, "a1aada0b", details))
+		assert.Nil(t, sdk.PostComment(context.Background(), dryRunRepo, 42, "comment"))
+
+		actions := sdk.Actions()
+		assert.Len(t, actions, 2)
+		assert.Equal(t, RecordedStatus, actions[0].Type)
+		assert.Equal(t, "a1aada0b", actions[0].Ref)
+		assert.Equal(t, &details, actions[0].Status)
+		assert.Equal(t, RecordedComment, actions[1].Type)
+		assert.Equal(t, 42, actions[1].Index)
+		assert.Equal(t, "comment", actions[1].Comment)
+		stub.AssertNotCalled(t, "UpdateStatus")
+		stub.AssertNotCalled(t, "PostComment")
+	})
+
+	t.Run("Passes writes through otherwise", func(t *testing.T) {
+		stub := &GiteaSdkStub{}
+		stub.On("PostComment", liveRepo, 42, "comment").Once()
+		sdk := NewRecordingGiteaSdk(stub, isDryRun)
+
+		assert.Nil(t, sdk.PostComment(context.Background(), liveRepo, 42, "comment"))
+
+		assert.Empty(t, sdk.Actions())
+		stub.AssertExpectations(t)
+	})
+
+	t.Run("Remembers last comment", func(t *testing.T) {
+		stub := &GiteaSdkStub{}
+		stub.On("PostComment", liveRepo, 42, "comment").Once()
+		sdk := NewRecordingGiteaSdk(stub, isDryRun)
+
+		_, ok := sdk.LastComment(liveRepo, 42)
+		assert.False(t, ok)
+
+		assert.Nil(t, sdk.PostComment(context.Background(), liveRepo, 42, "comment"))
+		_ = sdk.PostComment(context.Background(), dryRunRepo, 42, "comment")
+
+		last, ok := sdk.LastComment(liveRepo, 42)
+		assert.True(t, ok)
+		assert.WithinDuration(t, time.Now(), last, time.Second)
+		_, ok = sdk.LastComment(dryRunRepo, 42)
+		assert.False(t, ok)
+	})
+
+	t.Run("Keeps latest actions", func(t *testing.T) {
+		MaxRecordedActions = 2
+		sdk := NewRecordingGiteaSdk(&GiteaSdkStub{}, isDryRun)
+
+		for i := 1; i <= 3; i++ {
+			_ = sdk.PostComment(context.Background(), dryRunRepo, i, "comment")
+		}
+
+		actions := sdk.Actions()
+		assert.Len(t, actions, 2)
+		assert.Equal(t, 2, actions[0].Index)
+		assert.Equal(t, 3, actions[1].Index)
+
+		t.Cleanup(func() {
+			MaxRecordedActions = 100
+		})
+	})
+}
@@ -0,0 +1,91 @@
+package gitea
+
+import (
+	"context"
+
+	"code.gitea.io/sdk/gitea"
+	"codeberg.org/justusbunsi/gitea-sonarqube-bot/internal/settings"
+)
+
+// Page size used when listing webhooks
+const hooksPageSize = 50
+
+// Hook is a repository webhook. Gitea never returns the secret of existing webhooks.
+type Hook struct {
+	ID          int64    `json:"id"`
+	Url         string   `json:"url"`
+	ContentType string   `json:"contentType"`
+	Events      []string `json:"events"`
+	Active      bool     `json:"active"`
+}
+
+func (sdk *GiteaSdk) ListHooks(ctx context.Context, repo settings.GiteaRepository) ([]Hook, error) {
+	result := []Hook{}
+
+	for page := 1; ; page++ {
+		var hooks []*gitea.Hook
+		var err error
+		err = sdk.withContext(ctx, func(client ClientInterface) error {
+			hooks, _, err = client.ListRepoHooks(repo.Owner, repo.Name, gitea.ListHooksOptions{
+				ListOptions: gitea.ListOptions{Page: page, PageSize: hooksPageSize},
+			})
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		for _, h := range hooks {
+			result = append(result, Hook{
+				ID:          h.ID,
+				Url:         h.Config["url"],
+				ContentType: h.Config["content_type"],
+				Events:      h.Events,
+				Active:      h.Active,
+			})
+		}
+
+		if len(hooks) < hooksPageSize {
+			return result, nil
+		}
+	}
+}
+
+func (sdk *GiteaSdk) CreateHook(ctx context.Context, repo settings.GiteaRepository, hook Hook, secret string) error {
+	opt := gitea.CreateHookOption{
+		Type:   gitea.HookTypeGitea,
+		Config: hookConfig(hook, secret),
+		Events: hook.Events,
+		Active: hook.Active,
+	}
+
+	return sdk.withContext(ctx, func(client ClientInterface) error {
+		_, _, err := client.CreateRepoHook(repo.Owner, repo.Name, opt)
+		return err
+	})
+}
+
+func (sdk *GiteaSdk) EditHook(ctx context.Context, repo settings.GiteaRepository, hook Hook, secret string) error {
+	opt := gitea.EditHookOption{
+		Config: hookConfig(hook, secret),
+		Events: hook.Events,
+		Active: &hook.Active,
+	}
+
+	return sdk.withContext(ctx, func(client ClientInterface) error {
+		_, err := client.EditRepoHook(repo.Owner, repo.Name, hook.ID, opt)
+		return err
+	})
+}
+
+func hookConfig(hook Hook, secret string) map[string]string {
+	config := map[string]string{
+		"url":          hook.Url,
+		"content_type": hook.ContentType,
+	}
+	if secret != "" {
+		config["secret"] = secret
+	}
+
+	return config
+}
@@ -0,0 +1,12 @@
+package gitea
+
+// Page size used when listing pull requests
+const pullRequestsPageSize = 50
+
+type PullRequest struct {
+	Index   int64  `json:"index"`
+	Title   string `json:"title"`
+	Url     string `json:"url"`
+	HeadSha string `json:"headSha"`
+	Author  string `json:"author"`
+}
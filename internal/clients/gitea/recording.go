@@ -0,0 +1,155 @@
+package gitea
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"codeberg.org/justusbunsi/gitea-sonarqube-bot/internal/settings"
+)
+
+// MaxRecordedActions limits the number of recorded actions kept in memory. Older ones are dropped first.
+var MaxRecordedActions = 100
+
+type RecordedActionType string
+
+const (
+	RecordedComment RecordedActionType = "comment"
+	RecordedStatus  RecordedActionType = "status"
+	RecordedHook    RecordedActionType = "hook"
+)
+
+// RecordedAction is a write to Gitea that was skipped because of dry run mode.
+type RecordedAction struct {
+	Time       time.Time                `json:"time"`
+	Type       RecordedActionType       `json:"type"`
+	Repository settings.GiteaRepository `json:"repository"`
+	Index      int                      `json:"index,omitempty"`
+	Ref        string                   `json:"ref,omitempty"`
+	Status     *StatusDetails           `json:"status,omitempty"`
+	Comment    string                   `json:"comment,omitempty"`
+	Hook       *Hook                    `json:"hook,omitempty"`
+}
+
+// RecordingGiteaSdk wraps a GiteaSdkInterface and records writes to repositories in dry run mode instead of
+// performing them. Reads are always passed through. For performed writes, it remembers when a pull request was
+// last commented.
+type RecordingGiteaSdk struct {
+	GiteaSdkInterface
+	isDryRun     func(settings.GiteaRepository) bool
+	mutex        sync.Mutex
+	actions      []RecordedAction
+	lastComments map[string]time.Time
+}
+
+func commentKey(repo settings.GiteaRepository, idx int) string {
+	return fmt.Sprintf("%s/%s#%d", repo.Owner, repo.Name, idx)
+}
+
+// LastComment returns when the bot last commented the pull request since startup.
+func (sdk *RecordingGiteaSdk) LastComment(repo settings.GiteaRepository, idx int) (time.Time, bool) {
+	sdk.mutex.Lock()
+	defer sdk.mutex.Unlock()
+
+	t, ok := sdk.lastComments[commentKey(repo, idx)]
+	return t, ok
+}
+
+func (sdk *RecordingGiteaSdk) record(a RecordedAction) {
+	a.Time = time.Now()
+
+	sdk.mutex.Lock()
+	defer sdk.mutex.Unlock()
+
+	sdk.actions = append(sdk.actions, a)
+	if len(sdk.actions) > MaxRecordedActions {
+		sdk.actions = sdk.actions[len(sdk.actions)-MaxRecordedActions:]
+	}
+}
+
+// Actions returns the recorded actions, oldest first.
+func (sdk *RecordingGiteaSdk) Actions() []RecordedAction {
+	sdk.mutex.Lock()
+	defer sdk.mutex.Unlock()
+
+	return append([]RecordedAction{}, sdk.actions...)
+}
+
+func (sdk *RecordingGiteaSdk) PostComment(ctx context.Context, repo settings.GiteaRepository, idx int, msg string) error {
+	if !sdk.isDryRun(repo) {
+		err := sdk.GiteaSdkInterface.PostComment(ctx, repo, idx, msg)
+		if err == nil {
+			sdk.mutex.Lock()
+			sdk.lastComments[commentKey(repo, idx)] = time.Now()
+			sdk.mutex.Unlock()
+		}
+
+		return err
+	}
+
+	slog.InfoContext(ctx, "Dry run: would post comment", "repository", repo.Owner+"/"+repo.Name, "index", idx, "comment", msg)
+	sdk.record(RecordedAction{
+		Type:       RecordedComment,
+		Repository: repo,
+		Index:      idx,
+		Comment:    msg,
+	})
+
+	return nil
+}
+
+func (sdk *RecordingGiteaSdk) UpdateStatus(ctx context.Context, repo settings.GiteaRepository, ref string, details StatusDetails) error {
+	if !sdk.isDryRun(repo) {
+		return sdk.GiteaSdkInterface.UpdateStatus(ctx, repo, ref, details)
+	}
+
+	slog.InfoContext(ctx, "Dry run: would set status", "repository", repo.Owner+"/"+repo.Name, "ref", ref, "state", details.State, "message", details.Message)
+	sdk.record(RecordedAction{
+		Type:       RecordedStatus,
+		Repository: repo,
+		Ref:        ref,
+		Status:     &details,
+	})
+
+	return nil
+}
+
+func (sdk *RecordingGiteaSdk) CreateHook(ctx context.Context, repo settings.GiteaRepository, hook Hook, secret string) error {
+	if !sdk.isDryRun(repo) {
+		return sdk.GiteaSdkInterface.CreateHook(ctx, repo, hook, secret)
+	}
+
+	slog.InfoContext(ctx, "Dry run: would create webhook", "repository", repo.Owner+"/"+repo.Name, "url", hook.Url)
+	sdk.record(RecordedAction{
+		Type:       RecordedHook,
+		Repository: repo,
+		Hook:       &hook,
+	})
+
+	return nil
+}
+
+func (sdk *RecordingGiteaSdk) EditHook(ctx context.Context, repo settings.GiteaRepository, hook Hook, secret string) error {
+	if !sdk.isDryRun(repo) {
+		return sdk.GiteaSdkInterface.EditHook(ctx, repo, hook, secret)
+	}
+
+	slog.InfoContext(ctx, "Dry run: would update webhook", "repository", repo.Owner+"/"+repo.Name, "url", hook.Url)
+	sdk.record(RecordedAction{
+		Type:       RecordedHook,
+		Repository: repo,
+		Hook:       &hook,
+	})
+
+	return nil
+}
+
+func NewRecordingGiteaSdk(sdk GiteaSdkInterface, isDryRun func(settings.GiteaRepository) bool) *RecordingGiteaSdk {
+	return &RecordingGiteaSdk{
+		GiteaSdkInterface: sdk,
+		isDryRun:          isDryRun,
+		lastComments:      map[string]time.Time{},
+	}
+}
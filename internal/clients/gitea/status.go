@@ -11,7 +11,7 @@ const (
 )
 
 type StatusDetails struct {
-	Url     string
-	Message string
-	State   State
+	Url     string `json:"url"`
+	Message string `json:"message"`
+	State   State  `json:"state"`
 }
@@ -0,0 +1,145 @@
+package httpclient
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	"codeberg.org/justusbunsi/gitea-sonarqube-bot/internal/settings"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"golang.org/x/net/http/httpproxy"
+)
+
+const (
+	DefaultTimeout             = 30 * time.Second
+	DefaultConnectTimeout      = 10 * time.Second
+	DefaultTLSHandshakeTimeout = 10 * time.Second
+)
+
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+func orDefault(value time.Duration, fallback time.Duration) time.Duration {
+	if value <= 0 {
+		return fallback
+	}
+	return value
+}
+
+func newTLSConfig(configuration settings.TLSConfig) (*tls.Config, error) {
+	c := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+	}
+
+	if configuration.MinVersion != "" {
+		version, ok := tlsVersions[configuration.MinVersion]
+		if !ok {
+			return nil, fmt.Errorf("unknown TLS version '%s'", configuration.MinVersion)
+		}
+		c.MinVersion = version
+	}
+
+	if configuration.CAFile != "" {
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+
+		content, err := os.ReadFile(configuration.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read CA file: %w", err)
+		}
+
+		if !pool.AppendCertsFromPEM(content) {
+			return nil, fmt.Errorf("no certificates found in CA file '%s'", configuration.CAFile)
+		}
+		c.RootCAs = pool
+	}
+
+	if configuration.CertFile != "" || configuration.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(configuration.CertFile, configuration.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("cannot load client certificate: %w", err)
+		}
+		c.Certificates = []tls.Certificate{cert}
+	}
+
+	if configuration.InsecureSkipVerify {
+		slog.Warn("TLS certificate verification is disabled. Do not use this in production.")
+		c.InsecureSkipVerify = true
+	}
+
+	return c, nil
+}
+
+func newProxy(configuration settings.ProxyConfig) (func(*http.Request) (*url.URL, error), error) {
+	if configuration.Url == "" {
+		return http.ProxyFromEnvironment, nil
+	}
+
+	if _, err := url.Parse(configuration.Url); err != nil {
+		return nil, fmt.Errorf("invalid proxy url: %w", err)
+	}
+
+	proxy := (&httpproxy.Config{
+		HTTPProxy:  configuration.Url,
+		HTTPSProxy: configuration.Url,
+		NoProxy:    configuration.NoProxy,
+	}).ProxyFunc()
+
+	return func(r *http.Request) (*url.URL, error) {
+		return proxy(r.URL)
+	}, nil
+}
+
+// New builds an HTTP client for outbound API calls. Every request is bound by the configured timeouts, unset
+// values fall back to the package defaults. TLS and proxy settings are applied to the transport. Requests are traced
+// and carry the trace context of the request context.
+func New(configuration *settings.HttpConfig) (*http.Client, error) {
+	if configuration == nil {
+		configuration = &settings.HttpConfig{}
+	}
+
+	transport, err := newTransport(configuration)
+	if err != nil {
+		return nil, err
+	}
+
+	return &http.Client{
+		Timeout:   orDefault(configuration.Timeout, DefaultTimeout),
+		Transport: otelhttp.NewTransport(transport),
+	}, nil
+}
+
+func newTransport(configuration *settings.HttpConfig) (*http.Transport, error) {
+	tlsConfig, err := newTLSConfig(configuration.TLS)
+	if err != nil {
+		return nil, err
+	}
+
+	proxy, err := newProxy(configuration.Proxy)
+	if err != nil {
+		return nil, err
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = (&net.Dialer{
+		Timeout:   orDefault(configuration.ConnectTimeout, DefaultConnectTimeout),
+		KeepAlive: 30 * time.Second,
+	}).DialContext
+	transport.TLSHandshakeTimeout = orDefault(configuration.TLSHandshakeTimeout, DefaultTLSHandshakeTimeout)
+	transport.TLSClientConfig = tlsConfig
+	transport.Proxy = proxy
+
+	return transport, nil
+}
@@ -0,0 +1,153 @@
+package httpclient
+
+import (
+	"crypto/tls"
+	"encoding/pem"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"codeberg.org/justusbunsi/gitea-sonarqube-bot/internal/settings"
+	"github.com/stretchr/testify/assert"
+)
+
+// SETUP: mute logs
+func TestMain(m *testing.M) {
+	log.SetOutput(ioutil.Discard)
+	os.Exit(m.Run())
+}
+
+func writeServerCA(t *testing.T, server *httptest.Server) string {
+	file := path.Join(t.TempDir(), "ca.pem")
+	content := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	_ = ioutil.WriteFile(file, content, 0444)
+
+	return file
+}
+
+func TestNew(t *testing.T) {
+	t.Run("Defaults", func(t *testing.T) {
+		actual, err := New(nil)
+		assert.Nil(t, err)
+		assert.Equal(t, DefaultTimeout, actual.Timeout)
+
+		transport, err := newTransport(&settings.HttpConfig{})
+		assert.Nil(t, err)
+		assert.Equal(t, DefaultTLSHandshakeTimeout, transport.TLSHandshakeTimeout)
+		assert.Equal(t, uint16(tls.VersionTLS12), transport.TLSClientConfig.MinVersion)
+	})
+
+	t.Run("Configured", func(t *testing.T) {
+		configuration := &settings.HttpConfig{
+			Timeout:             5 * time.Second,
+			ConnectTimeout:      time.Second,
+			TLSHandshakeTimeout: 2 * time.Second,
+			TLS: settings.TLSConfig{
+				MinVersion: "1.3",
+			},
+		}
+
+		actual, err := New(configuration)
+		assert.Nil(t, err)
+		assert.Equal(t, 5*time.Second, actual.Timeout)
+
+		transport, err := newTransport(configuration)
+		assert.Nil(t, err)
+		assert.Equal(t, 2*time.Second, transport.TLSHandshakeTimeout)
+		assert.Equal(t, uint16(tls.VersionTLS13), transport.TLSClientConfig.MinVersion)
+	})
+
+	t.Run("Custom CA", func(t *testing.T) {
+		server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+		defer server.Close()
+
+		untrusted, _ := New(nil)
+		_, err := untrusted.Get(server.URL)
+		assert.Error(t, err, "Unknown CA accepted")
+
+		trusted, err := New(&settings.HttpConfig{
+			TLS: settings.TLSConfig{
+				CAFile: writeServerCA(t, server),
+			},
+		})
+		assert.Nil(t, err)
+
+		response, err := trusted.Get(server.URL)
+		assert.Nil(t, err, "Configured CA not trusted")
+		assert.Equal(t, http.StatusOK, response.StatusCode)
+	})
+
+	t.Run("Insecure skip verify", func(t *testing.T) {
+		server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+		defer server.Close()
+
+		client, err := New(&settings.HttpConfig{
+			TLS: settings.TLSConfig{
+				InsecureSkipVerify: true,
+			},
+		})
+		assert.Nil(t, err)
+
+		_, err = client.Get(server.URL)
+		assert.Nil(t, err)
+	})
+
+	t.Run("Missing CA file", func(t *testing.T) {
+		_, err := New(&settings.HttpConfig{
+			TLS: settings.TLSConfig{
+				CAFile: path.Join(t.TempDir(), "missing.pem"),
+			},
+		})
+
+		assert.ErrorContains(t, err, "cannot read CA file")
+	})
+
+	t.Run("Invalid CA file", func(t *testing.T) {
+		file := path.Join(t.TempDir(), "ca.pem")
+		_ = ioutil.WriteFile(file, []byte("no certificate"), 0444)
+
+		_, err := New(&settings.HttpConfig{
+			TLS: settings.TLSConfig{
+				CAFile: file,
+			},
+		})
+
+		assert.ErrorContains(t, err, "no certificates found")
+	})
+
+	t.Run("Invalid client certificate", func(t *testing.T) {
+		_, err := New(&settings.HttpConfig{
+			TLS: settings.TLSConfig{
+				CertFile: path.Join(t.TempDir(), "cert.pem"),
+				KeyFile:  path.Join(t.TempDir(), "key.pem"),
+			},
+		})
+
+		assert.ErrorContains(t, err, "cannot load client certificate")
+	})
+
+	t.Run("Proxy", func(t *testing.T) {
+		transport, err := newTransport(&settings.HttpConfig{
+			Proxy: settings.ProxyConfig{
+				Url:     "http://proxy.example.com:3128",
+				NoProxy: "internal.example.com",
+			},
+		})
+		assert.Nil(t, err)
+
+		proxy := transport.Proxy
+
+		external, _ := http.NewRequest(http.MethodGet, "https://sonarcloud.io/api", nil)
+		actual, _ := proxy(external)
+		assert.Equal(t, "http://proxy.example.com:3128", actual.String())
+
+		internal, _ := http.NewRequest(http.MethodGet, "https://internal.example.com/api", nil)
+		actual, _ = proxy(internal)
+		assert.Nil(t, actual, "No proxy list ignored")
+	})
+}
@@ -0,0 +1,49 @@
+// The tracing package depends on the settings, which depend on this package, so this test is external.
+package httpclient_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"codeberg.org/justusbunsi/gitea-sonarqube-bot/internal/clients/httpclient"
+	"codeberg.org/justusbunsi/gitea-sonarqube-bot/internal/tracing"
+	"github.com/stretchr/testify/assert"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+func TestTracing(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	tracing.Register(provider)
+
+	var traceparent string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		traceparent = r.Header.Get("traceparent")
+	}))
+	defer server.Close()
+
+	client, err := httpclient.New(nil)
+	assert.Nil(t, err)
+
+	ctx, span := tracing.Start(context.Background(), "parent")
+	request, _ := http.NewRequestWithContext(ctx, http.MethodGet, server.URL, nil)
+	response, err := client.Do(request)
+	assert.Nil(t, err)
+	// The client span ends with the response body
+	response.Body.Close()
+	span.End()
+
+	spans := exporter.GetSpans()
+	assert.Len(t, spans, 2)
+	assert.Equal(t, "HTTP GET", spans[0].Name)
+	assert.Equal(t, span.SpanContext().TraceID(), spans[0].SpanContext.TraceID())
+	assert.Contains(t, traceparent, span.SpanContext().TraceID().String(), "Trace context not propagated")
+
+	t.Cleanup(func() {
+		tracing.Register(noop.NewTracerProvider())
+	})
+}
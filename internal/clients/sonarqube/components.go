@@ -0,0 +1,116 @@
+package sonarqube
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+type ComponentTreeComponent struct {
+	Key       string                     `json:"key"`
+	Path      string                     `json:"path"`
+	Qualifier string                     `json:"qualifier"`
+	Measures  []MeasuresComponentMeasure `json:"measures"`
+}
+
+// Measure returns the current value of the given metric. New code metrics are taken from the period value.
+func (c *ComponentTreeComponent) Measure(metric string) (string, bool) {
+	for _, m := range c.Measures {
+		if m.Metric == metric {
+			return m.currentValue(), true
+		}
+	}
+	return "", false
+}
+
+type ComponentTreeResponse struct {
+	Paging        Paging                   `json:"paging"`
+	BaseComponent ComponentTreeComponent   `json:"baseComponent"`
+	Components    []ComponentTreeComponent `json:"components"`
+	Errors        []Error                  `json:"errors"`
+}
+
+func (r *ComponentTreeResponse) getPaging() Paging {
+	return r.Paging
+}
+
+func (r *ComponentTreeResponse) getErrors() []Error {
+	return r.Errors
+}
+
+type rankedComponent struct {
+	ComponentTreeComponent
+	Value int
+}
+
+// worstComponents returns the components with a positive integer value for the given metric, sorted descending
+// and capped at max. A non-positive max disables the cap. The number of components cut off is returned as well.
+func (r *ComponentTreeResponse) worstComponents(metric string, max int) ([]rankedComponent, int) {
+	ranked := []rankedComponent{}
+	for _, c := range r.Components {
+		raw, ok := c.Measure(metric)
+		if !ok {
+			continue
+		}
+		value, err := strconv.Atoi(raw)
+		if err != nil || value <= 0 {
+			continue
+		}
+		ranked = append(ranked, rankedComponent{c, value})
+	}
+
+	sort.SliceStable(ranked, func(i, j int) bool {
+		return ranked[i].Value > ranked[j].Value
+	})
+
+	if max > 0 && len(ranked) > max {
+		return ranked[:max], len(ranked) - max
+	}
+
+	return ranked, 0
+}
+
+func formatLineRanges(lines []int) string {
+	ranges := []string{}
+	for i := 0; i < len(lines); {
+		j := i
+		for j+1 < len(lines) && lines[j+1] == lines[j]+1 {
+			j++
+		}
+		if i == j {
+			ranges = append(ranges, strconv.Itoa(lines[i]))
+		} else {
+			ranges = append(ranges, fmt.Sprintf("%d-%d", lines[i], lines[j]))
+		}
+		i = j + 1
+	}
+	return strings.Join(ranges, ", ")
+}
+
+func formatPercentage(value string) string {
+	if value == "" {
+		return "-"
+	}
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return value
+	}
+	return fmt.Sprintf("%.1f%%", f)
+}
+
+// giteaDiffAnchor builds the anchor Gitea uses for a file inside the pull request diff view.
+func giteaDiffAnchor(path string) string {
+	sum := sha1.Sum([]byte(path))
+	return "diff-" + hex.EncodeToString(sum[:])
+}
+
+// renderFileName links the file to the diff of the Gitea pull request located at pullUrl if available.
+func renderFileName(path string, pullUrl string) string {
+	if pullUrl == "" {
+		return fmt.Sprintf("`%s`", path)
+	}
+	return fmt.Sprintf("[%s](%s/files#%s)", path, pullUrl, giteaDiffAnchor(path))
+}
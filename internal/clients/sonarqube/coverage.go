@@ -0,0 +1,103 @@
+package sonarqube
+
+import (
+	"fmt"
+	"strings"
+)
+
+type SourceLine struct {
+	Line     int  `json:"line"`
+	LineHits *int `json:"lineHits,omitempty"`
+	IsNew    bool `json:"isNew"`
+}
+
+type SourceLinesResponse struct {
+	Sources []SourceLine `json:"sources"`
+	Errors  []Error      `json:"errors"`
+}
+
+// UncoveredNewLines returns the line numbers of new and executable lines that are not covered by tests.
+func (r *SourceLinesResponse) UncoveredNewLines() []int {
+	lines := []int{}
+	for _, l := range r.Sources {
+		if l.IsNew && l.LineHits != nil && *l.LineHits == 0 {
+			lines = append(lines, l.Line)
+		}
+	}
+	return lines
+}
+
+type UncoveredFile struct {
+	Path           string
+	UncoveredLines int
+	Coverage       string
+	Lines          []int
+}
+
+type CoverageReport struct {
+	Coverage string
+	Files    []UncoveredFile
+	// Omitted is the number of files with uncovered new lines that did not make it into Files due to the limit.
+	Omitted int
+}
+
+// NewCoverageReport picks the files with uncovered new lines out of the component tree, sorted worst first and
+// capped at maxFiles. A non-positive maxFiles disables the cap.
+func NewCoverageReport(tree *ComponentTreeResponse, maxFiles int) *CoverageReport {
+	report := &CoverageReport{}
+	report.Coverage, _ = tree.BaseComponent.Measure("new_coverage")
+
+	var files []rankedComponent
+	files, report.Omitted = tree.worstComponents("new_uncovered_lines", maxFiles)
+	for _, c := range files {
+		coverage, _ := c.Measure("new_coverage")
+		report.Files = append(report.Files, UncoveredFile{
+			Path:           c.Path,
+			UncoveredLines: c.Value,
+			Coverage:       coverage,
+		})
+	}
+
+	return report
+}
+
+// GetRenderedMarkdown renders the report as collapsible section. File names link to the diff of the Gitea pull
+// request located at pullUrl.
+func (r *CoverageReport) GetRenderedMarkdown(pullUrl string) string {
+	message := []string{
+		"#### Coverage",
+		fmt.Sprintf("**Coverage on new code**: %s", formatPercentage(r.Coverage)),
+	}
+
+	if len(r.Files) == 0 {
+		message = append(message, ":white_check_mark: No uncovered new lines.")
+		return strings.Join(message, "\n\n")
+	}
+
+	rows := make([]string, len(r.Files))
+	for i, f := range r.Files {
+		lines := formatLineRanges(f.Lines)
+		if lines == "" {
+			lines = "-"
+		}
+		rows[i] = fmt.Sprintf("| %s | %d | %s | %s |", renderFileName(f.Path, pullUrl), f.UncoveredLines, formatPercentage(f.Coverage), lines)
+	}
+
+	details := `<details>
+<summary>%d file(s) with uncovered new lines</summary>
+
+| File | Uncovered new lines | Coverage on new code | Lines |
+| -------- | -------- | -------- | -------- |
+%s
+%s
+</details>`
+
+	omitted := ""
+	if r.Omitted != 0 {
+		omitted = fmt.Sprintf("\n_... and %d more file(s)._\n", r.Omitted)
+	}
+
+	message = append(message, fmt.Sprintf(details, len(r.Files)+r.Omitted, strings.Join(rows, "\n"), omitted))
+
+	return strings.Join(message, "\n\n")
+}
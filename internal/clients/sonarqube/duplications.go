@@ -0,0 +1,162 @@
+package sonarqube
+
+import (
+	"fmt"
+	"strings"
+)
+
+type DuplicationBlock struct {
+	From int    `json:"from"`
+	Size int    `json:"size"`
+	Ref  string `json:"_ref"`
+}
+
+type Duplication struct {
+	Blocks []DuplicationBlock `json:"blocks"`
+}
+
+type DuplicationFile struct {
+	Key     string `json:"key"`
+	Name    string `json:"name"`
+	Project string `json:"project"`
+}
+
+type DuplicationsResponse struct {
+	Duplications []Duplication              `json:"duplications"`
+	Files        map[string]DuplicationFile `json:"files"`
+	Errors       []Error                    `json:"errors"`
+}
+
+type DuplicationLocation struct {
+	Path string
+	From int
+	To   int
+	// External marks locations outside of the analysed project which cannot be linked to the repository.
+	External bool
+}
+
+type DuplicatedFile struct {
+	Path            string
+	DuplicatedLines int
+	// Blocks contains pairs of locations. The first entry is the block inside the file, the second one the
+	// original it duplicates.
+	Blocks [][2]DuplicationLocation
+}
+
+type DuplicationReport struct {
+	Density string
+	Files   []DuplicatedFile
+	// Omitted is the number of files with new duplicated lines that did not make it into Files due to the limit.
+	Omitted int
+}
+
+// NewDuplicationReport picks the files with new duplicated lines out of the component tree, sorted worst first
+// and capped at maxFiles. A non-positive maxFiles disables the cap.
+func NewDuplicationReport(tree *ComponentTreeResponse, maxFiles int) *DuplicationReport {
+	report := &DuplicationReport{}
+	report.Density, _ = tree.BaseComponent.Measure("new_duplicated_lines_density")
+
+	var files []rankedComponent
+	files, report.Omitted = tree.worstComponents("new_duplicated_lines", maxFiles)
+	for _, c := range files {
+		report.Files = append(report.Files, DuplicatedFile{
+			Path:            c.Path,
+			DuplicatedLines: c.Value,
+		})
+	}
+
+	return report
+}
+
+func (r *DuplicationsResponse) location(project string, block DuplicationBlock) DuplicationLocation {
+	l := DuplicationLocation{
+		From: block.From,
+		To:   block.From + block.Size - 1,
+	}
+
+	f, ok := r.Files[block.Ref]
+	if !ok {
+		l.External = true
+		return l
+	}
+
+	prefix := fmt.Sprintf("%s:", project)
+	if (f.Project != "" && f.Project != project) || !strings.HasPrefix(f.Key, prefix) {
+		l.Path = f.Name
+		l.External = true
+		return l
+	}
+
+	l.Path = strings.TrimPrefix(f.Key, prefix)
+	return l
+}
+
+// Blocks pairs the first block of each duplication, which belongs to the requested file, with every other block
+// of that duplication.
+func (r *DuplicationsResponse) Blocks(project string) [][2]DuplicationLocation {
+	pairs := [][2]DuplicationLocation{}
+	for _, d := range r.Duplications {
+		if len(d.Blocks) < 2 {
+			continue
+		}
+		own := r.location(project, d.Blocks[0])
+		for _, b := range d.Blocks[1:] {
+			pairs = append(pairs, [2]DuplicationLocation{own, r.location(project, b)})
+		}
+	}
+	return pairs
+}
+
+// render links the location to the Gitea source view located at sourceUrl if available.
+func (l DuplicationLocation) render(sourceUrl string) string {
+	text := fmt.Sprintf("%s#L%d-L%d", l.Path, l.From, l.To)
+	if l.External || sourceUrl == "" {
+		return fmt.Sprintf("`%s`", text)
+	}
+	return fmt.Sprintf("[%s](%s/%s#L%d-L%d)", text, sourceUrl, l.Path, l.From, l.To)
+}
+
+// GetRenderedMarkdown renders the report as collapsible section. File names link to the diff of the Gitea pull
+// request located at pullUrl, duplicated blocks to the Gitea source view located at sourceUrl.
+func (r *DuplicationReport) GetRenderedMarkdown(pullUrl string, sourceUrl string) string {
+	message := []string{
+		"#### Duplications",
+		fmt.Sprintf("**Duplicated lines on new code**: %s", formatPercentage(r.Density)),
+	}
+
+	if len(r.Files) == 0 {
+		message = append(message, ":white_check_mark: No new duplicated lines.")
+		return strings.Join(message, "\n\n")
+	}
+
+	rows := make([]string, len(r.Files))
+	for i, f := range r.Files {
+		blocks := make([]string, len(f.Blocks))
+		for j, b := range f.Blocks {
+			blocks[j] = fmt.Sprintf("%s duplicates %s", b[0].render(sourceUrl), b[1].render(sourceUrl))
+		}
+		rendered := strings.Join(blocks, "<br>")
+		if rendered == "" {
+			rendered = "-"
+		}
+		rows[i] = fmt.Sprintf("| %s | %d | %s |", renderFileName(f.Path, pullUrl), f.DuplicatedLines, rendered)
+	}
+
+	details := `<details>
+<summary>%d file(s) with new duplicated lines</summary>
+
+| File | New duplicated lines | Duplicated blocks |
+| -------- | -------- | -------- |
+%s
+%s
+</details>`
+
+	omitted := ""
+	if r.Omitted != 0 {
+		omitted = fmt.Sprintf("\n_... and %d more file(s)._\n", r.Omitted)
+	}
+
+	message = append(message, fmt.Sprintf(details, len(r.Files)+r.Omitted, strings.Join(rows, "\n"), omitted))
+
+	return strings.Join(message, "\n\n")
+}
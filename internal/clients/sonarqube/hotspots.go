@@ -0,0 +1,108 @@
+package sonarqube
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// linkTextEscaper keeps hotspot messages from breaking the table cell or the link they are rendered into.
+var linkTextEscaper = strings.NewReplacer("|", `\|`, "[", `\[`, "]", `\]`)
+
+type Hotspot struct {
+	Key                      string `json:"key"`
+	Component                string `json:"component"`
+	SecurityCategory         string `json:"securityCategory"`
+	VulnerabilityProbability string `json:"vulnerabilityProbability"`
+	Status                   string `json:"status"`
+	Line                     int    `json:"line"`
+	Message                  string `json:"message"`
+}
+
+type HotspotsComponent struct {
+	Key  string `json:"key"`
+	Path string `json:"path"`
+}
+
+type HotspotsResponse struct {
+	Paging     Paging              `json:"paging"`
+	Hotspots   []Hotspot           `json:"hotspots"`
+	Components []HotspotsComponent `json:"components"`
+	Errors     []Error             `json:"errors"`
+}
+
+func (hr *HotspotsResponse) getPaging() Paging {
+	return hr.Paging
+}
+
+func (hr *HotspotsResponse) getErrors() []Error {
+	return hr.Errors
+}
+
+var hotspotProbabilityOrder = map[string]int{
+	"HIGH":   0,
+	"MEDIUM": 1,
+	"LOW":    2,
+}
+
+func hotspotProbabilityRank(probability string) int {
+	if rank, ok := hotspotProbabilityOrder[probability]; ok {
+		return rank
+	}
+	return len(hotspotProbabilityOrder)
+}
+
+func (hr *HotspotsResponse) location(h Hotspot) string {
+	path := h.Component
+	for _, c := range hr.Components {
+		if c.Key == h.Component {
+			path = c.Path
+			break
+		}
+	}
+
+	if h.Line == 0 {
+		return path
+	}
+	return fmt.Sprintf("%s:%d", path, h.Line)
+}
+
+// GetRenderedMarkdown renders the hotspots that still need a review, ordered by vulnerability probability and
+// security category. Each hotspot links to its review page inside SonarQube.
+func (hr *HotspotsResponse) GetRenderedMarkdown(baseUrl string, project string, prName string) string {
+	hotspots := []Hotspot{}
+	for _, h := range hr.Hotspots {
+		if h.Status == "" || h.Status == "TO_REVIEW" {
+			hotspots = append(hotspots, h)
+		}
+	}
+
+	if len(hotspots) == 0 {
+		return "#### Security Hotspots\n\n:white_check_mark: No security hotspots to review."
+	}
+
+	sort.SliceStable(hotspots, func(i, j int) bool {
+		ri, rj := hotspotProbabilityRank(hotspots[i].VulnerabilityProbability), hotspotProbabilityRank(hotspots[j].VulnerabilityProbability)
+		if ri != rj {
+			return ri < rj
+		}
+		return hotspots[i].SecurityCategory < hotspots[j].SecurityCategory
+	})
+
+	rows := make([]string, len(hotspots))
+	for i, h := range hotspots {
+		link := fmt.Sprintf("%s/security_hotspots?id=%s&pullRequest=%s&hotspots=%s", baseUrl, url.QueryEscape(project), url.QueryEscape(prName), url.QueryEscape(h.Key))
+		rows[i] = fmt.Sprintf("| %s | %s | [%s](%s) | `%s` |", h.VulnerabilityProbability, h.SecurityCategory, linkTextEscaper.Replace(h.Message), link, hr.location(h))
+	}
+
+	table := `#### Security Hotspots
+
+:warning: %d security hotspot(s) to review.
+
+| Probability | Category | Hotspot | Location |
+| -------- | -------- | -------- | -------- |
+%s`
+
+	return fmt.Sprintf(table, len(hotspots), strings.Join(rows, "\n"))
+}
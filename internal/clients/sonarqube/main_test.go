@@ -5,6 +5,8 @@ import (
 	"log"
 	"os"
 	"testing"
+
+	"codeberg.org/justusbunsi/gitea-sonarqube-bot/internal/settings"
 )
 
 // SETUP: mute logs
@@ -12,3 +14,7 @@ func TestMain(m *testing.M) {
 	log.SetOutput(ioutil.Discard)
 	os.Exit(m.Run())
 }
+
+func fixedSettings(c *settings.SonarQubeConfig) func() *settings.SonarQubeConfig {
+	return func() *settings.SonarQubeConfig { return c }
+}
@@ -3,6 +3,8 @@ package sonarqube
 import (
 	"fmt"
 	"strings"
+
+	"codeberg.org/justusbunsi/gitea-sonarqube-bot/internal/settings"
 )
 
 type period struct {
@@ -31,24 +33,65 @@ type MeasuresResponse struct {
 	Errors    []Error                   `json:"errors"`
 }
 
-func (mr *MeasuresResponse) GetRenderedMarkdownTable() string {
-	metricsTranslations := map[string]string{}
+func (mr *MeasuresResponse) metricsTranslations() map[string]string {
+	translations := map[string]string{}
 	for _, metric := range mr.Metrics {
-		metricsTranslations[metric.Key] = metric.Name
+		translations[metric.Key] = metric.Name
 	}
-	measures := make([]string, len(mr.Component.Measures))
-	for i, measure := range mr.Component.Measures {
-		value := measure.Value
-		if measure.Period != nil {
-			value = measure.Period.Value
-		}
-		measures[i] = fmt.Sprintf("| %s | %s |", metricsTranslations[measure.Metric], value)
+	return translations
+}
+
+func (m *MeasuresComponentMeasure) currentValue() string {
+	if m.Period != nil {
+		return m.Period.Value
 	}
+	return m.Value
+}
 
+func renderMarkdownTable(rows []string) string {
 	table := `
 | Metric | Current |
 | -------- | -------- |
 %s`
 
-	return fmt.Sprintf(table, strings.Join(measures, "\n"))
+	return fmt.Sprintf(table, strings.Join(rows, "\n"))
+}
+
+// GetRenderedMarkdownGroups renders one table per metric group. Rows follow the configured metric order and
+// metrics that are missing in the response are skipped. Named groups get a heading, groups without any
+// measure are omitted entirely.
+func (mr *MeasuresResponse) GetRenderedMarkdownGroups(groups []settings.MetricGroup) string {
+	metricsTranslations := mr.metricsTranslations()
+	values := map[string]string{}
+	for _, measure := range mr.Component.Measures {
+		values[measure.Metric] = measure.currentValue()
+	}
+
+	sections := []string{}
+	for _, group := range groups {
+		rows := []string{}
+		for _, key := range group.Metrics {
+			value, ok := values[key]
+			if !ok {
+				continue
+			}
+			name, ok := metricsTranslations[key]
+			if !ok {
+				name = key
+			}
+			rows = append(rows, fmt.Sprintf("| %s | %s |", name, value))
+		}
+
+		if len(rows) == 0 {
+			continue
+		}
+
+		section := renderMarkdownTable(rows)
+		if group.Name != "" {
+			section = fmt.Sprintf("#### %s\n%s", group.Name, section)
+		}
+		sections = append(sections, section)
+	}
+
+	return strings.Join(sections, "\n\n")
 }
@@ -0,0 +1,64 @@
+package sonarqube
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+)
+
+const (
+	// DefaultPageSize is the page size requested from paginated SonarQube APIs. It is the maximum most of them accept.
+	DefaultPageSize = 500
+	// maxPagedResults is the hard limit of SonarQube search APIs. Requesting pages beyond results in errors.
+	maxPagedResults = 10000
+)
+
+type Paging struct {
+	PageIndex int `json:"pageIndex"`
+	PageSize  int `json:"pageSize"`
+	Total     int `json:"total"`
+}
+
+type pagedResponse interface {
+	getPaging() Paging
+	getErrors() []Error
+}
+
+// retrievePagedDataFromApi requests all pages of the given SonarQube API url using the `p` and `ps` query
+// parameters. Every decoded page is handed over to collect. Requesting stops as soon as all items are received or
+// the result limit of SonarQube is reached. APIs without paging information in their response are requested once.
+func retrievePagedDataFromApi[T any, PT interface {
+	*T
+	pagedResponse
+}](ctx context.Context, sdk *SonarQubeSdk, url string, collect func(PT)) error {
+	for page := 1; ; page++ {
+		request, err := sdk.httpRequest(ctx, http.MethodGet, fmt.Sprintf("%s&p=%d&ps=%d", url, page, DefaultPageSize), nil)
+		if err != nil {
+			return err
+		}
+
+		response := PT(new(T))
+		err = retrieveDataFromApi(sdk, request, response)
+		if err != nil {
+			return err
+		}
+
+		if apiErrors := response.getErrors(); len(apiErrors) != 0 {
+			return fmt.Errorf("%s", apiErrors[0].Message)
+		}
+
+		collect(response)
+
+		// SonarQube may clamp the requested page size, so the returned one is decisive
+		paging := response.getPaging()
+		received := page * paging.PageSize
+		if paging.PageSize <= 0 || paging.Total <= received {
+			return nil
+		}
+		if received >= maxPagedResults {
+			slog.WarnContext(ctx, "SonarQube result limit reached, ignoring remaining results", "url", url, "received", received, "total", paging.Total)
+			return nil
+		}
+	}
+}
@@ -5,13 +5,23 @@ type PullRequest struct {
 	Status struct {
 		QualityGateStatus string `json:"qualityGateStatus"`
 	} `json:"status"`
+	AnalysisDate string `json:"analysisDate"`
 }
 
 type PullsResponse struct {
+	Paging       Paging        `json:"paging"`
 	PullRequests []PullRequest `json:"pullRequests"`
 	Errors       []Error       `json:"errors"`
 }
 
+func (r *PullsResponse) getPaging() Paging {
+	return r.Paging
+}
+
+func (r *PullsResponse) getErrors() []Error {
+	return r.Errors
+}
+
 func (r *PullsResponse) GetPullRequest(name string) *PullRequest {
 	for _, pr := range r.PullRequests {
 		if pr.Key == name {
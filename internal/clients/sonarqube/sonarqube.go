@@ -1,30 +1,36 @@
 package sonarqube
 
 import (
+	"context"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
-	"log"
+	"log/slog"
 	"net/http"
 	"strconv"
 	"strings"
 
 	"codeberg.org/justusbunsi/gitea-sonarqube-bot/internal/actions"
+	"codeberg.org/justusbunsi/gitea-sonarqube-bot/internal/clients/httpclient"
 	"codeberg.org/justusbunsi/gitea-sonarqube-bot/internal/settings"
+	"codeberg.org/justusbunsi/gitea-sonarqube-bot/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 func ParsePRIndex(name string) (int, error) {
-	res := settings.Pattern.RegExp.FindSubmatch([]byte(name))
+	res := settings.Current().Pattern.RegExp.FindSubmatch([]byte(name))
 	if len(res) != 2 {
-		return 0, fmt.Errorf("branch name '%s' does not match regex '%s'", name, settings.Pattern.RegExp.String())
+		return 0, fmt.Errorf("branch name '%s' does not match regex '%s'", name, settings.Current().Pattern.RegExp.String())
 	}
 
 	return strconv.Atoi(string(res[1]))
 }
 
 func PRNameFromIndex(index int64) string {
-	return fmt.Sprintf(settings.Pattern.Template, index)
+	return fmt.Sprintf(settings.Current().Pattern.Template, index)
 }
 
 func GetRenderedQualityGate(qg string) string {
@@ -36,6 +42,9 @@ func GetRenderedQualityGate(qg string) string {
 	return fmt.Sprintf("**Quality Gate**: %s", status)
 }
 
+// DefaultMaxResponseSize limits the number of bytes read from a single SonarQube API response.
+const DefaultMaxResponseSize int64 = 10 << 20
+
 func retrieveDataFromApi(sdk *SonarQubeSdk, request *http.Request, wrapper interface{}) error {
 	request.Header.Add("Authorization", sdk.basicAuth())
 	rawResponse, err := sdk.client.Do(request)
@@ -43,19 +52,36 @@ func retrieveDataFromApi(sdk *SonarQubeSdk, request *http.Request, wrapper inter
 		return err
 	}
 
+	if rawResponse.Body != nil {
+		defer rawResponse.Body.Close()
+	}
+
 	if rawResponse.StatusCode == http.StatusUnauthorized {
 		return fmt.Errorf("missing or invalid API token")
 	}
 
-	if rawResponse.Body != nil {
-		defer rawResponse.Body.Close()
+	limit := sdk.maxResponseSize
+	if limit <= 0 {
+		limit = DefaultMaxResponseSize
 	}
 
-	body, err := sdk.bodyReader(rawResponse.Body)
+	body, err := sdk.bodyReader(io.LimitReader(rawResponse.Body, limit+1))
 	if err != nil {
 		return err
 	}
 
+	if int64(len(body)) > limit {
+		return fmt.Errorf("response exceeds maximum size of %d bytes", limit)
+	}
+
+	if rawResponse.StatusCode < 200 || rawResponse.StatusCode > 299 {
+		return newApiError(rawResponse.StatusCode, body)
+	}
+
+	if wrapper == nil {
+		return nil
+	}
+
 	err = json.Unmarshal(body, wrapper)
 	if err != nil {
 		return err
@@ -68,18 +94,67 @@ type Error struct {
 	Message string `json:"msg"`
 }
 
+// ApiError is returned for non-2xx responses. It carries the messages SonarQube sends in its error JSON.
+type ApiError struct {
+	StatusCode int
+	Messages   []string
+}
+
+func (e *ApiError) Error() string {
+	if len(e.Messages) == 0 {
+		return fmt.Sprintf("request failed with status %d: %s", e.StatusCode, http.StatusText(e.StatusCode))
+	}
+	return fmt.Sprintf("request failed with status %d: %s", e.StatusCode, strings.Join(e.Messages, "; "))
+}
+
+func newApiError(statusCode int, body []byte) *ApiError {
+	e := &ApiError{
+		StatusCode: statusCode,
+	}
+
+	response := struct {
+		Errors []Error `json:"errors"`
+	}{}
+	if json.Unmarshal(body, &response) == nil {
+		for _, err := range response.Errors {
+			e.Messages = append(e.Messages, err.Message)
+		}
+	}
+
+	return e
+}
+
 type SonarQubeSdkInterface interface {
-	GetMeasures(string, string) (*MeasuresResponse, error)
+	GetMeasures(context.Context, string, string, []string) (*MeasuresResponse, error)
+	GetHotspots(context.Context, string, string) (*HotspotsResponse, error)
+	GetComponentTree(context.Context, string, string, []string) (*ComponentTreeResponse, error)
+	GetSourceLines(context.Context, string, string) (*SourceLinesResponse, error)
+	GetDuplications(context.Context, string, string) (*DuplicationsResponse, error)
 	GetPullRequestUrl(string, int64) string
-	GetPullRequest(string, int64) (*PullRequest, error)
-	ComposeGiteaComment(*CommentComposeData) (string, error)
+	GetPullRequest(context.Context, string, int64) (*PullRequest, error)
+	ListPullRequests(context.Context, string) ([]PullRequest, error)
+	ComposeGiteaComment(context.Context, *CommentComposeData) (string, error)
+	ValidateToken(context.Context) error
+	CheckProject(context.Context, string) error
+	GetSystemStatus(context.Context) (string, error)
+	ListWebhooks(context.Context, string) ([]Webhook, error)
+	CreateWebhook(context.Context, string, Webhook, string) error
+	UpdateWebhook(context.Context, Webhook, string) error
 }
 
 type CommentComposeData struct {
-	Key         string
-	PRName      string
-	Url         string
-	QualityGate string
+	Key          string
+	PRName       string
+	Url          string
+	QualityGate  string
+	Metrics      []settings.MetricGroup
+	Hotspots     settings.HotspotsConfig
+	Coverage     settings.CoverageConfig
+	Duplications settings.DuplicationsConfig
+	// Gitea pull request URL used for linking files in the diff view
+	PullRequestUrl string
+	// Gitea source view URL of the analysed commit used for linking code locations
+	SourceUrl string
 }
 
 type ClientInterface interface {
@@ -87,41 +162,38 @@ type ClientInterface interface {
 }
 
 type BodyReader func(io.Reader) ([]byte, error)
-type HttpRequest func(method string, target string, body io.Reader) (*http.Request, error)
+type HttpRequest func(ctx context.Context, method string, target string, body io.Reader) (*http.Request, error)
 
 type SonarQubeSdk struct {
 	client      ClientInterface
 	bodyReader  BodyReader
 	httpRequest HttpRequest
-	settings    *settings.SonarQubeConfig
+	// settings returns the configuration in use, so reloaded URLs and refreshed tokens apply to the next request
+	settings        func() *settings.SonarQubeConfig
+	maxResponseSize int64
 }
 
 func (sdk *SonarQubeSdk) GetPullRequestUrl(project string, index int64) string {
-	return fmt.Sprintf("%s/dashboard?id=%s&pullRequest=%s", sdk.settings.Url, project, PRNameFromIndex(index))
+	return fmt.Sprintf("%s/dashboard?id=%s&pullRequest=%s", sdk.settings().Url, project, PRNameFromIndex(index))
 }
 
-func (sdk *SonarQubeSdk) fetchPullRequests(project string) (*PullsResponse, error) {
-	url := fmt.Sprintf("%s/api/project_pull_requests/list?project=%s", sdk.settings.Url, project)
-	request, err := sdk.httpRequest(http.MethodGet, url, nil)
-	if err != nil {
-		return nil, err
-	}
+func (sdk *SonarQubeSdk) fetchPullRequests(ctx context.Context, project string) (*PullsResponse, error) {
+	url := fmt.Sprintf("%s/api/project_pull_requests/list?project=%s", sdk.settings().Url, project)
 
 	response := &PullsResponse{}
-	err = retrieveDataFromApi(sdk, request, response)
+	err := retrievePagedDataFromApi(ctx, sdk, url, func(page *PullsResponse) {
+		response.PullRequests = append(response.PullRequests, page.PullRequests...)
+		response.Paging = page.Paging
+	})
 	if err != nil {
 		return nil, err
 	}
 
-	if len(response.Errors) != 0 {
-		return nil, fmt.Errorf("%s", response.Errors[0].Message)
-	}
-
 	return response, nil
 }
 
-func (sdk *SonarQubeSdk) GetPullRequest(project string, index int64) (*PullRequest, error) {
-	response, err := sdk.fetchPullRequests(project)
+func (sdk *SonarQubeSdk) GetPullRequest(ctx context.Context, project string, index int64) (*PullRequest, error) {
+	response, err := sdk.fetchPullRequests(ctx, project)
 	if err != nil {
 		return nil, fmt.Errorf("fetching pull requests failed: %w", err)
 	}
@@ -135,9 +207,24 @@ func (sdk *SonarQubeSdk) GetPullRequest(project string, index int64) (*PullReque
 	return pr, nil
 }
 
-func (sdk *SonarQubeSdk) GetMeasures(project string, branch string) (*MeasuresResponse, error) {
-	url := fmt.Sprintf("%s/api/measures/component?additionalFields=metrics&metricKeys=%s&component=%s&pullRequest=%s", sdk.settings.Url, settings.SonarQube.GetMetricsList(), project, branch)
-	request, err := sdk.httpRequest(http.MethodGet, url, nil)
+// ListPullRequests returns all analysed pull requests of the project.
+func (sdk *SonarQubeSdk) ListPullRequests(ctx context.Context, project string) ([]PullRequest, error) {
+	response, err := sdk.fetchPullRequests(ctx, project)
+	if err != nil {
+		return nil, fmt.Errorf("fetching pull requests failed: %w", err)
+	}
+
+	return response.PullRequests, nil
+}
+
+func (sdk *SonarQubeSdk) GetMeasures(ctx context.Context, project string, branch string, metrics []string) (*MeasuresResponse, error) {
+	metricKeys := settings.Current().SonarQube.GetMetricsList()
+	if len(metrics) != 0 {
+		metricKeys = strings.Join(metrics, ",")
+	}
+
+	url := fmt.Sprintf("%s/api/measures/component?additionalFields=metrics&metricKeys=%s&component=%s&pullRequest=%s", sdk.settings().Url, metricKeys, project, branch)
+	request, err := sdk.httpRequest(ctx, http.MethodGet, url, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -155,33 +242,263 @@ func (sdk *SonarQubeSdk) GetMeasures(project string, branch string) (*MeasuresRe
 	return response, nil
 }
 
-func (sdk *SonarQubeSdk) ComposeGiteaComment(data *CommentComposeData) (string, error) {
-	m, err := sdk.GetMeasures(data.Key, data.PRName)
+func (sdk *SonarQubeSdk) GetHotspots(ctx context.Context, project string, branch string) (*HotspotsResponse, error) {
+	url := fmt.Sprintf("%s/api/hotspots/search?projectKey=%s&pullRequest=%s&status=TO_REVIEW", sdk.settings().Url, project, branch)
+
+	response := &HotspotsResponse{}
+	err := retrievePagedDataFromApi(ctx, sdk, url, func(page *HotspotsResponse) {
+		response.Hotspots = append(response.Hotspots, page.Hotspots...)
+		response.Components = append(response.Components, page.Components...)
+		response.Paging = page.Paging
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return response, nil
+}
+
+func (sdk *SonarQubeSdk) GetComponentTree(ctx context.Context, project string, branch string, metrics []string) (*ComponentTreeResponse, error) {
+	url := fmt.Sprintf("%s/api/measures/component_tree?component=%s&pullRequest=%s&metricKeys=%s&qualifiers=FIL&strategy=leaves", sdk.settings().Url, project, branch, strings.Join(metrics, ","))
+
+	response := &ComponentTreeResponse{}
+	err := retrievePagedDataFromApi(ctx, sdk, url, func(page *ComponentTreeResponse) {
+		response.BaseComponent = page.BaseComponent
+		response.Components = append(response.Components, page.Components...)
+		response.Paging = page.Paging
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return response, nil
+}
+
+func (sdk *SonarQubeSdk) GetSourceLines(ctx context.Context, component string, branch string) (*SourceLinesResponse, error) {
+	url := fmt.Sprintf("%s/api/sources/lines?key=%s&pullRequest=%s", sdk.settings().Url, component, branch)
+	request, err := sdk.httpRequest(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	response := &SourceLinesResponse{}
+	err = retrieveDataFromApi(sdk, request, response)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(response.Errors) != 0 {
+		return nil, fmt.Errorf("%s", response.Errors[0].Message)
+	}
+
+	return response, nil
+}
+
+func (sdk *SonarQubeSdk) GetDuplications(ctx context.Context, component string, branch string) (*DuplicationsResponse, error) {
+	url := fmt.Sprintf("%s/api/duplications/show?key=%s&pullRequest=%s", sdk.settings().Url, component, branch)
+	request, err := sdk.httpRequest(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	response := &DuplicationsResponse{}
+	err = retrieveDataFromApi(sdk, request, response)
 	if err != nil {
-		log.Printf("Error composing Gitea comment: %s", err.Error())
+		return nil, err
+	}
+
+	if len(response.Errors) != 0 {
+		return nil, fmt.Errorf("%s", response.Errors[0].Message)
+	}
+
+	return response, nil
+}
+
+func (sdk *SonarQubeSdk) composeDuplicationReport(ctx context.Context, data *CommentComposeData) (*DuplicationReport, error) {
+	tree, err := sdk.GetComponentTree(ctx, data.Key, data.PRName, []string{"new_duplicated_lines_density", "new_duplicated_lines"})
+	if err != nil {
+		return nil, err
+	}
+
+	report := NewDuplicationReport(tree, data.Duplications.MaxFiles)
+	for i, f := range report.Files {
+		duplications, err := sdk.GetDuplications(ctx, fmt.Sprintf("%s:%s", data.Key, f.Path), data.PRName)
+		if err != nil {
+			// Block details are optional. The file is still listed with its number of duplicated lines.
+			slog.WarnContext(ctx, "Error loading duplications", "file", f.Path, "error", err)
+			continue
+		}
+		report.Files[i].Blocks = duplications.Blocks(data.Key)
+	}
+
+	return report, nil
+}
+
+func (sdk *SonarQubeSdk) composeCoverageReport(ctx context.Context, data *CommentComposeData) (*CoverageReport, error) {
+	tree, err := sdk.GetComponentTree(ctx, data.Key, data.PRName, []string{"new_coverage", "new_uncovered_lines"})
+	if err != nil {
+		return nil, err
+	}
+
+	report := NewCoverageReport(tree, data.Coverage.MaxFiles)
+	for i, f := range report.Files {
+		lines, err := sdk.GetSourceLines(ctx, fmt.Sprintf("%s:%s", data.Key, f.Path), data.PRName)
+		if err != nil {
+			// Line details are optional. The file is still listed with its number of uncovered lines.
+			slog.WarnContext(ctx, "Error loading source lines", "file", f.Path, "error", err)
+			continue
+		}
+		report.Files[i].Lines = lines.UncoveredNewLines()
+	}
+
+	return report, nil
+}
+
+func (sdk *SonarQubeSdk) ComposeGiteaComment(ctx context.Context, data *CommentComposeData) (comment string, err error) {
+	ctx, span := tracing.Start(ctx, "sonarqube.ComposeGiteaComment", trace.WithAttributes(
+		attribute.String("sonarqube.project", data.Key),
+		attribute.String("sonarqube.pull_request", data.PRName),
+	))
+	defer func() { tracing.End(span, err) }()
+
+	groups := data.Metrics
+	if len(groups) == 0 {
+		groups = settings.Current().SonarQube.GetMetricGroups(nil)
+	}
+
+	m, err := sdk.GetMeasures(ctx, data.Key, data.PRName, settings.MetricKeys(groups))
+	if err != nil {
+		slog.ErrorContext(ctx, "Error composing Gitea comment", "error", err)
 		return "", err
 	}
 
-	message := make([]string, 5)
-	message[0] = GetRenderedQualityGate(data.QualityGate)
-	message[1] = m.GetRenderedMarkdownTable()
-	message[2] = fmt.Sprintf(`See <a href="%s" target="_blank" rel="nofollow">SonarQube</a> for details.`, data.Url)
-	message[3] = "---"
-	message[4] = fmt.Sprintf("- If you want the bot to check again, post `%s`", actions.ActionReview)
+	message := []string{
+		GetRenderedQualityGate(data.QualityGate),
+		m.GetRenderedMarkdownGroups(groups),
+	}
+
+	if data.Coverage.Enabled {
+		c, err := sdk.composeCoverageReport(ctx, data)
+		if err != nil {
+			slog.ErrorContext(ctx, "Error composing Gitea comment", "error", err)
+			return "", err
+		}
+		message = append(message, c.GetRenderedMarkdown(data.PullRequestUrl))
+	}
+
+	if data.Duplications.Enabled {
+		d, err := sdk.composeDuplicationReport(ctx, data)
+		if err != nil {
+			slog.ErrorContext(ctx, "Error composing Gitea comment", "error", err)
+			return "", err
+		}
+		message = append(message, d.GetRenderedMarkdown(data.PullRequestUrl, data.SourceUrl))
+	}
+
+	if data.Hotspots.Enabled {
+		h, err := sdk.GetHotspots(ctx, data.Key, data.PRName)
+		if err != nil {
+			slog.ErrorContext(ctx, "Error composing Gitea comment", "error", err)
+			return "", err
+		}
+		message = append(message, h.GetRenderedMarkdown(sdk.settings().Url, data.Key, data.PRName))
+	}
+
+	message = append(message,
+		fmt.Sprintf(`See <a href="%s" target="_blank" rel="nofollow">SonarQube</a> for details.`, data.Url),
+		"---",
+		fmt.Sprintf("- If you want the bot to check again, post `%s`", actions.ActionReview),
+	)
 
 	return strings.Join(message, "\n\n"), nil
 }
 
+// ValidateToken verifies that SonarQube accepts the configured token.
+func (sdk *SonarQubeSdk) ValidateToken(ctx context.Context) error {
+	url := fmt.Sprintf("%s/api/authentication/validate", sdk.settings().Url)
+	request, err := sdk.httpRequest(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+
+	response := &struct {
+		Valid bool `json:"valid"`
+	}{}
+	err = retrieveDataFromApi(sdk, request, response)
+	if err != nil {
+		return err
+	}
+
+	if !response.Valid {
+		return fmt.Errorf("missing or invalid API token")
+	}
+
+	return nil
+}
+
+// CheckProject verifies that the project exists and the token is allowed to browse it.
+func (sdk *SonarQubeSdk) CheckProject(ctx context.Context, project string) error {
+	url := fmt.Sprintf("%s/api/components/show?component=%s", sdk.settings().Url, project)
+	request, err := sdk.httpRequest(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+
+	response := &struct {
+		Errors []Error `json:"errors"`
+	}{}
+	err = retrieveDataFromApi(sdk, request, response)
+	if err != nil {
+		var apiErr *ApiError
+		if errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusForbidden {
+			return fmt.Errorf("missing \"Browse\" permission: %w", err)
+		}
+		return err
+	}
+
+	if len(response.Errors) != 0 {
+		return fmt.Errorf("%s", response.Errors[0].Message)
+	}
+
+	return nil
+}
+
+// GetSystemStatus returns the state of the SonarQube instance, e.g. "UP", "STARTING" or "DOWN".
+func (sdk *SonarQubeSdk) GetSystemStatus(ctx context.Context) (string, error) {
+	url := fmt.Sprintf("%s/api/system/status", sdk.settings().Url)
+	request, err := sdk.httpRequest(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return "", err
+	}
+
+	response := &struct {
+		Status string `json:"status"`
+	}{}
+	err = retrieveDataFromApi(sdk, request, response)
+	if err != nil {
+		return "", err
+	}
+
+	return response.Status, nil
+}
+
 func (sdk *SonarQubeSdk) basicAuth() string {
-	auth := []byte(fmt.Sprintf("%s:", sdk.settings.Token.Value))
+	auth := []byte(fmt.Sprintf("%s:", sdk.settings().Token.Value))
 	return fmt.Sprintf("Basic %s", base64.StdEncoding.EncodeToString(auth))
 }
 
-func New(configuration *settings.SonarQubeConfig) *SonarQubeSdk {
+// New creates a client for the configuration returned by configuration. HTTP settings are only read once.
+func New(configuration func() *settings.SonarQubeConfig) *SonarQubeSdk {
+	client, err := httpclient.New(configuration().Http)
+	if err != nil {
+		panic(fmt.Errorf("cannot initialize SonarQube client: %w", err))
+	}
+
 	return &SonarQubeSdk{
-		client:      &http.Client{},
-		bodyReader:  io.ReadAll,
-		httpRequest: http.NewRequest,
-		settings:    configuration,
+		client:          client,
+		bodyReader:      io.ReadAll,
+		httpRequest:     http.NewRequestWithContext,
+		settings:        configuration,
+		maxResponseSize: DefaultMaxResponseSize,
 	}
 }
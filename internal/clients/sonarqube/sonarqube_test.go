@@ -1,11 +1,13 @@
 package sonarqube
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"net/http"
 	"net/http/httptest"
 	"regexp"
+	"strings"
 	"testing"
 
 	"codeberg.org/justusbunsi/gitea-sonarqube-bot/internal/settings"
@@ -19,17 +21,23 @@ type ClientMock struct {
 }
 
 func (c *ClientMock) Do(req *http.Request) (*http.Response, error) {
-	c.handler.ServeHTTP(c.recoder, req)
+	// Without a predefined recorder, every request gets its own to support multiple API calls per test
+	recorder := c.recoder
+	if recorder == nil {
+		recorder = httptest.NewRecorder()
+	}
+
+	c.handler.ServeHTTP(recorder, req)
 
 	return &http.Response{
-		StatusCode: c.recoder.Code,
-		Body:       c.recoder.Result().Body,
+		StatusCode: recorder.Code,
+		Body:       recorder.Result().Body,
 	}, c.responseError
 }
 
 func TestParsePRIndex(t *testing.T) {
 	t.Run("Success", func(t *testing.T) {
-		settings.Pattern = &settings.PatternConfig{
+		settings.Current().Pattern = &settings.PatternConfig{
 			RegExp: regexp.MustCompile(`^PR-(\d+)$`),
 		}
 
@@ -37,12 +45,12 @@ func TestParsePRIndex(t *testing.T) {
 		assert.Equal(t, 1337, actual, "PR index parsing is broken")
 
 		t.Cleanup(func() {
-			settings.Pattern = nil
+			settings.Current().Pattern = nil
 		})
 	})
 
 	t.Run("No integer value", func(t *testing.T) {
-		settings.Pattern = &settings.PatternConfig{
+		settings.Current().Pattern = &settings.PatternConfig{
 			RegExp: regexp.MustCompile(`^PR-(\d+)$`),
 		}
 
@@ -50,20 +58,20 @@ func TestParsePRIndex(t *testing.T) {
 		assert.EqualErrorf(t, err, "branch name 'PR-invalid' does not match regex '^PR-(\\d+)$'", "Integer parsing succeeds unexpectedly")
 
 		t.Cleanup(func() {
-			settings.Pattern = nil
+			settings.Current().Pattern = nil
 		})
 	})
 }
 
 func TestPRNameFromIndex(t *testing.T) {
-	settings.Pattern = &settings.PatternConfig{
+	settings.Current().Pattern = &settings.PatternConfig{
 		Template: "PR-%d",
 	}
 
 	assert.Equal(t, "PR-1337", PRNameFromIndex(1337))
 
 	t.Cleanup(func() {
-		settings.Pattern = nil
+		settings.Current().Pattern = nil
 	})
 }
 
@@ -79,11 +87,11 @@ func TestGetRenderedQualityGate(t *testing.T) {
 
 func TestGetPullRequestUrl(t *testing.T) {
 	sdk := &SonarQubeSdk{
-		settings: &settings.SonarQubeConfig{
+		settings: fixedSettings(&settings.SonarQubeConfig{
 			Url: "https://sonarqube.example.com",
-		},
+		}),
 	}
-	settings.Pattern = &settings.PatternConfig{
+	settings.Current().Pattern = &settings.PatternConfig{
 		Template: "PR-%d",
 	}
 
@@ -91,7 +99,7 @@ func TestGetPullRequestUrl(t *testing.T) {
 	assert.Equal(t, "https://sonarqube.example.com/dashboard?id=test-project&pullRequest=PR-1337", actual, "PR Dashboard URL building broken")
 
 	t.Cleanup(func() {
-		settings.Pattern = nil
+		settings.Current().Pattern = nil
 	})
 }
 
@@ -101,11 +109,11 @@ func TestRetrieveDataFromApi(t *testing.T) {
 			w.Write([]byte(`{"pullRequests":[{"key":"PR-1","title":"pr-branch","branch":"pr-branch","base":"main","status":{"qualityGateStatus":"OK","bugs":0,"vulnerabilities":0,"codeSmells":0},"analysisDate":"2022-06-12T11:23:09+0000","target":"main"}]}`))
 		})
 		sdk := &SonarQubeSdk{
-			settings: &settings.SonarQubeConfig{
+			settings: fixedSettings(&settings.SonarQubeConfig{
 				Token: &settings.Token{
 					Value: "test-token",
 				},
-			},
+			}),
 			client: &ClientMock{
 				handler:       handler,
 				recoder:       httptest.NewRecorder(),
@@ -126,11 +134,11 @@ func TestRetrieveDataFromApi(t *testing.T) {
 	t.Run("Internal error", func(t *testing.T) {
 		expected := fmt.Errorf("This error indicates an error while performing the request")
 		sdk := &SonarQubeSdk{
-			settings: &settings.SonarQubeConfig{
+			settings: fixedSettings(&settings.SonarQubeConfig{
 				Token: &settings.Token{
 					Value: "test-token",
 				},
-			},
+			}),
 			client: &ClientMock{
 				handler:       http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}),
 				recoder:       httptest.NewRecorder(),
@@ -151,11 +159,11 @@ func TestRetrieveDataFromApi(t *testing.T) {
 			recorder.Code = http.StatusUnauthorized
 		})
 		sdk := &SonarQubeSdk{
-			settings: &settings.SonarQubeConfig{
+			settings: fixedSettings(&settings.SonarQubeConfig{
 				Token: &settings.Token{
 					Value: "simulated-invalid-token",
 				},
-			},
+			}),
 			client: &ClientMock{
 				handler:       handler,
 				recoder:       recorder,
@@ -170,17 +178,94 @@ func TestRetrieveDataFromApi(t *testing.T) {
 		assert.Errorf(t, err, "missing or invalid API token", "Undetected unauthorized error")
 	})
 
+	t.Run("Non-2xx status", func(t *testing.T) {
+		handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"errors":[{"msg":"Project 'test-project' not found"}]}`))
+		})
+		sdk := &SonarQubeSdk{
+			settings: fixedSettings(&settings.SonarQubeConfig{
+				Token: &settings.Token{
+					Value: "test-token",
+				},
+			}),
+			client: &ClientMock{
+				handler:       handler,
+				recoder:       httptest.NewRecorder(),
+				responseError: nil,
+			},
+			bodyReader: io.ReadAll,
+		}
+
+		request := httptest.NewRequest(http.MethodGet, "http://example.com", nil)
+		err := retrieveDataFromApi(sdk, request, &PullsResponse{})
+
+		var apiErr *ApiError
+		assert.ErrorAs(t, err, &apiErr, "Undetected non-2xx status")
+		assert.Equal(t, http.StatusNotFound, apiErr.StatusCode)
+		assert.EqualError(t, err, "request failed with status 404: Project 'test-project' not found")
+	})
+
+	t.Run("Server error without body", func(t *testing.T) {
+		handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusBadGateway)
+		})
+		sdk := &SonarQubeSdk{
+			settings: fixedSettings(&settings.SonarQubeConfig{
+				Token: &settings.Token{
+					Value: "test-token",
+				},
+			}),
+			client: &ClientMock{
+				handler:       handler,
+				recoder:       httptest.NewRecorder(),
+				responseError: nil,
+			},
+			bodyReader: io.ReadAll,
+		}
+
+		request := httptest.NewRequest(http.MethodGet, "http://example.com", nil)
+		err := retrieveDataFromApi(sdk, request, &PullsResponse{})
+
+		assert.EqualError(t, err, "request failed with status 502: Bad Gateway")
+	})
+
+	t.Run("Response too large", func(t *testing.T) {
+		handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(`{"pullRequests":[]}`))
+		})
+		sdk := &SonarQubeSdk{
+			settings: fixedSettings(&settings.SonarQubeConfig{
+				Token: &settings.Token{
+					Value: "test-token",
+				},
+			}),
+			client: &ClientMock{
+				handler:       handler,
+				recoder:       httptest.NewRecorder(),
+				responseError: nil,
+			},
+			bodyReader:      io.ReadAll,
+			maxResponseSize: 10,
+		}
+
+		request := httptest.NewRequest(http.MethodGet, "http://example.com", nil)
+		err := retrieveDataFromApi(sdk, request, &PullsResponse{})
+
+		assert.EqualError(t, err, "response exceeds maximum size of 10 bytes")
+	})
+
 	t.Run("Body read error", func(t *testing.T) {
 		handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			w.Write([]byte(`{"pullRequests":[{"key":"PR-1","title":"pr-branch","branch":"pr-branch","base":"main","status":{"qualityGateStatus":"OK","bugs":0,"vulnerabilities":0,"codeSmells":0},"analysisDate":"2022-06-12T11:23:09+0000","target":"main"}]}`))
 		})
 		expected := fmt.Errorf("Error reading body content")
 		sdk := &SonarQubeSdk{
-			settings: &settings.SonarQubeConfig{
+			settings: fixedSettings(&settings.SonarQubeConfig{
 				Token: &settings.Token{
 					Value: "test-token",
 				},
-			},
+			}),
 			client: &ClientMock{
 				handler:       handler,
 				recoder:       httptest.NewRecorder(),
@@ -202,11 +287,11 @@ func TestRetrieveDataFromApi(t *testing.T) {
 			w.Write([]byte(`{"pullReq`))
 		})
 		sdk := &SonarQubeSdk{
-			settings: &settings.SonarQubeConfig{
+			settings: fixedSettings(&settings.SonarQubeConfig{
 				Token: &settings.Token{
 					Value: "test-token",
 				},
-			},
+			}),
 			client: &ClientMock{
 				handler:       handler,
 				recoder:       httptest.NewRecorder(),
@@ -228,51 +313,82 @@ func TestFetchPullRequests(t *testing.T) {
 			w.Write([]byte(`{"pullRequests":[{"key":"PR-1","title":"pr-branch","branch":"pr-branch","base":"main","status":{"qualityGateStatus":"OK","bugs":0,"vulnerabilities":0,"codeSmells":0},"analysisDate":"2022-06-12T11:23:09+0000","target":"main"}]}`))
 		})
 		sdk := &SonarQubeSdk{
-			settings: &settings.SonarQubeConfig{
+			settings: fixedSettings(&settings.SonarQubeConfig{
 				Token: &settings.Token{
 					Value: "test-token",
 				},
-			},
+			}),
 			client: &ClientMock{
 				handler:       handler,
 				recoder:       httptest.NewRecorder(),
 				responseError: nil,
 			},
 			bodyReader: io.ReadAll,
-			httpRequest: func(method, target string, body io.Reader) (*http.Request, error) {
-				return httptest.NewRequest(method, target, body), nil
+			httpRequest: func(ctx context.Context, method, target string, body io.Reader) (*http.Request, error) {
+				return httptest.NewRequest(method, target, body).WithContext(ctx), nil
 			},
 		}
 
-		actual, err := sdk.fetchPullRequests("test-project")
+		actual, err := sdk.fetchPullRequests(context.Background(), "test-project")
 
 		assert.Nil(t, err, "Successful data retrieval broken and throws error")
 		assert.IsType(t, &PullsResponse{}, actual, "Happy path broken")
 	})
 
+	t.Run("Unpaged response", func(t *testing.T) {
+		requests := 0
+		handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requests++
+			w.Write([]byte(`{"pullRequests":[{"key":"PR-1","title":"pr-branch","branch":"pr-branch","base":"main","status":{"qualityGateStatus":"OK","bugs":0,"vulnerabilities":0,"codeSmells":0},"analysisDate":"2022-06-12T11:23:09+0000","target":"main"},{"key":"PR-2","title":"other-branch","branch":"other-branch","base":"main","status":{"qualityGateStatus":"ERROR","bugs":1,"vulnerabilities":0,"codeSmells":0},"analysisDate":"2022-06-13T08:01:44+0000","target":"main"}]}`))
+		})
+		sdk := &SonarQubeSdk{
+			settings: fixedSettings(&settings.SonarQubeConfig{
+				Token: &settings.Token{
+					Value: "test-token",
+				},
+			}),
+			client: &ClientMock{
+				handler:       handler,
+				recoder:       nil,
+				responseError: nil,
+			},
+			bodyReader: io.ReadAll,
+			httpRequest: func(ctx context.Context, method, target string, body io.Reader) (*http.Request, error) {
+				return httptest.NewRequest(method, target, body).WithContext(ctx), nil
+			},
+		}
+
+		actual, err := sdk.fetchPullRequests(context.Background(), "test-project")
+
+		assert.Nil(t, err)
+		assert.Equal(t, 1, requests, "Response without paging information requested again")
+		assert.Len(t, actual.PullRequests, 2)
+		assert.NotNil(t, actual.GetPullRequest("PR-2"))
+	})
+
 	t.Run("Building failure", func(t *testing.T) {
 		handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			w.Write([]byte(`{"pullRequests":[{"key":"PR-1","title":"pr-branch","branch":"pr-branch","base":"main","status":{"qualityGateStatus":"OK","bugs":0,"vulnerabilities":0,"codeSmells":0},"analysisDate":"2022-06-12T11:23:09+0000","target":"main"}]}`))
 		})
 		expected := fmt.Errorf("Some simulated error")
 		sdk := &SonarQubeSdk{
-			settings: &settings.SonarQubeConfig{
+			settings: fixedSettings(&settings.SonarQubeConfig{
 				Token: &settings.Token{
 					Value: "test-token",
 				},
-			},
+			}),
 			client: &ClientMock{
 				handler:       handler,
 				recoder:       httptest.NewRecorder(),
 				responseError: nil,
 			},
 			bodyReader: io.ReadAll,
-			httpRequest: func(method, target string, body io.Reader) (*http.Request, error) {
+			httpRequest: func(ctx context.Context, method, target string, body io.Reader) (*http.Request, error) {
 				return nil, expected
 			},
 		}
 
-		_, err := sdk.fetchPullRequests("test-project")
+		_, err := sdk.fetchPullRequests(context.Background(), "test-project")
 
 		assert.Equal(t, expected, err, "Unexpected error instance returned")
 	})
@@ -283,23 +399,23 @@ func TestFetchPullRequests(t *testing.T) {
 		})
 		expected := fmt.Errorf("Some simulated error")
 		sdk := &SonarQubeSdk{
-			settings: &settings.SonarQubeConfig{
+			settings: fixedSettings(&settings.SonarQubeConfig{
 				Token: &settings.Token{
 					Value: "test-token",
 				},
-			},
+			}),
 			client: &ClientMock{
 				handler:       handler,
 				recoder:       httptest.NewRecorder(),
 				responseError: expected,
 			},
 			bodyReader: io.ReadAll,
-			httpRequest: func(method, target string, body io.Reader) (*http.Request, error) {
-				return httptest.NewRequest(method, target, body), nil
+			httpRequest: func(ctx context.Context, method, target string, body io.Reader) (*http.Request, error) {
+				return httptest.NewRequest(method, target, body).WithContext(ctx), nil
 			},
 		}
 
-		_, err := sdk.fetchPullRequests("test-project")
+		_, err := sdk.fetchPullRequests(context.Background(), "test-project")
 
 		assert.Equal(t, expected, err)
 	})
@@ -309,23 +425,23 @@ func TestFetchPullRequests(t *testing.T) {
 			w.Write([]byte(`{"errors":[{"msg":"Project 'test-project' not found"}]}`))
 		})
 		sdk := &SonarQubeSdk{
-			settings: &settings.SonarQubeConfig{
+			settings: fixedSettings(&settings.SonarQubeConfig{
 				Token: &settings.Token{
 					Value: "test-token",
 				},
-			},
+			}),
 			client: &ClientMock{
 				handler:       handler,
 				recoder:       httptest.NewRecorder(),
 				responseError: nil,
 			},
 			bodyReader: io.ReadAll,
-			httpRequest: func(method, target string, body io.Reader) (*http.Request, error) {
-				return httptest.NewRequest(method, target, body), nil
+			httpRequest: func(ctx context.Context, method, target string, body io.Reader) (*http.Request, error) {
+				return httptest.NewRequest(method, target, body).WithContext(ctx), nil
 			},
 		}
 
-		_, err := sdk.fetchPullRequests("test-project")
+		_, err := sdk.fetchPullRequests(context.Background(), "test-project")
 
 		assert.Errorf(t, err, "Project 'test-project' not found", "Response error parsing broken")
 	})
@@ -333,36 +449,36 @@ func TestFetchPullRequests(t *testing.T) {
 
 func TestGetPullRequest(t *testing.T) {
 	t.Run("Success", func(t *testing.T) {
-		settings.Pattern = &settings.PatternConfig{
+		settings.Current().Pattern = &settings.PatternConfig{
 			Template: "PR-%d",
 		}
 		handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			w.Write([]byte(`{"pullRequests":[{"key":"PR-1","title":"pr-branch","branch":"pr-branch","base":"main","status":{"qualityGateStatus":"OK","bugs":0,"vulnerabilities":0,"codeSmells":0},"analysisDate":"2022-06-12T11:23:09+0000","target":"main"}]}`))
 		})
 		sdk := &SonarQubeSdk{
-			settings: &settings.SonarQubeConfig{
+			settings: fixedSettings(&settings.SonarQubeConfig{
 				Token: &settings.Token{
 					Value: "test-token",
 				},
-			},
+			}),
 			client: &ClientMock{
 				handler:       handler,
 				recoder:       httptest.NewRecorder(),
 				responseError: nil,
 			},
 			bodyReader: io.ReadAll,
-			httpRequest: func(method, target string, body io.Reader) (*http.Request, error) {
-				return httptest.NewRequest(method, target, body), nil
+			httpRequest: func(ctx context.Context, method, target string, body io.Reader) (*http.Request, error) {
+				return httptest.NewRequest(method, target, body).WithContext(ctx), nil
 			},
 		}
 
-		actual, err := sdk.GetPullRequest("test-project", 1)
+		actual, err := sdk.GetPullRequest(context.Background(), "test-project", 1)
 
 		assert.Nil(t, err, "Successful data retrieval broken and throws error")
 		assert.IsType(t, &PullRequest{}, actual, "Happy path broken")
 
 		t.Cleanup(func() {
-			settings.Pattern = nil
+			settings.Current().Pattern = nil
 		})
 	})
 
@@ -372,30 +488,30 @@ func TestGetPullRequest(t *testing.T) {
 		})
 		expected := fmt.Errorf("Some simulated error")
 		sdk := &SonarQubeSdk{
-			settings: &settings.SonarQubeConfig{
+			settings: fixedSettings(&settings.SonarQubeConfig{
 				Token: &settings.Token{
 					Value: "test-token",
 				},
-			},
+			}),
 			client: &ClientMock{
 				handler:       handler,
 				recoder:       httptest.NewRecorder(),
 				responseError: expected,
 			},
 			bodyReader: io.ReadAll,
-			httpRequest: func(method, target string, body io.Reader) (*http.Request, error) {
-				return httptest.NewRequest(method, target, body), nil
+			httpRequest: func(ctx context.Context, method, target string, body io.Reader) (*http.Request, error) {
+				return httptest.NewRequest(method, target, body).WithContext(ctx), nil
 			},
 		}
 
-		_, err := sdk.GetPullRequest("test-project", 1)
+		_, err := sdk.GetPullRequest(context.Background(), "test-project", 1)
 
 		assert.Errorf(t, err, "fetching pull requests failed", "Incorrect edge case is throwing errors")
 		assert.Errorf(t, err, "Some simulated error", "Unexpected error cause")
 	})
 
 	t.Run("Unknown PR", func(t *testing.T) {
-		settings.Pattern = &settings.PatternConfig{
+		settings.Current().Pattern = &settings.PatternConfig{
 			Template: "PR-%d",
 		}
 
@@ -403,28 +519,28 @@ func TestGetPullRequest(t *testing.T) {
 			w.Write([]byte(`{"pullRequests":[{"key":"PR-1","title":"pr-branch","branch":"pr-branch","base":"main","status":{"qualityGateStatus":"OK","bugs":0,"vulnerabilities":0,"codeSmells":0},"analysisDate":"2022-06-12T11:23:09+0000","target":"main"}]}`))
 		})
 		sdk := &SonarQubeSdk{
-			settings: &settings.SonarQubeConfig{
+			settings: fixedSettings(&settings.SonarQubeConfig{
 				Token: &settings.Token{
 					Value: "test-token",
 				},
-			},
+			}),
 			client: &ClientMock{
 				handler:       handler,
 				recoder:       httptest.NewRecorder(),
 				responseError: nil,
 			},
 			bodyReader: io.ReadAll,
-			httpRequest: func(method, target string, body io.Reader) (*http.Request, error) {
-				return httptest.NewRequest(method, target, body), nil
+			httpRequest: func(ctx context.Context, method, target string, body io.Reader) (*http.Request, error) {
+				return httptest.NewRequest(method, target, body).WithContext(ctx), nil
 			},
 		}
 
-		_, err := sdk.GetPullRequest("test-project", 1337)
+		_, err := sdk.GetPullRequest(context.Background(), "test-project", 1337)
 
 		assert.Errorf(t, err, "no pull request found with name 'PR-1337'")
 
 		t.Cleanup(func() {
-			settings.Pattern = nil
+			settings.Current().Pattern = nil
 		})
 	})
 }
@@ -435,51 +551,80 @@ func TestGetMeasures(t *testing.T) {
 			w.Write([]byte(`{"component":{"key":"test-project","name":"Test Project","qualifier":"TRK","measures":[{"metric":"bugs","value":"0","bestValue":true}],"pullRequest":"PR-1"},"metrics":[{"key":"bugs","name":"Bugs","description":"Bugs","domain":"Reliability","type":"INT","higherValuesAreBetter":false,"qualitative":false,"hidden":false,"custom":false,"bestValue":"0"}]}`))
 		})
 		sdk := &SonarQubeSdk{
-			settings: &settings.SonarQubeConfig{
+			settings: fixedSettings(&settings.SonarQubeConfig{
 				Token: &settings.Token{
 					Value: "test-token",
 				},
-			},
+			}),
 			client: &ClientMock{
 				handler:       handler,
 				recoder:       httptest.NewRecorder(),
 				responseError: nil,
 			},
 			bodyReader: io.ReadAll,
-			httpRequest: func(method, target string, body io.Reader) (*http.Request, error) {
-				return httptest.NewRequest(method, target, body), nil
+			httpRequest: func(ctx context.Context, method, target string, body io.Reader) (*http.Request, error) {
+				return httptest.NewRequest(method, target, body).WithContext(ctx), nil
 			},
 		}
 
-		actual, err := sdk.GetMeasures("test-project", "PR-1")
+		actual, err := sdk.GetMeasures(context.Background(), "test-project", "PR-1", nil)
 
 		assert.Nil(t, err, "Successful data retrieval broken and throws error")
 		assert.IsType(t, &MeasuresResponse{}, actual, "Happy path broken")
 	})
 
+	t.Run("Context", func(t *testing.T) {
+		type ctxKey struct{}
+		ctx := context.WithValue(context.Background(), ctxKey{}, "webhook")
+		handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			assert.Equal(t, "webhook", r.Context().Value(ctxKey{}), "Context not handed over to request")
+			w.Write([]byte(`{"component":{"key":"test-project","measures":[]},"metrics":[]}`))
+		})
+		sdk := &SonarQubeSdk{
+			settings: fixedSettings(&settings.SonarQubeConfig{
+				Token: &settings.Token{
+					Value: "test-token",
+				},
+			}),
+			client: &ClientMock{
+				handler:       handler,
+				recoder:       httptest.NewRecorder(),
+				responseError: nil,
+			},
+			bodyReader: io.ReadAll,
+			httpRequest: func(ctx context.Context, method, target string, body io.Reader) (*http.Request, error) {
+				return httptest.NewRequest(method, target, body).WithContext(ctx), nil
+			},
+		}
+
+		_, err := sdk.GetMeasures(ctx, "test-project", "PR-1", nil)
+
+		assert.Nil(t, err)
+	})
+
 	t.Run("Building failure", func(t *testing.T) {
 		handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			w.Write([]byte(`{"component":{"key":"test-project","name":"Test Project","qualifier":"TRK","measures":[{"metric":"bugs","value":"0","bestValue":true}],"pullRequest":"PR-1"},"metrics":[{"key":"bugs","name":"Bugs","description":"Bugs","domain":"Reliability","type":"INT","higherValuesAreBetter":false,"qualitative":false,"hidden":false,"custom":false,"bestValue":"0"}]}`))
 		})
 		expected := fmt.Errorf("Some simulated error")
 		sdk := &SonarQubeSdk{
-			settings: &settings.SonarQubeConfig{
+			settings: fixedSettings(&settings.SonarQubeConfig{
 				Token: &settings.Token{
 					Value: "test-token",
 				},
-			},
+			}),
 			client: &ClientMock{
 				handler:       handler,
 				recoder:       httptest.NewRecorder(),
 				responseError: nil,
 			},
 			bodyReader: io.ReadAll,
-			httpRequest: func(method, target string, body io.Reader) (*http.Request, error) {
+			httpRequest: func(ctx context.Context, method, target string, body io.Reader) (*http.Request, error) {
 				return nil, expected
 			},
 		}
 
-		_, err := sdk.GetMeasures("test-project", "PR-1")
+		_, err := sdk.GetMeasures(context.Background(), "test-project", "PR-1", nil)
 
 		assert.Equal(t, expected, err, "Unexpected error instance returned")
 	})
@@ -490,23 +635,23 @@ func TestGetMeasures(t *testing.T) {
 		})
 		expected := fmt.Errorf("Some simulated error")
 		sdk := &SonarQubeSdk{
-			settings: &settings.SonarQubeConfig{
+			settings: fixedSettings(&settings.SonarQubeConfig{
 				Token: &settings.Token{
 					Value: "test-token",
 				},
-			},
+			}),
 			client: &ClientMock{
 				handler:       handler,
 				recoder:       httptest.NewRecorder(),
 				responseError: expected,
 			},
 			bodyReader: io.ReadAll,
-			httpRequest: func(method, target string, body io.Reader) (*http.Request, error) {
-				return httptest.NewRequest(method, target, body), nil
+			httpRequest: func(ctx context.Context, method, target string, body io.Reader) (*http.Request, error) {
+				return httptest.NewRequest(method, target, body).WithContext(ctx), nil
 			},
 		}
 
-		_, err := sdk.GetMeasures("test-project", "PR-1")
+		_, err := sdk.GetMeasures(context.Background(), "test-project", "PR-1", nil)
 
 		assert.Equal(t, expected, err)
 	})
@@ -516,51 +661,405 @@ func TestGetMeasures(t *testing.T) {
 			w.Write([]byte(`{"errors":[{"msg":"Component 'non-existing-project' of pull request 'PR-1' not found"}]}`))
 		})
 		sdk := &SonarQubeSdk{
-			settings: &settings.SonarQubeConfig{
+			settings: fixedSettings(&settings.SonarQubeConfig{
 				Token: &settings.Token{
 					Value: "test-token",
 				},
-			},
+			}),
 			client: &ClientMock{
 				handler:       handler,
 				recoder:       httptest.NewRecorder(),
 				responseError: nil,
 			},
 			bodyReader: io.ReadAll,
-			httpRequest: func(method, target string, body io.Reader) (*http.Request, error) {
-				return httptest.NewRequest(method, target, body), nil
+			httpRequest: func(ctx context.Context, method, target string, body io.Reader) (*http.Request, error) {
+				return httptest.NewRequest(method, target, body).WithContext(ctx), nil
 			},
 		}
 
-		_, err := sdk.GetMeasures("non-existing-project", "PR-1")
+		_, err := sdk.GetMeasures(context.Background(), "non-existing-project", "PR-1", nil)
 
 		assert.Errorf(t, err, "Component 'non-existing-project' of pull request 'PR-1' not found", "Response error parsing broken")
 	})
 }
 
+func TestGetHotspots(t *testing.T) {
+	t.Run("Success", func(t *testing.T) {
+		handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			assert.Equal(t, "/api/hotspots/search", r.URL.Path)
+			assert.Equal(t, "PR-1", r.URL.Query().Get("pullRequest"))
+			w.Write([]byte(`{"paging":{"pageIndex":1,"pageSize":500,"total":1},"hotspots":[{"key":"AXhotspot1","component":"test-project:main.go","project":"test-project","securityCategory":"sql-injection","vulnerabilityProbability":"HIGH","status":"TO_REVIEW","line":12,"message":"Make sure this query is safe."}],"components":[{"key":"test-project:main.go","path":"main.go"}]}`))
+		})
+		sdk := &SonarQubeSdk{
+			settings: fixedSettings(&settings.SonarQubeConfig{
+				Url: "https://sonarqube.example.com",
+				Token: &settings.Token{
+					Value: "test-token",
+				},
+			}),
+			client: &ClientMock{
+				handler:       handler,
+				recoder:       httptest.NewRecorder(),
+				responseError: nil,
+			},
+			bodyReader: io.ReadAll,
+			httpRequest: func(ctx context.Context, method, target string, body io.Reader) (*http.Request, error) {
+				return httptest.NewRequest(method, target, body).WithContext(ctx), nil
+			},
+		}
+
+		actual, err := sdk.GetHotspots(context.Background(), "test-project", "PR-1")
+
+		assert.Nil(t, err, "Successful data retrieval broken and throws error")
+		assert.Len(t, actual.Hotspots, 1)
+		assert.Equal(t, "sql-injection", actual.Hotspots[0].SecurityCategory)
+	})
+
+	t.Run("Errors in response", func(t *testing.T) {
+		handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(`{"errors":[{"msg":"Project 'non-existing-project' not found"}]}`))
+		})
+		sdk := &SonarQubeSdk{
+			settings: fixedSettings(&settings.SonarQubeConfig{
+				Token: &settings.Token{
+					Value: "test-token",
+				},
+			}),
+			client: &ClientMock{
+				handler:       handler,
+				recoder:       httptest.NewRecorder(),
+				responseError: nil,
+			},
+			bodyReader: io.ReadAll,
+			httpRequest: func(ctx context.Context, method, target string, body io.Reader) (*http.Request, error) {
+				return httptest.NewRequest(method, target, body).WithContext(ctx), nil
+			},
+		}
+
+		_, err := sdk.GetHotspots(context.Background(), "non-existing-project", "PR-1")
+
+		assert.EqualError(t, err, "Project 'non-existing-project' not found", "Response error parsing broken")
+	})
+}
+
+func TestRetrievePagedDataFromApi(t *testing.T) {
+	t.Run("Multiple pages", func(t *testing.T) {
+		requestedPages := []string{}
+		handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			page := r.URL.Query().Get("p")
+			requestedPages = append(requestedPages, page)
+			assert.Equal(t, "500", r.URL.Query().Get("ps"))
+			w.Write([]byte(fmt.Sprintf(`{"paging":{"pageIndex":%s,"pageSize":500,"total":501},"hotspots":[{"key":"hotspot-%s"}]}`, page, page)))
+		})
+		sdk := &SonarQubeSdk{
+			settings: fixedSettings(&settings.SonarQubeConfig{
+				Token: &settings.Token{
+					Value: "test-token",
+				},
+			}),
+			client: &ClientMock{
+				handler:       handler,
+				recoder:       nil,
+				responseError: nil,
+			},
+			bodyReader: io.ReadAll,
+			httpRequest: func(ctx context.Context, method, target string, body io.Reader) (*http.Request, error) {
+				return httptest.NewRequest(method, target, body).WithContext(ctx), nil
+			},
+		}
+
+		actual, err := sdk.GetHotspots(context.Background(), "test-project", "PR-1")
+
+		assert.Nil(t, err)
+		assert.Equal(t, []string{"1", "2"}, requestedPages, "Unexpected pages requested")
+		assert.Len(t, actual.Hotspots, 2)
+		assert.Equal(t, "hotspot-2", actual.Hotspots[1].Key)
+	})
+
+	t.Run("Clamped page size", func(t *testing.T) {
+		requestedPages := []string{}
+		handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			page := r.URL.Query().Get("p")
+			requestedPages = append(requestedPages, page)
+			w.Write([]byte(fmt.Sprintf(`{"paging":{"pageIndex":%s,"pageSize":100,"total":150},"hotspots":[{"key":"hotspot-%s"}]}`, page, page)))
+		})
+		sdk := &SonarQubeSdk{
+			settings: fixedSettings(&settings.SonarQubeConfig{
+				Token: &settings.Token{
+					Value: "test-token",
+				},
+			}),
+			client: &ClientMock{
+				handler:       handler,
+				recoder:       nil,
+				responseError: nil,
+			},
+			bodyReader: io.ReadAll,
+			httpRequest: func(ctx context.Context, method, target string, body io.Reader) (*http.Request, error) {
+				return httptest.NewRequest(method, target, body).WithContext(ctx), nil
+			},
+		}
+
+		actual, err := sdk.GetHotspots(context.Background(), "test-project", "PR-1")
+
+		assert.Nil(t, err)
+		assert.Equal(t, []string{"1", "2"}, requestedPages, "Pages beyond the clamped page size not requested")
+		assert.Len(t, actual.Hotspots, 2)
+	})
+
+	t.Run("Result limit", func(t *testing.T) {
+		requests := 0
+		handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requests++
+			w.Write([]byte(`{"paging":{"pageIndex":1,"pageSize":500,"total":50000},"components":[]}`))
+		})
+		sdk := &SonarQubeSdk{
+			settings: fixedSettings(&settings.SonarQubeConfig{
+				Token: &settings.Token{
+					Value: "test-token",
+				},
+			}),
+			client: &ClientMock{
+				handler:       handler,
+				recoder:       nil,
+				responseError: nil,
+			},
+			bodyReader: io.ReadAll,
+			httpRequest: func(ctx context.Context, method, target string, body io.Reader) (*http.Request, error) {
+				return httptest.NewRequest(method, target, body).WithContext(ctx), nil
+			},
+		}
+
+		_, err := sdk.GetComponentTree(context.Background(), "test-project", "PR-1", []string{"new_coverage"})
+
+		assert.Nil(t, err)
+		assert.Equal(t, 20, requests, "SonarQube result limit not respected")
+	})
+
+	t.Run("Page error", func(t *testing.T) {
+		handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Query().Get("p") == "2" {
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+			w.Write([]byte(`{"paging":{"pageIndex":1,"pageSize":500,"total":1000},"hotspots":[]}`))
+		})
+		sdk := &SonarQubeSdk{
+			settings: fixedSettings(&settings.SonarQubeConfig{
+				Token: &settings.Token{
+					Value: "test-token",
+				},
+			}),
+			client: &ClientMock{
+				handler:       handler,
+				recoder:       nil,
+				responseError: nil,
+			},
+			bodyReader: io.ReadAll,
+			httpRequest: func(ctx context.Context, method, target string, body io.Reader) (*http.Request, error) {
+				return httptest.NewRequest(method, target, body).WithContext(ctx), nil
+			},
+		}
+
+		_, err := sdk.GetHotspots(context.Background(), "test-project", "PR-1")
+
+		assert.EqualError(t, err, "request failed with status 500: Internal Server Error")
+	})
+}
+
+func TestHotspotsGetRenderedMarkdown(t *testing.T) {
+	t.Run("To review", func(t *testing.T) {
+		response := &HotspotsResponse{
+			Hotspots: []Hotspot{
+				{Key: "h1", Component: "p:a.go", SecurityCategory: "weak-cryptography", VulnerabilityProbability: "LOW", Status: "TO_REVIEW", Line: 3, Message: "Weak hash"},
+				{Key: "h2", Component: "p:b.go", SecurityCategory: "sql-injection", VulnerabilityProbability: "HIGH", Status: "TO_REVIEW", Line: 7, Message: "Query"},
+				{Key: "h3", Component: "p:c.go", SecurityCategory: "dos", VulnerabilityProbability: "MEDIUM", Status: "REVIEWED", Message: "Regex"},
+			},
+			Components: []HotspotsComponent{
+				{Key: "p:a.go", Path: "a.go"},
+				{Key: "p:b.go", Path: "b.go"},
+			},
+		}
+
+		actual := response.GetRenderedMarkdown("https://sonarqube.example.com", "p", "PR-1")
+
+		assert.Contains(t, actual, "2 security hotspot(s) to review")
+		assert.Contains(t, actual, "| HIGH | sql-injection | [Query](https://sonarqube.example.com/security_hotspots?id=p&pullRequest=PR-1&hotspots=h2) | `b.go:7` |")
+		assert.Less(t, strings.Index(actual, "sql-injection"), strings.Index(actual, "weak-cryptography"), "Hotspots not ordered by probability")
+		assert.NotContains(t, actual, "Regex", "Reviewed hotspot rendered")
+	})
+
+	t.Run("Escaped message", func(t *testing.T) {
+		response := &HotspotsResponse{
+			Hotspots: []Hotspot{
+				{Key: "h1", Component: "p:a.go", SecurityCategory: "dos", VulnerabilityProbability: "LOW", Message: "Make sure [a-z]+|[0-9]+ is safe"},
+			},
+		}
+
+		actual := response.GetRenderedMarkdown("https://sonarqube.example.com", "p", "PR-1")
+
+		assert.Contains(t, actual, `| LOW | dos | [Make sure \[a-z\]+\|\[0-9\]+ is safe](https://sonarqube.example.com/security_hotspots?id=p&pullRequest=PR-1&hotspots=h1) |`)
+	})
+
+	t.Run("Nothing to review", func(t *testing.T) {
+		actual := (&HotspotsResponse{}).GetRenderedMarkdown("https://sonarqube.example.com", "p", "PR-1")
+
+		assert.Contains(t, actual, "No security hotspots to review")
+	})
+}
+
+func TestNewCoverageReport(t *testing.T) {
+	tree := &ComponentTreeResponse{
+		BaseComponent: ComponentTreeComponent{
+			Measures: []MeasuresComponentMeasure{
+				{Metric: "new_coverage", Period: &period{Value: "62.5"}},
+			},
+		},
+		Components: []ComponentTreeComponent{
+			{Path: "a.go", Measures: []MeasuresComponentMeasure{{Metric: "new_uncovered_lines", Period: &period{Value: "2"}}}},
+			{Path: "b.go", Measures: []MeasuresComponentMeasure{{Metric: "new_uncovered_lines", Period: &period{Value: "0"}}}},
+			{Path: "c.go", Measures: []MeasuresComponentMeasure{{Metric: "new_uncovered_lines", Period: &period{Value: "7"}}, {Metric: "new_coverage", Period: &period{Value: "12.0"}}}},
+			{Path: "d.go", Measures: []MeasuresComponentMeasure{{Metric: "new_uncovered_lines", Period: &period{Value: "4"}}}},
+		},
+	}
+
+	t.Run("Worst first", func(t *testing.T) {
+		actual := NewCoverageReport(tree, 0)
+
+		assert.Equal(t, "62.5", actual.Coverage)
+		assert.Len(t, actual.Files, 3, "Files without uncovered lines not filtered")
+		assert.Equal(t, "c.go", actual.Files[0].Path)
+		assert.Equal(t, "12.0", actual.Files[0].Coverage)
+		assert.Equal(t, "d.go", actual.Files[1].Path)
+		assert.Equal(t, "a.go", actual.Files[2].Path)
+	})
+
+	t.Run("Capped", func(t *testing.T) {
+		actual := NewCoverageReport(tree, 2)
+
+		assert.Len(t, actual.Files, 2)
+		assert.Equal(t, 1, actual.Omitted)
+	})
+}
+
+func TestUncoveredNewLines(t *testing.T) {
+	hit, miss := 3, 0
+	response := &SourceLinesResponse{
+		Sources: []SourceLine{
+			{Line: 1, IsNew: true},
+			{Line: 2, IsNew: true, LineHits: &miss},
+			{Line: 3, IsNew: true, LineHits: &hit},
+			{Line: 4, IsNew: false, LineHits: &miss},
+			{Line: 5, IsNew: true, LineHits: &miss},
+		},
+	}
+
+	assert.Equal(t, []int{2, 5}, response.UncoveredNewLines())
+}
+
+func TestCoverageReportGetRenderedMarkdown(t *testing.T) {
+	t.Run("Uncovered files", func(t *testing.T) {
+		report := &CoverageReport{
+			Coverage: "62.5",
+			Files: []UncoveredFile{
+				{Path: "internal/a.go", UncoveredLines: 5, Coverage: "20.0", Lines: []int{3, 4, 5, 9, 11}},
+			},
+			Omitted: 2,
+		}
+
+		actual := report.GetRenderedMarkdown("https://gitea.example.com/owner/repo/pulls/1")
+
+		assert.Contains(t, actual, "**Coverage on new code**: 62.5%")
+		assert.Contains(t, actual, "<summary>3 file(s) with uncovered new lines</summary>")
+		assert.Contains(t, actual, "| [internal/a.go](https://gitea.example.com/owner/repo/pulls/1/files#"+giteaDiffAnchor("internal/a.go")+") | 5 | 20.0% | 3-5, 9, 11 |")
+		assert.Contains(t, actual, "and 2 more file(s)")
+		assert.Contains(t, actual, "</details>")
+	})
+
+	t.Run("Fully covered", func(t *testing.T) {
+		actual := (&CoverageReport{Coverage: "100.0"}).GetRenderedMarkdown("")
+
+		assert.Contains(t, actual, "No uncovered new lines")
+		assert.NotContains(t, actual, "<details>")
+	})
+}
+
+func TestDuplicationsBlocks(t *testing.T) {
+	response := &DuplicationsResponse{
+		Duplications: []Duplication{
+			{Blocks: []DuplicationBlock{{From: 10, Size: 5, Ref: "1"}, {From: 20, Size: 5, Ref: "2"}}},
+			{Blocks: []DuplicationBlock{{From: 40, Size: 3, Ref: "1"}, {From: 1, Size: 3, Ref: "3"}}},
+		},
+		Files: map[string]DuplicationFile{
+			"1": {Key: "test-project:a.go", Name: "a.go", Project: "test-project"},
+			"2": {Key: "test-project:pkg/b.go", Name: "pkg/b.go", Project: "test-project"},
+			"3": {Key: "other-project:c.go", Name: "c.go", Project: "other-project"},
+		},
+	}
+
+	actual := response.Blocks("test-project")
+
+	assert.Len(t, actual, 2)
+	assert.Equal(t, DuplicationLocation{Path: "a.go", From: 10, To: 14}, actual[0][0])
+	assert.Equal(t, DuplicationLocation{Path: "pkg/b.go", From: 20, To: 24}, actual[0][1])
+	assert.True(t, actual[1][1].External, "Cross project duplication not detected")
+}
+
+func TestDuplicationReportGetRenderedMarkdown(t *testing.T) {
+	t.Run("Duplicated files", func(t *testing.T) {
+		tree := &ComponentTreeResponse{
+			BaseComponent: ComponentTreeComponent{
+				Measures: []MeasuresComponentMeasure{{Metric: "new_duplicated_lines_density", Period: &period{Value: "4.25"}}},
+			},
+			Components: []ComponentTreeComponent{
+				{Path: "a.go", Measures: []MeasuresComponentMeasure{{Metric: "new_duplicated_lines", Period: &period{Value: "5"}}}},
+				{Path: "b.go", Measures: []MeasuresComponentMeasure{{Metric: "new_duplicated_lines", Period: &period{Value: "0"}}}},
+			},
+		}
+		report := NewDuplicationReport(tree, 10)
+		report.Files[0].Blocks = [][2]DuplicationLocation{
+			{{Path: "a.go", From: 10, To: 14}, {Path: "pkg/b.go", From: 20, To: 24}},
+			{{Path: "a.go", From: 40, To: 42}, {Path: "c.go", From: 1, To: 3, External: true}},
+		}
+
+		actual := report.GetRenderedMarkdown("https://gitea.example.com/owner/repo/pulls/1", "https://gitea.example.com/owner/repo/src/commit/abc")
+
+		assert.Contains(t, actual, "**Duplicated lines on new code**: 4.2%")
+		assert.Contains(t, actual, "<summary>1 file(s) with new duplicated lines</summary>")
+		assert.Contains(t, actual, "[a.go#L10-L14](https://gitea.example.com/owner/repo/src/commit/abc/a.go#L10-L14) duplicates [pkg/b.go#L20-L24](https://gitea.example.com/owner/repo/src/commit/abc/pkg/b.go#L20-L24)")
+		assert.Contains(t, actual, "duplicates `c.go#L1-L3`", "External location linked")
+	})
+
+	t.Run("No duplications", func(t *testing.T) {
+		actual := (&DuplicationReport{}).GetRenderedMarkdown("", "")
+
+		assert.Contains(t, actual, "No new duplicated lines")
+	})
+}
+
 func TestComposeGiteaComment(t *testing.T) {
 	t.Run("Success", func(t *testing.T) {
 		handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			w.Write([]byte(`{"component":{"key":"test-project","name":"Test Project","qualifier":"TRK","measures":[{"metric":"bugs","value":"10","bestValue":false}],"pullRequest":"PR-1"},"metrics":[{"key":"bugs","name":"Bugs","description":"Bugs","domain":"Reliability","type":"INT","higherValuesAreBetter":false,"qualitative":false,"hidden":false,"custom":false,"bestValue":"0"}]}`))
 		})
 		sdk := &SonarQubeSdk{
-			settings: &settings.SonarQubeConfig{
+			settings: fixedSettings(&settings.SonarQubeConfig{
 				Token: &settings.Token{
 					Value: "test-token",
 				},
-			},
+			}),
 			client: &ClientMock{
 				handler:       handler,
 				recoder:       httptest.NewRecorder(),
 				responseError: nil,
 			},
 			bodyReader: io.ReadAll,
-			httpRequest: func(method, target string, body io.Reader) (*http.Request, error) {
-				return httptest.NewRequest(method, target, body), nil
+			httpRequest: func(ctx context.Context, method, target string, body io.Reader) (*http.Request, error) {
+				return httptest.NewRequest(method, target, body).WithContext(ctx), nil
 			},
 		}
 
-		actual, err := sdk.ComposeGiteaComment(&CommentComposeData{
+		actual, err := sdk.ComposeGiteaComment(context.Background(), &CommentComposeData{
 			Key:         "test-project",
 			PRName:      "PR-1",
 			Url:         "https://sonarqube.example.com",
@@ -575,29 +1074,204 @@ func TestComposeGiteaComment(t *testing.T) {
 		assert.Contains(t, actual, "/sq-bot review", "Happy path [Command] broken")
 	})
 
+	t.Run("Hotspots", func(t *testing.T) {
+		handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/api/hotspots/search" {
+				w.Write([]byte(`{"hotspots":[{"key":"AXhotspot1","component":"test-project:main.go","securityCategory":"sql-injection","vulnerabilityProbability":"HIGH","status":"TO_REVIEW","line":12,"message":"Make sure this query is safe."}]}`))
+				return
+			}
+			w.Write([]byte(`{"component":{"key":"test-project","name":"Test Project","qualifier":"TRK","measures":[{"metric":"bugs","value":"10","bestValue":false}],"pullRequest":"PR-1"},"metrics":[{"key":"bugs","name":"Bugs"}]}`))
+		})
+		sdk := &SonarQubeSdk{
+			settings: fixedSettings(&settings.SonarQubeConfig{
+				Token: &settings.Token{
+					Value: "test-token",
+				},
+			}),
+			client: &ClientMock{
+				handler:       handler,
+				recoder:       nil,
+				responseError: nil,
+			},
+			bodyReader: io.ReadAll,
+			httpRequest: func(ctx context.Context, method, target string, body io.Reader) (*http.Request, error) {
+				return httptest.NewRequest(method, target, body).WithContext(ctx), nil
+			},
+		}
+
+		actual, err := sdk.ComposeGiteaComment(context.Background(), &CommentComposeData{
+			Key:         "test-project",
+			PRName:      "PR-1",
+			Url:         "https://sonarqube.example.com",
+			QualityGate: "OK",
+			Hotspots: settings.HotspotsConfig{
+				Enabled: true,
+			},
+		})
+
+		assert.Nil(t, err, "Successful comment composing throwing errors")
+		assert.Contains(t, actual, "#### Security Hotspots", "Hotspots section missing")
+		assert.Contains(t, actual, "Make sure this query is safe.", "Hotspot missing")
+	})
+
+	t.Run("Coverage", func(t *testing.T) {
+		handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.URL.Path {
+			case "/api/measures/component_tree":
+				w.Write([]byte(`{"baseComponent":{"key":"test-project","measures":[{"metric":"new_coverage","period":{"value":"50.0"}}]},"components":[{"key":"test-project:main.go","path":"main.go","qualifier":"FIL","measures":[{"metric":"new_uncovered_lines","period":{"value":"2"}}]}]}`))
+			case "/api/sources/lines":
+				assert.Equal(t, "test-project:main.go", r.URL.Query().Get("key"))
+				w.Write([]byte(`{"sources":[{"line":1,"isNew":true,"lineHits":0},{"line":2,"isNew":true,"lineHits":0},{"line":3,"isNew":true,"lineHits":1}]}`))
+			default:
+				w.Write([]byte(`{"component":{"key":"test-project","measures":[{"metric":"bugs","value":"10"}]},"metrics":[{"key":"bugs","name":"Bugs"}]}`))
+			}
+		})
+		sdk := &SonarQubeSdk{
+			settings: fixedSettings(&settings.SonarQubeConfig{
+				Token: &settings.Token{
+					Value: "test-token",
+				},
+			}),
+			client: &ClientMock{
+				handler:       handler,
+				recoder:       nil,
+				responseError: nil,
+			},
+			bodyReader: io.ReadAll,
+			httpRequest: func(ctx context.Context, method, target string, body io.Reader) (*http.Request, error) {
+				return httptest.NewRequest(method, target, body).WithContext(ctx), nil
+			},
+		}
+
+		actual, err := sdk.ComposeGiteaComment(context.Background(), &CommentComposeData{
+			Key:         "test-project",
+			PRName:      "PR-1",
+			Url:         "https://sonarqube.example.com",
+			QualityGate: "OK",
+			Coverage: settings.CoverageConfig{
+				Enabled:  true,
+				MaxFiles: 10,
+			},
+			PullRequestUrl: "https://gitea.example.com/owner/repo/pulls/1",
+		})
+
+		assert.Nil(t, err, "Successful comment composing throwing errors")
+		assert.Contains(t, actual, "#### Coverage", "Coverage section missing")
+		assert.Contains(t, actual, "| 2 | - | 1-2 |", "Uncovered lines missing")
+	})
+
+	t.Run("Duplications", func(t *testing.T) {
+		handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.URL.Path {
+			case "/api/measures/component_tree":
+				w.Write([]byte(`{"baseComponent":{"key":"test-project","measures":[{"metric":"new_duplicated_lines_density","period":{"value":"10.0"}}]},"components":[{"key":"test-project:main.go","path":"main.go","qualifier":"FIL","measures":[{"metric":"new_duplicated_lines","period":{"value":"6"}}]}]}`))
+			case "/api/duplications/show":
+				assert.Equal(t, "test-project:main.go", r.URL.Query().Get("key"))
+				w.Write([]byte(`{"duplications":[{"blocks":[{"from":5,"size":6,"_ref":"1"},{"from":30,"size":6,"_ref":"2"}]}],"files":{"1":{"key":"test-project:main.go","name":"main.go","project":"test-project"},"2":{"key":"test-project:util.go","name":"util.go","project":"test-project"}}}`))
+			default:
+				w.Write([]byte(`{"component":{"key":"test-project","measures":[{"metric":"bugs","value":"10"}]},"metrics":[{"key":"bugs","name":"Bugs"}]}`))
+			}
+		})
+		sdk := &SonarQubeSdk{
+			settings: fixedSettings(&settings.SonarQubeConfig{
+				Token: &settings.Token{
+					Value: "test-token",
+				},
+			}),
+			client: &ClientMock{
+				handler:       handler,
+				recoder:       nil,
+				responseError: nil,
+			},
+			bodyReader: io.ReadAll,
+			httpRequest: func(ctx context.Context, method, target string, body io.Reader) (*http.Request, error) {
+				return httptest.NewRequest(method, target, body).WithContext(ctx), nil
+			},
+		}
+
+		actual, err := sdk.ComposeGiteaComment(context.Background(), &CommentComposeData{
+			Key:         "test-project",
+			PRName:      "PR-1",
+			Url:         "https://sonarqube.example.com",
+			QualityGate: "OK",
+			Duplications: settings.DuplicationsConfig{
+				Enabled:  true,
+				MaxFiles: 10,
+			},
+			SourceUrl: "https://gitea.example.com/owner/repo/src/commit/abc",
+		})
+
+		assert.Nil(t, err, "Successful comment composing throwing errors")
+		assert.Contains(t, actual, "#### Duplications", "Duplications section missing")
+		assert.Contains(t, actual, "duplicates [util.go#L30-L35](https://gitea.example.com/owner/repo/src/commit/abc/util.go#L30-L35)", "Duplicated block missing")
+	})
+
+	t.Run("Metric groups", func(t *testing.T) {
+		var requestedMetrics string
+		handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requestedMetrics = r.URL.Query().Get("metricKeys")
+			w.Write([]byte(`{"component":{"key":"test-project","name":"Test Project","qualifier":"TRK","measures":[{"metric":"bugs","value":"10","bestValue":false},{"metric":"new_coverage","period":{"value":"85.5"}}],"pullRequest":"PR-1"},"metrics":[{"key":"bugs","name":"Bugs"},{"key":"new_coverage","name":"Coverage on New Code"}]}`))
+		})
+		sdk := &SonarQubeSdk{
+			settings: fixedSettings(&settings.SonarQubeConfig{
+				Token: &settings.Token{
+					Value: "test-token",
+				},
+			}),
+			client: &ClientMock{
+				handler:       handler,
+				recoder:       httptest.NewRecorder(),
+				responseError: nil,
+			},
+			bodyReader: io.ReadAll,
+			httpRequest: func(ctx context.Context, method, target string, body io.Reader) (*http.Request, error) {
+				return httptest.NewRequest(method, target, body).WithContext(ctx), nil
+			},
+		}
+
+		actual, err := sdk.ComposeGiteaComment(context.Background(), &CommentComposeData{
+			Key:         "test-project",
+			PRName:      "PR-1",
+			Url:         "https://sonarqube.example.com",
+			QualityGate: "OK",
+			Metrics: []settings.MetricGroup{
+				{Name: "Coverage", Metrics: []string{"new_coverage"}},
+				{Name: "Reliability", Metrics: []string{"bugs"}},
+				{Name: "Security", Metrics: []string{"vulnerabilities"}},
+			},
+		})
+
+		assert.Nil(t, err, "Successful comment composing throwing errors")
+		assert.Equal(t, "new_coverage,bugs,vulnerabilities", requestedMetrics, "Configured metrics not requested")
+		assert.Contains(t, actual, "#### Coverage", "Group heading missing")
+		assert.Contains(t, actual, "| Coverage on New Code | 85.5 |", "Period value not rendered")
+		assert.Less(t, strings.Index(actual, "#### Coverage"), strings.Index(actual, "#### Reliability"), "Group order not respected")
+		assert.NotContains(t, actual, "#### Security", "Group without measures rendered")
+	})
+
 	t.Run("Error", func(t *testing.T) {
 		handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			w.Write([]byte(`{"component":{"key":"test-project","name":"Test Project","qualifier":"TRK","measures":[{"metric":"bugs","value":"10","bestValue":false}],"pullRequest":"PR-1"},"metrics":[{"key":"bugs","name":"Bugs","description":"Bugs","domain":"Reliability","type":"INT","higherValuesAreBetter":false,"qualitative":false,"hidden":false,"custom":false,"bestValue":"0"}]}`))
 		})
 		expected := fmt.Errorf("Expected error from GetMeasures")
 		sdk := &SonarQubeSdk{
-			settings: &settings.SonarQubeConfig{
+			settings: fixedSettings(&settings.SonarQubeConfig{
 				Token: &settings.Token{
 					Value: "test-token",
 				},
-			},
+			}),
 			client: &ClientMock{
 				handler:       handler,
 				recoder:       httptest.NewRecorder(),
 				responseError: nil,
 			},
 			bodyReader: io.ReadAll,
-			httpRequest: func(method, target string, body io.Reader) (*http.Request, error) {
+			httpRequest: func(ctx context.Context, method, target string, body io.Reader) (*http.Request, error) {
 				return nil, expected
 			},
 		}
 
-		_, err := sdk.ComposeGiteaComment(&CommentComposeData{
+		_, err := sdk.ComposeGiteaComment(context.Background(), &CommentComposeData{
 			Key:         "test-project",
 			PRName:      "PR-1",
 			Url:         "https://sonarqube.example.com",
@@ -615,7 +1289,194 @@ func TestNew(t *testing.T) {
 			Value: "test-token",
 		},
 	}
-	actual := New(config)
+	actual := New(fixedSettings(config))
 	assert.IsType(t, &SonarQubeSdk{}, actual, "Unexpected return type")
-	assert.Equal(t, config, actual.settings)
+	assert.Equal(t, config, actual.settings())
+}
+
+func TestValidateToken(t *testing.T) {
+	newSdk := func(status int, body string) *SonarQubeSdk {
+		handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(status)
+			w.Write([]byte(body))
+		})
+		return &SonarQubeSdk{
+			settings: fixedSettings(&settings.SonarQubeConfig{
+				Url: "http://sonarqube.example.com",
+				Token: &settings.Token{
+					Value: "test-token",
+				},
+			}),
+			client: &ClientMock{
+				handler: handler,
+			},
+			bodyReader: io.ReadAll,
+			httpRequest: func(ctx context.Context, method, target string, body io.Reader) (*http.Request, error) {
+				return httptest.NewRequest(method, target, body).WithContext(ctx), nil
+			},
+		}
+	}
+
+	t.Run("Valid", func(t *testing.T) {
+		assert.Nil(t, newSdk(http.StatusOK, `{"valid":true}`).ValidateToken(context.Background()))
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+		assert.EqualError(t, newSdk(http.StatusOK, `{"valid":false}`).ValidateToken(context.Background()), "missing or invalid API token")
+	})
+
+	t.Run("Unauthorized", func(t *testing.T) {
+		assert.EqualError(t, newSdk(http.StatusUnauthorized, ``).ValidateToken(context.Background()), "missing or invalid API token")
+	})
+}
+
+func TestCheckProject(t *testing.T) {
+	newSdk := func(status int, body string) *SonarQubeSdk {
+		handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			assert.Equal(t, "test-project", r.URL.Query().Get("component"))
+			w.WriteHeader(status)
+			w.Write([]byte(body))
+		})
+		return &SonarQubeSdk{
+			settings: fixedSettings(&settings.SonarQubeConfig{
+				Url: "http://sonarqube.example.com",
+				Token: &settings.Token{
+					Value: "test-token",
+				},
+			}),
+			client: &ClientMock{
+				handler: handler,
+			},
+			bodyReader: io.ReadAll,
+			httpRequest: func(ctx context.Context, method, target string, body io.Reader) (*http.Request, error) {
+				return httptest.NewRequest(method, target, body).WithContext(ctx), nil
+			},
+		}
+	}
+
+	t.Run("Success", func(t *testing.T) {
+		assert.Nil(t, newSdk(http.StatusOK, `{"component":{"key":"test-project"}}`).CheckProject(context.Background(), "test-project"))
+	})
+
+	t.Run("Not found", func(t *testing.T) {
+		err := newSdk(http.StatusNotFound, `{"errors":[{"msg":"Component key 'test-project' not found"}]}`).CheckProject(context.Background(), "test-project")
+		assert.EqualError(t, err, "request failed with status 404: Component key 'test-project' not found")
+	})
+
+	t.Run("Forbidden", func(t *testing.T) {
+		err := newSdk(http.StatusForbidden, `{"errors":[{"msg":"Insufficient privileges"}]}`).CheckProject(context.Background(), "test-project")
+		assert.EqualError(t, err, "missing \"Browse\" permission: request failed with status 403: Insufficient privileges")
+	})
+}
+
+func TestGetSystemStatus(t *testing.T) {
+	newSdk := func(status int, body string) *SonarQubeSdk {
+		handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			assert.Equal(t, "/api/system/status", r.URL.Path)
+			w.WriteHeader(status)
+			w.Write([]byte(body))
+		})
+		return &SonarQubeSdk{
+			settings: fixedSettings(&settings.SonarQubeConfig{
+				Url: "http://sonarqube.example.com",
+				Token: &settings.Token{
+					Value: "test-token",
+				},
+			}),
+			client: &ClientMock{
+				handler: handler,
+			},
+			bodyReader: io.ReadAll,
+			httpRequest: func(ctx context.Context, method, target string, body io.Reader) (*http.Request, error) {
+				return httptest.NewRequest(method, target, body).WithContext(ctx), nil
+			},
+		}
+	}
+
+	t.Run("Up", func(t *testing.T) {
+		status, err := newSdk(http.StatusOK, `{"id":"20150504120436","version":"10.4","status":"UP"}`).GetSystemStatus(context.Background())
+		assert.Nil(t, err)
+		assert.Equal(t, "UP", status)
+	})
+
+	t.Run("Error", func(t *testing.T) {
+		_, err := newSdk(http.StatusServiceUnavailable, ``).GetSystemStatus(context.Background())
+		assert.NotNil(t, err)
+	})
+}
+
+func TestWebhooks(t *testing.T) {
+	newSdk := func(handler http.HandlerFunc) *SonarQubeSdk {
+		return &SonarQubeSdk{
+			settings: fixedSettings(&settings.SonarQubeConfig{
+				Url: "http://sonarqube.example.com",
+				Token: &settings.Token{
+					Value: "test-token",
+				},
+			}),
+			client: &ClientMock{
+				handler: handler,
+			},
+			bodyReader: io.ReadAll,
+			httpRequest: func(ctx context.Context, method, target string, body io.Reader) (*http.Request, error) {
+				return httptest.NewRequest(method, target, body).WithContext(ctx), nil
+			},
+		}
+	}
+
+	t.Run("List", func(t *testing.T) {
+		sdk := newSdk(func(w http.ResponseWriter, r *http.Request) {
+			assert.Equal(t, "/api/webhooks/list", r.URL.Path)
+			assert.Equal(t, "test-project", r.URL.Query().Get("project"))
+			w.Write([]byte(`{"webhooks":[{"key":"AU-Tpxb--iU5OvuD2FLy","name":"gitea-sonarqube-bot","url":"https://bot.example.com/hooks/sonarqube","hasSecret":true}]}`))
+		})
+
+		hooks, err := sdk.ListWebhooks(context.Background(), "test-project")
+
+		hasSecret := true
+		assert.Nil(t, err)
+		assert.Equal(t, []Webhook{{Key: "AU-Tpxb--iU5OvuD2FLy", Name: "gitea-sonarqube-bot", Url: "https://bot.example.com/hooks/sonarqube", HasSecret: &hasSecret}}, hooks)
+	})
+
+	t.Run("Create", func(t *testing.T) {
+		sdk := newSdk(func(w http.ResponseWriter, r *http.Request) {
+			assert.Equal(t, http.MethodPost, r.Method)
+			assert.Equal(t, "/api/webhooks/create", r.URL.Path)
+			assert.Nil(t, r.ParseForm())
+			assert.Equal(t, "test-project", r.PostForm.Get("project"))
+			assert.Equal(t, "gitea-sonarqube-bot", r.PostForm.Get("name"))
+			assert.Equal(t, "https://bot.example.com/hooks/sonarqube", r.PostForm.Get("url"))
+			assert.Equal(t, "haxxor", r.PostForm.Get("secret"))
+			w.Write([]byte(`{"webhook":{"key":"AU-Tpxb--iU5OvuD2FLy"}}`))
+		})
+
+		err := sdk.CreateWebhook(context.Background(), "test-project", Webhook{Name: "gitea-sonarqube-bot", Url: "https://bot.example.com/hooks/sonarqube"}, "haxxor")
+
+		assert.Nil(t, err)
+	})
+
+	t.Run("Update without content", func(t *testing.T) {
+		sdk := newSdk(func(w http.ResponseWriter, r *http.Request) {
+			assert.Equal(t, "/api/webhooks/update", r.URL.Path)
+			assert.Nil(t, r.ParseForm())
+			assert.Equal(t, "AU-Tpxb--iU5OvuD2FLy", r.PostForm.Get("webhook"))
+			assert.Empty(t, r.PostForm.Get("secret"))
+			w.WriteHeader(http.StatusNoContent)
+		})
+
+		err := sdk.UpdateWebhook(context.Background(), Webhook{Key: "AU-Tpxb--iU5OvuD2FLy", Name: "gitea-sonarqube-bot", Url: "https://bot.example.com/hooks/sonarqube"}, "")
+
+		assert.Nil(t, err)
+	})
+
+	t.Run("Missing permission", func(t *testing.T) {
+		sdk := newSdk(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte(`{"errors":[{"msg":"Insufficient privileges"}]}`))
+		})
+
+		err := sdk.CreateWebhook(context.Background(), "test-project", Webhook{Name: "gitea-sonarqube-bot", Url: "https://bot.example.com/hooks/sonarqube"}, "")
+
+		assert.EqualError(t, err, "request failed with status 403: Insufficient privileges")
+	})
 }
@@ -0,0 +1,76 @@
+package sonarqube
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Webhook is a project webhook. SonarQube never returns the secret itself, newer versions indicate whether one is set.
+type Webhook struct {
+	Key       string `json:"key"`
+	Name      string `json:"name"`
+	Url       string `json:"url"`
+	HasSecret *bool  `json:"hasSecret"`
+}
+
+type WebhooksResponse struct {
+	Webhooks []Webhook `json:"webhooks"`
+	Errors   []Error   `json:"errors"`
+}
+
+func (sdk *SonarQubeSdk) ListWebhooks(ctx context.Context, project string) ([]Webhook, error) {
+	target := fmt.Sprintf("%s/api/webhooks/list?project=%s", sdk.settings().Url, url.QueryEscape(project))
+	request, err := sdk.httpRequest(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	response := &WebhooksResponse{}
+	err = retrieveDataFromApi(sdk, request, response)
+	if err != nil {
+		return nil, err
+	}
+
+	return response.Webhooks, nil
+}
+
+func (sdk *SonarQubeSdk) CreateWebhook(ctx context.Context, project string, hook Webhook, secret string) error {
+	form := url.Values{
+		"project": {project},
+		"name":    {hook.Name},
+		"url":     {hook.Url},
+	}
+	if secret != "" {
+		form.Set("secret", secret)
+	}
+
+	return sdk.postForm(ctx, "api/webhooks/create", form, &struct{}{})
+}
+
+func (sdk *SonarQubeSdk) UpdateWebhook(ctx context.Context, hook Webhook, secret string) error {
+	form := url.Values{
+		"webhook": {hook.Key},
+		"name":    {hook.Name},
+		"url":     {hook.Url},
+	}
+	if secret != "" {
+		form.Set("secret", secret)
+	}
+
+	// Successful updates are answered without content
+	return sdk.postForm(ctx, "api/webhooks/update", form, nil)
+}
+
+func (sdk *SonarQubeSdk) postForm(ctx context.Context, endpoint string, form url.Values, wrapper interface{}) error {
+	target := fmt.Sprintf("%s/%s", sdk.settings().Url, endpoint)
+	request, err := sdk.httpRequest(ctx, http.MethodPost, target, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	return retrieveDataFromApi(sdk, request, wrapper)
+}
@@ -0,0 +1,258 @@
+package dashboard
+
+import (
+	"context"
+	"embed"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"sort"
+	"sync"
+	"time"
+
+	giteaSdk "codeberg.org/justusbunsi/gitea-sonarqube-bot/internal/clients/gitea"
+	sqSdk "codeberg.org/justusbunsi/gitea-sonarqube-bot/internal/clients/sonarqube"
+	"codeberg.org/justusbunsi/gitea-sonarqube-bot/internal/settings"
+)
+
+// Quality gate state of pull requests SonarQube has not analysed yet
+const StatusNone = "NONE"
+
+// LoadTimeout bounds loading the overview. Loading continues if the requesting client goes away, so the result can be
+// cached for the next page view.
+var LoadTimeout = 30 * time.Second
+
+//go:embed templates static
+var assets embed.FS
+
+type CommentTracker interface {
+	LastComment(settings.GiteaRepository, int) (time.Time, bool)
+}
+
+type Measure struct {
+	Name  string
+	Value string
+}
+
+type Row struct {
+	Repository  settings.GiteaRepository
+	Project     string
+	Index       int64
+	Title       string
+	Url         string
+	Author      string
+	QualityGate string
+	AnalysedAt  string
+	SonarQube   string
+	Measures    []Measure
+	LastComment *time.Time
+	// Error of loading SonarQube details of the pull request
+	Error string
+}
+
+type Overview struct {
+	Rows     []Row
+	Errors   []string
+	LoadedAt time.Time
+}
+
+// Service collects the open pull requests of all mapped repositories. Results are cached to not query Gitea and
+// SonarQube for every page view.
+type Service struct {
+	giteaSdk giteaSdk.GiteaSdkInterface
+	sqSdk    sqSdk.SonarQubeSdkInterface
+	comments CommentTracker
+	ttl      time.Duration
+	mutex    sync.Mutex
+	cached   *Overview
+	// loading is closed when the running load finished. It is nil if no load is running.
+	loading chan struct{}
+}
+
+// Overview returns the cached overview or loads a new one if it expired. Concurrent page views wait for the same load.
+// If ctx ends before, the outdated overview is returned.
+func (s *Service) Overview(ctx context.Context) *Overview {
+	s.mutex.Lock()
+	if s.cached != nil && time.Since(s.cached.LoadedAt) <= s.ttl {
+		defer s.mutex.Unlock()
+		return s.cached
+	}
+
+	if s.loading == nil {
+		s.loading = make(chan struct{})
+		go s.refresh(ctx)
+	}
+	loading := s.loading
+	s.mutex.Unlock()
+
+	select {
+	case <-loading:
+	case <-ctx.Done():
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.cached == nil {
+		return &Overview{
+			Rows:     []Row{},
+			Errors:   []string{fmt.Sprintf("Overview not loaded yet: %s", ctx.Err())},
+			LoadedAt: time.Now(),
+		}
+	}
+
+	return s.cached
+}
+
+func (s *Service) refresh(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), LoadTimeout)
+	defer cancel()
+
+	overview := s.load(ctx)
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.cached = overview
+	close(s.loading)
+	s.loading = nil
+}
+
+func (s *Service) load(ctx context.Context) *Overview {
+	overview := &Overview{
+		Rows:     []Row{},
+		LoadedAt: time.Now(),
+	}
+
+	config := settings.Current()
+	for _, p := range config.Projects {
+		rows, err := s.loadProject(ctx, config, p)
+		if err != nil {
+			overview.Errors = append(overview.Errors, fmt.Sprintf("%s/%s: %s", p.Gitea.Owner, p.Gitea.Name, err.Error()))
+		}
+		overview.Rows = append(overview.Rows, rows...)
+	}
+
+	return overview
+}
+
+func (s *Service) loadProject(ctx context.Context, config *settings.Config, p settings.Project) ([]Row, error) {
+	prs, err := s.giteaSdk.ListOpenPullRequests(ctx, p.Gitea)
+	if err != nil {
+		return nil, fmt.Errorf("cannot list pull requests: %w", err)
+	}
+
+	analysed, err := s.sqSdk.ListPullRequests(ctx, p.SonarQube.Key)
+	if err != nil {
+		return nil, fmt.Errorf("cannot list SonarQube pull requests: %w", err)
+	}
+
+	analyses := map[string]sqSdk.PullRequest{}
+	for _, a := range analysed {
+		analyses[a.Key] = a
+	}
+
+	metrics := settings.MetricKeys(config.SonarQube.GetMetricGroups(&p))
+	rows := []Row{}
+	for _, pr := range prs {
+		row := Row{
+			Repository:  p.Gitea,
+			Project:     p.SonarQube.Key,
+			Index:       pr.Index,
+			Title:       pr.Title,
+			Url:         pr.Url,
+			Author:      pr.Author,
+			QualityGate: StatusNone,
+		}
+
+		if t, ok := s.comments.LastComment(p.Gitea, int(pr.Index)); ok {
+			row.LastComment = &t
+		}
+
+		name := sqSdk.PRNameFromIndex(pr.Index)
+		if a, ok := analyses[name]; ok {
+			row.QualityGate = a.Status.QualityGateStatus
+			row.AnalysedAt = a.AnalysisDate
+			row.SonarQube = s.sqSdk.GetPullRequestUrl(p.SonarQube.Key, pr.Index)
+
+			measures, err := s.sqSdk.GetMeasures(ctx, p.SonarQube.Key, name, metrics)
+			if err != nil {
+				row.Error = fmt.Sprintf("cannot load measures: %s", err.Error())
+			} else {
+				row.Measures = toMeasures(measures)
+			}
+		}
+
+		rows = append(rows, row)
+	}
+
+	return rows, nil
+}
+
+func toMeasures(response *sqSdk.MeasuresResponse) []Measure {
+	names := map[string]string{}
+	for _, m := range response.Metrics {
+		names[m.Key] = m.Name
+	}
+
+	measures := []Measure{}
+	for _, m := range response.Component.Measures {
+		name, ok := names[m.Metric]
+		if !ok {
+			name = m.Metric
+		}
+
+		value := m.Value
+		if m.Period != nil {
+			value = m.Period.Value
+		}
+
+		measures = append(measures, Measure{Name: name, Value: value})
+	}
+	sort.Slice(measures, func(i, j int) bool { return measures[i].Name < measures[j].Name })
+
+	return measures
+}
+
+// Filter returns the rows of the given project and quality gate state. Empty values match all rows.
+func Filter(rows []Row, project string, status string) []Row {
+	filtered := []Row{}
+	for _, r := range rows {
+		if project != "" && r.Repository.Owner+"/"+r.Repository.Name != project {
+			continue
+		}
+		if status != "" && r.QualityGate != status {
+			continue
+		}
+		filtered = append(filtered, r)
+	}
+
+	return filtered
+}
+
+// Templates returns the parsed HTML templates of the dashboard.
+func Templates() *template.Template {
+	return template.Must(template.New("").Funcs(template.FuncMap{
+		"timestamp": func(t *time.Time) string {
+			if t == nil {
+				return "-"
+			}
+			return t.Format(time.RFC3339)
+		},
+	}).ParseFS(assets, "templates/*.html"))
+}
+
+// Static returns the stylesheets and other files referenced by the templates.
+func Static() fs.FS {
+	static, _ := fs.Sub(assets, "static")
+	return static
+}
+
+func NewService(g giteaSdk.GiteaSdkInterface, sq sqSdk.SonarQubeSdkInterface, comments CommentTracker, ttl time.Duration) *Service {
+	return &Service{
+		giteaSdk: g,
+		sqSdk:    sq,
+		comments: comments,
+		ttl:      ttl,
+	}
+}
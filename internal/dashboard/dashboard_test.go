@@ -0,0 +1,207 @@
+package dashboard
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	giteaSdk "codeberg.org/justusbunsi/gitea-sonarqube-bot/internal/clients/gitea"
+	sqSdk "codeberg.org/justusbunsi/gitea-sonarqube-bot/internal/clients/sonarqube"
+	"codeberg.org/justusbunsi/gitea-sonarqube-bot/internal/settings"
+	"github.com/stretchr/testify/assert"
+)
+
+type GiteaSdkMock struct {
+	giteaSdk.GiteaSdkInterface
+	calls int
+	err   error
+}
+
+func (m *GiteaSdkMock) ListOpenPullRequests(ctx context.Context, _ settings.GiteaRepository) ([]giteaSdk.PullRequest, error) {
+	m.calls++
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return []giteaSdk.PullRequest{
+		{Index: 1, Title: "Analysed", Url: "https://gitea.example.com/test-owner/test-repo/pulls/1", Author: "test-user"},
+		{Index: 2, Title: "Not analysed", Url: "https://gitea.example.com/test-owner/test-repo/pulls/2", Author: "test-user"},
+	}, m.err
+}
+
+type SQSdkMock struct {
+	sqSdk.SonarQubeSdkInterface
+	measuresErr error
+}
+
+func (m *SQSdkMock) ListPullRequests(_ context.Context, _ string) ([]sqSdk.PullRequest, error) {
+	pr := sqSdk.PullRequest{Key: "PR-1", AnalysisDate: "2024-03-01T12:00:00+0000"}
+	pr.Status.QualityGateStatus = "ERROR"
+	return []sqSdk.PullRequest{pr}, nil
+}
+
+func (m *SQSdkMock) GetPullRequestUrl(project string, index int64) string {
+	return "https://sonarqube.example.com/dashboard?id=test-project&pullRequest=PR-1"
+}
+
+func (m *SQSdkMock) GetMeasures(_ context.Context, _ string, _ string, _ []string) (*sqSdk.MeasuresResponse, error) {
+	if m.measuresErr != nil {
+		return nil, m.measuresErr
+	}
+	return &sqSdk.MeasuresResponse{
+		Component: sqSdk.MeasuresComponent{
+			Measures: []sqSdk.MeasuresComponentMeasure{
+				{Metric: "new_bugs", Value: "3"},
+			},
+		},
+		Metrics: []sqSdk.MeasuresComponentMetric{
+			{Key: "new_bugs", Name: "New Bugs"},
+		},
+	}, nil
+}
+
+type CommentTrackerMock struct{}
+
+func (CommentTrackerMock) LastComment(_ settings.GiteaRepository, idx int) (time.Time, bool) {
+	return time.Date(2024, 3, 1, 12, 5, 0, 0, time.UTC), idx == 1
+}
+
+func withProjects(t *testing.T) {
+	settings.Current().Pattern = &settings.PatternConfig{
+		Template: "PR-%d",
+	}
+	settings.Current().SonarQube = settings.SonarQubeConfig{}
+	settings.Current().Projects = []settings.Project{
+		{
+			SonarQube: struct{ Key string }{
+				Key: "test-project",
+			},
+			Gitea: settings.GiteaRepository{
+				Owner: "test-owner",
+				Name:  "test-repo",
+			},
+		},
+	}
+
+	t.Cleanup(func() {
+		settings.Current().Pattern = nil
+		settings.Current().Projects = nil
+	})
+}
+
+func TestOverview(t *testing.T) {
+	t.Run("Rows", func(t *testing.T) {
+		withProjects(t)
+		s := NewService(&GiteaSdkMock{}, &SQSdkMock{}, CommentTrackerMock{}, time.Minute)
+
+		overview := s.Overview(context.Background())
+
+		assert.Empty(t, overview.Errors)
+		assert.Len(t, overview.Rows, 2)
+
+		analysed := overview.Rows[0]
+		assert.Equal(t, "ERROR", analysed.QualityGate)
+		assert.Equal(t, "2024-03-01T12:00:00+0000", analysed.AnalysedAt)
+		assert.Equal(t, []Measure{{Name: "New Bugs", Value: "3"}}, analysed.Measures)
+		assert.Equal(t, time.Date(2024, 3, 1, 12, 5, 0, 0, time.UTC), *analysed.LastComment)
+
+		notAnalysed := overview.Rows[1]
+		assert.Equal(t, StatusNone, notAnalysed.QualityGate)
+		assert.Empty(t, notAnalysed.Measures)
+		assert.Nil(t, notAnalysed.LastComment)
+	})
+
+	t.Run("Cached", func(t *testing.T) {
+		withProjects(t)
+		g := &GiteaSdkMock{}
+		s := NewService(g, &SQSdkMock{}, CommentTrackerMock{}, time.Minute)
+
+		s.Overview(context.Background())
+		s.Overview(context.Background())
+
+		assert.Equal(t, 1, g.calls)
+	})
+
+	t.Run("Expired", func(t *testing.T) {
+		withProjects(t)
+		g := &GiteaSdkMock{}
+		s := NewService(g, &SQSdkMock{}, CommentTrackerMock{}, 0)
+
+		s.Overview(context.Background())
+		time.Sleep(time.Millisecond)
+		s.Overview(context.Background())
+
+		assert.Equal(t, 2, g.calls)
+	})
+
+	t.Run("Errors", func(t *testing.T) {
+		withProjects(t)
+		s := NewService(&GiteaSdkMock{err: errors.New("401 Unauthorized")}, &SQSdkMock{}, CommentTrackerMock{}, time.Minute)
+
+		overview := s.Overview(context.Background())
+
+		assert.Equal(t, []string{"test-owner/test-repo: cannot list pull requests: 401 Unauthorized"}, overview.Errors)
+		assert.Empty(t, overview.Rows)
+	})
+
+	t.Run("Measure errors", func(t *testing.T) {
+		withProjects(t)
+		s := NewService(&GiteaSdkMock{}, &SQSdkMock{measuresErr: errors.New("504 Gateway Timeout")}, CommentTrackerMock{}, time.Minute)
+
+		overview := s.Overview(context.Background())
+
+		assert.Empty(t, overview.Errors)
+		assert.Len(t, overview.Rows, 2, "Measure error dropped other rows")
+		assert.Equal(t, "ERROR", overview.Rows[0].QualityGate)
+		assert.Equal(t, "cannot load measures: 504 Gateway Timeout", overview.Rows[0].Error)
+	})
+
+	t.Run("Canceled page view", func(t *testing.T) {
+		withProjects(t)
+		g := &GiteaSdkMock{}
+		s := NewService(g, &SQSdkMock{}, CommentTrackerMock{}, time.Minute)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		s.Overview(ctx)
+		overview := s.Overview(context.Background())
+
+		assert.Empty(t, overview.Errors, "Loading canceled with the page view")
+		assert.Len(t, overview.Rows, 2)
+		assert.Equal(t, 1, g.calls)
+	})
+}
+
+func TestFilter(t *testing.T) {
+	rows := []Row{
+		{Repository: settings.GiteaRepository{Owner: "test-owner", Name: "a"}, Index: 1, QualityGate: "OK"},
+		{Repository: settings.GiteaRepository{Owner: "test-owner", Name: "a"}, Index: 2, QualityGate: "ERROR"},
+		{Repository: settings.GiteaRepository{Owner: "test-owner", Name: "b"}, Index: 1, QualityGate: "ERROR"},
+	}
+
+	assert.Len(t, Filter(rows, "", ""), 3)
+	assert.Len(t, Filter(rows, "test-owner/a", ""), 2)
+	assert.Len(t, Filter(rows, "", "ERROR"), 2)
+	assert.Equal(t, rows[1:2], Filter(rows, "test-owner/a", "ERROR"))
+	assert.Empty(t, Filter(rows, "test-owner/c", ""))
+}
+
+func TestTemplates(t *testing.T) {
+	var b bytes.Buffer
+	err := Templates().ExecuteTemplate(&b, "dashboard.html", map[string]interface{}{
+		"Projects": []string{"test-owner/test-repo"},
+		"Project":  "test-owner/test-repo",
+		"Statuses": []string{"OK", "ERROR", StatusNone},
+		"Status":   "",
+		"Rows": []Row{
+			{Repository: settings.GiteaRepository{Owner: "test-owner", Name: "test-repo"}, Index: 1, Title: "<script>", QualityGate: "OK"},
+		},
+		"LoadedAt": time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC),
+	})
+
+	assert.Nil(t, err)
+	assert.Contains(t, b.String(), `<option value="test-owner/test-repo" selected>test-owner/test-repo</option>`)
+	assert.Contains(t, b.String(), `test-owner/test-repo#1</a> &lt;script&gt;`)
+	assert.Contains(t, b.String(), `Loaded at 2024-03-01T12:00:00Z`)
+}
@@ -0,0 +1,71 @@
+package dedup
+
+import (
+	"sync"
+	"time"
+)
+
+// Cache remembers keys for a limited time to recognize repeated webhook deliveries.
+type Cache struct {
+	ttl       time.Duration
+	now       func() time.Time
+	mutex     sync.Mutex
+	expiresAt map[string]time.Time
+	nextPrune time.Time
+}
+
+// Claim records the key and reports whether it was unknown or expired. Only the first of concurrent callers claiming
+// the same key succeeds.
+func (c *Cache) Claim(key string) bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	now := c.now()
+	c.prune(now)
+
+	if expiresAt, found := c.expiresAt[key]; found && now.Before(expiresAt) {
+		return false
+	}
+
+	c.expiresAt[key] = now.Add(c.ttl)
+
+	return true
+}
+
+// Release forgets a claimed key, e.g. because the delivery was rejected and is expected to be sent again.
+func (c *Cache) Release(key string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	delete(c.expiresAt, key)
+}
+
+// Len returns the number of remembered keys including expired ones not yet pruned.
+func (c *Cache) Len() int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return len(c.expiresAt)
+}
+
+// prune drops expired keys at most once per TTL to keep claims cheap.
+func (c *Cache) prune(now time.Time) {
+	if now.Before(c.nextPrune) {
+		return
+	}
+
+	for key, expiresAt := range c.expiresAt {
+		if !now.Before(expiresAt) {
+			delete(c.expiresAt, key)
+		}
+	}
+	c.nextPrune = now.Add(c.ttl)
+}
+
+func New(ttl time.Duration) *Cache {
+	return &Cache{
+		ttl:       ttl,
+		now:       time.Now,
+		expiresAt: make(map[string]time.Time),
+	}
+}
@@ -0,0 +1,54 @@
+package dedup
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCache(t *testing.T) {
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	newCache := func() *Cache {
+		c := New(time.Minute)
+		c.now = func() time.Time { return now }
+		return c
+	}
+
+	t.Run("Duplicate within TTL", func(t *testing.T) {
+		c := newCache()
+
+		assert.True(t, c.Claim("a"))
+		assert.False(t, c.Claim("a"))
+		assert.True(t, c.Claim("b"))
+	})
+
+	t.Run("Expired", func(t *testing.T) {
+		c := newCache()
+		assert.True(t, c.Claim("a"))
+
+		now = now.Add(time.Minute)
+
+		assert.True(t, c.Claim("a"))
+	})
+
+	t.Run("Release", func(t *testing.T) {
+		c := newCache()
+		assert.True(t, c.Claim("a"))
+
+		c.Release("a")
+
+		assert.True(t, c.Claim("a"))
+	})
+
+	t.Run("Prunes expired keys", func(t *testing.T) {
+		c := newCache()
+		c.Claim("a")
+		c.Claim("b")
+
+		now = now.Add(2 * time.Minute)
+		c.Claim("c")
+
+		assert.Equal(t, 1, c.Len())
+	})
+}
@@ -0,0 +1,237 @@
+package deliveries
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+type Outcome string
+
+const (
+	// The request is still being handled
+	OutcomeReceived Outcome = "received"
+	// The request was rejected, e.g. because of an invalid signature or body
+	OutcomeRejected Outcome = "rejected"
+	// The webhook is valid, but not relevant for the bot
+	OutcomeIgnored Outcome = "ignored"
+	// The same webhook was received before
+	OutcomeDuplicate Outcome = "duplicate"
+	// The webhook is waiting for or being processed by the job queue
+	OutcomeQueued    Outcome = "queued"
+	OutcomeProcessed Outcome = "processed"
+	OutcomeFailed    Outcome = "failed"
+)
+
+const redacted = "REDACTED"
+
+type recordKey struct{}
+
+// WithRecordID returns a context carrying the ID of the log entry of a webhook request.
+func WithRecordID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, recordKey{}, id)
+}
+
+// RecordID returns the ID of the log entry of the context or an empty string.
+func RecordID(ctx context.Context) string {
+	id, _ := ctx.Value(recordKey{}).(string)
+	return id
+}
+
+// NewRecordID generates the ID of a log entry. Senders may deliver the same webhook more than once, so their delivery
+// ID does not identify an entry.
+func NewRecordID() string {
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+
+	return hex.EncodeToString(b)
+}
+
+type Delivery struct {
+	ID string `json:"id"`
+	// DeliveryID is assigned by the sender or generated if missing. It is added to all related log records.
+	DeliveryID string      `json:"deliveryId"`
+	Time       time.Time   `json:"time"`
+	Endpoint   string      `json:"endpoint"`
+	Platform   string      `json:"platform,omitempty"`
+	Event      string      `json:"event,omitempty"`
+	Header     http.Header `json:"headers"`
+	Body       []byte      `json:"-"`
+	StatusCode int         `json:"statusCode"`
+	Message    string      `json:"message"`
+	Outcome    Outcome     `json:"outcome"`
+	Job        int64       `json:"job,omitempty"`
+	Error      string      `json:"error,omitempty"`
+	ReplayOf   string      `json:"replayOf,omitempty"`
+}
+
+// Redacted returns a copy of the delivery for display. Signature headers and the values of the given JSON fields
+// within the body are replaced.
+func (d Delivery) Redacted(fields []string) RedactedDelivery {
+	header := http.Header{}
+	for name, values := range d.Header {
+		canonical := http.CanonicalHeaderKey(name)
+		if strings.Contains(canonical, "Signature") || strings.Contains(canonical, "Hmac") {
+			values = []string{redacted}
+		}
+		header[canonical] = values
+	}
+	d.Header = header
+
+	return RedactedDelivery{
+		Delivery: d,
+		Body:     redactBody(d.Body, fields),
+	}
+}
+
+type RedactedDelivery struct {
+	Delivery
+	Body string `json:"body,omitempty"`
+}
+
+func redactBody(body []byte, fields []string) string {
+	if len(body) == 0 || len(fields) == 0 {
+		return string(body)
+	}
+
+	var data interface{}
+	if err := json.Unmarshal(body, &data); err != nil {
+		// Bodies that cannot be inspected are not shown at all
+		return redacted
+	}
+
+	redactFields(data, fields)
+
+	result, _ := json.Marshal(data)
+	return string(result)
+}
+
+func redactFields(data interface{}, fields []string) {
+	switch v := data.(type) {
+	case map[string]interface{}:
+		for key, value := range v {
+			matched := false
+			for _, f := range fields {
+				if strings.EqualFold(key, f) {
+					matched = true
+					break
+				}
+			}
+
+			if matched {
+				v[key] = redacted
+			} else {
+				redactFields(value, fields)
+			}
+		}
+	case []interface{}:
+		for _, value := range v {
+			redactFields(value, fields)
+		}
+	}
+}
+
+// Log keeps the latest webhook deliveries in memory. Older entries are overwritten.
+type Log struct {
+	mutex   sync.Mutex
+	entries []Delivery
+	next    int
+	full    bool
+}
+
+func (l *Log) Add(d Delivery) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if len(l.entries) == 0 {
+		return
+	}
+
+	l.entries[l.next] = d
+	l.next = (l.next + 1) % len(l.entries)
+	if l.next == 0 {
+		l.full = true
+	}
+}
+
+// Update changes the delivery with the given ID. Unknown or already overwritten deliveries are ignored.
+func (l *Log) Update(id string, fn func(d *Delivery)) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if i, ok := l.find(id); ok {
+		fn(&l.entries[i])
+	}
+}
+
+// Complete records the result of the job that processed the delivery.
+func (l *Log) Complete(id string, err error) {
+	l.Update(id, func(d *Delivery) {
+		d.Outcome = OutcomeProcessed
+		d.Error = ""
+		if err != nil {
+			d.Outcome = OutcomeFailed
+			d.Error = err.Error()
+		}
+	})
+}
+
+func (l *Log) Get(id string) (Delivery, bool) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if i, ok := l.find(id); ok {
+		return l.entries[i], true
+	}
+
+	return Delivery{}, false
+}
+
+func (l *Log) find(id string) (int, bool) {
+	for _, i := range l.indexes() {
+		if l.entries[i].ID == id {
+			return i, true
+		}
+	}
+
+	return 0, false
+}
+
+// indexes returns the positions of recorded entries, newest first.
+func (l *Log) indexes() []int {
+	count := l.next
+	if l.full {
+		count = len(l.entries)
+	}
+
+	indexes := make([]int, 0, count)
+	for i := 1; i <= count; i++ {
+		indexes = append(indexes, (l.next-i+len(l.entries))%len(l.entries))
+	}
+
+	return indexes
+}
+
+// List returns the recorded deliveries, newest first.
+func (l *Log) List() []Delivery {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	list := []Delivery{}
+	for _, i := range l.indexes() {
+		list = append(list, l.entries[i])
+	}
+
+	return list
+}
+
+func NewLog(size int) *Log {
+	return &Log{
+		entries: make([]Delivery, size),
+	}
+}
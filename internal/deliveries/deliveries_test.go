@@ -0,0 +1,100 @@
+package deliveries
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func ids(list []Delivery) []string {
+	result := []string{}
+	for _, d := range list {
+		result = append(result, d.ID)
+	}
+
+	return result
+}
+
+func TestLog(t *testing.T) {
+	t.Run("Empty", func(t *testing.T) {
+		assert.Empty(t, NewLog(3).List())
+	})
+
+	t.Run("Newest first", func(t *testing.T) {
+		l := NewLog(3)
+		l.Add(Delivery{ID: "a"})
+		l.Add(Delivery{ID: "b"})
+
+		assert.Equal(t, []string{"b", "a"}, ids(l.List()))
+	})
+
+	t.Run("Overwrite oldest", func(t *testing.T) {
+		l := NewLog(3)
+		for _, id := range []string{"a", "b", "c", "d"} {
+			l.Add(Delivery{ID: id})
+		}
+
+		assert.Equal(t, []string{"d", "c", "b"}, ids(l.List()))
+	})
+
+	t.Run("Disabled", func(t *testing.T) {
+		l := NewLog(0)
+		l.Add(Delivery{ID: "a"})
+
+		assert.Empty(t, l.List())
+	})
+}
+
+func TestUpdate(t *testing.T) {
+	l := NewLog(3)
+	l.Add(Delivery{ID: "a", Outcome: OutcomeQueued})
+	l.Add(Delivery{ID: "b", Outcome: OutcomeQueued})
+
+	l.Complete("a", nil)
+	l.Complete("b", errors.New("Gitea unreachable"))
+	l.Complete("unknown", nil)
+
+	a, _ := l.Get("a")
+	assert.Equal(t, OutcomeProcessed, a.Outcome)
+	assert.Empty(t, a.Error)
+
+	b, _ := l.Get("b")
+	assert.Equal(t, OutcomeFailed, b.Outcome)
+	assert.Equal(t, "Gitea unreachable", b.Error)
+
+	_, ok := l.Get("unknown")
+	assert.False(t, ok)
+}
+
+func TestRedacted(t *testing.T) {
+	d := Delivery{
+		ID: "a",
+		Header: http.Header{
+			"X-Gitea-Signature":           []string{"f00"},
+			"X-Sonar-Webhook-Hmac-Sha256": []string{"f00"},
+			"X-Gitea-Event":               []string{"pull_request"},
+		},
+		Body: []byte(`{"action":"opened","sender":{"login":"test-user","email":"a@b.c"},"list":[{"email":"d@e.f"}]}`),
+	}
+
+	t.Run("Headers and fields", func(t *testing.T) {
+		r := d.Redacted([]string{"email"})
+
+		assert.Equal(t, []string{"REDACTED"}, r.Header["X-Gitea-Signature"])
+		assert.Equal(t, []string{"REDACTED"}, r.Header["X-Sonar-Webhook-Hmac-Sha256"])
+		assert.Equal(t, []string{"pull_request"}, r.Header["X-Gitea-Event"])
+		assert.JSONEq(t, `{"action":"opened","sender":{"login":"test-user","email":"REDACTED"},"list":[{"email":"REDACTED"}]}`, r.Body)
+		// The stored delivery is left untouched for replays
+		assert.Equal(t, []string{"f00"}, d.Header["X-Gitea-Signature"])
+	})
+
+	t.Run("Without fields", func(t *testing.T) {
+		assert.Equal(t, string(d.Body), d.Redacted(nil).Body)
+	})
+
+	t.Run("Invalid JSON", func(t *testing.T) {
+		assert.Equal(t, "REDACTED", Delivery{Body: []byte(`{`)}.Redacted([]string{"email"}).Body)
+	})
+}
@@ -0,0 +1,173 @@
+package health
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	giteaSdk "codeberg.org/justusbunsi/gitea-sonarqube-bot/internal/clients/gitea"
+	sqSdk "codeberg.org/justusbunsi/gitea-sonarqube-bot/internal/clients/sonarqube"
+	"codeberg.org/justusbunsi/gitea-sonarqube-bot/internal/queue"
+	"codeberg.org/justusbunsi/gitea-sonarqube-bot/internal/settings"
+)
+
+const (
+	StatusOk      = "ok"
+	StatusFailing = "failing"
+	StatusPending = "pending"
+)
+
+type Check struct {
+	Name string
+	Run  func(context.Context) error
+}
+
+type Result struct {
+	Status    string     `json:"status"`
+	Error     string     `json:"error,omitempty"`
+	CheckedAt *time.Time `json:"checkedAt,omitempty"`
+	Duration  string     `json:"duration,omitempty"`
+}
+
+// Checker runs a set of checks and caches their results, so probes do not put load on Gitea and SonarQube.
+type Checker struct {
+	checks  []Check
+	timeout time.Duration
+	mutex   sync.RWMutex
+	results map[string]Result
+}
+
+// Ready reports whether all checks passed on their latest run. Checks that did not run yet count as failing.
+func (c *Checker) Ready() (bool, map[string]Result) {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	ready := true
+	results := make(map[string]Result, len(c.results))
+	for name, r := range c.results {
+		results[name] = r
+		if r.Status != StatusOk {
+			ready = false
+		}
+	}
+
+	return ready, results
+}
+
+// RunOnce executes all checks, each limited by the configured timeout, and stores their results.
+func (c *Checker) RunOnce(ctx context.Context) {
+	for _, check := range c.checks {
+		checkCtx, cancel := context.WithTimeout(ctx, c.timeout)
+		start := time.Now()
+		err := check.Run(checkCtx)
+		cancel()
+
+		r := Result{
+			Status:    StatusOk,
+			CheckedAt: &start,
+			Duration:  time.Since(start).Round(time.Millisecond).String(),
+		}
+		if err != nil {
+			r.Status = StatusFailing
+			r.Error = err.Error()
+		}
+
+		c.mutex.Lock()
+		c.results[check.Name] = r
+		c.mutex.Unlock()
+	}
+}
+
+// Start runs the checks immediately and then in the given interval until the context is cancelled.
+func (c *Checker) Start(ctx context.Context, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			c.RunOnce(ctx)
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+func NewChecker(timeout time.Duration, checks ...Check) *Checker {
+	results := make(map[string]Result, len(checks))
+	for _, check := range checks {
+		results[check.Name] = Result{Status: StatusPending}
+	}
+
+	return &Checker{
+		checks:  checks,
+		timeout: timeout,
+		results: results,
+	}
+}
+
+// Gitea checks that the Gitea API is reachable and accepts the configured token.
+func Gitea(g giteaSdk.GiteaSdkInterface) Check {
+	return Check{
+		Name: "gitea",
+		Run: func(ctx context.Context) error {
+			_, err := g.GetBotUser(ctx)
+			return err
+		},
+	}
+}
+
+// SonarQube checks that the SonarQube instance reports being up.
+func SonarQube(sq sqSdk.SonarQubeSdkInterface) Check {
+	return Check{
+		Name: "sonarqube",
+		Run: func(ctx context.Context) error {
+			status, err := sq.GetSystemStatus(ctx)
+			if err != nil {
+				return err
+			}
+			if status != "UP" {
+				return fmt.Errorf("system status is %s", status)
+			}
+
+			return nil
+		},
+	}
+}
+
+// Config checks that a configuration with project mappings is loaded.
+func Config() Check {
+	return Check{
+		Name: "config",
+		Run: func(_ context.Context) error {
+			if len(settings.Current().Projects) == 0 {
+				return fmt.Errorf("no project mapping loaded")
+			}
+
+			return nil
+		},
+	}
+}
+
+type queueStats interface {
+	Stats() queue.Stats
+}
+
+// Queue checks that the job queue has room for new webhooks.
+func Queue(q queueStats) Check {
+	return Check{
+		Name: "queue",
+		Run: func(_ context.Context) error {
+			stats := q.Stats()
+			if stats.Pending+stats.Waiting >= stats.Capacity {
+				return fmt.Errorf("job queue is saturated with %d pending and %d waiting jobs", stats.Pending, stats.Waiting)
+			}
+
+			return nil
+		},
+	}
+}
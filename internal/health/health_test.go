@@ -0,0 +1,125 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	giteaSdk "codeberg.org/justusbunsi/gitea-sonarqube-bot/internal/clients/gitea"
+	sqSdk "codeberg.org/justusbunsi/gitea-sonarqube-bot/internal/clients/sonarqube"
+	"codeberg.org/justusbunsi/gitea-sonarqube-bot/internal/queue"
+	"codeberg.org/justusbunsi/gitea-sonarqube-bot/internal/settings"
+	"github.com/stretchr/testify/assert"
+)
+
+type GiteaSdkMock struct {
+	giteaSdk.GiteaSdkInterface
+	err error
+}
+
+func (m *GiteaSdkMock) GetBotUser(_ context.Context) (string, error) {
+	return "sonarqube-bot", m.err
+}
+
+type SQSdkMock struct {
+	sqSdk.SonarQubeSdkInterface
+	status string
+	err    error
+}
+
+func (m *SQSdkMock) GetSystemStatus(_ context.Context) (string, error) {
+	return m.status, m.err
+}
+
+func TestChecker(t *testing.T) {
+	t.Run("Pending before first run", func(t *testing.T) {
+		c := NewChecker(time.Second, Gitea(&GiteaSdkMock{}))
+
+		ready, results := c.Ready()
+		assert.False(t, ready)
+		assert.Equal(t, StatusPending, results["gitea"].Status)
+	})
+
+	t.Run("Ready", func(t *testing.T) {
+		c := NewChecker(time.Second, Gitea(&GiteaSdkMock{}), SonarQube(&SQSdkMock{status: "UP"}))
+		c.RunOnce(context.Background())
+
+		ready, results := c.Ready()
+		assert.True(t, ready)
+		assert.Equal(t, StatusOk, results["gitea"].Status)
+		assert.Equal(t, StatusOk, results["sonarqube"].Status)
+		assert.NotNil(t, results["gitea"].CheckedAt)
+	})
+
+	t.Run("Failing", func(t *testing.T) {
+		c := NewChecker(time.Second, Gitea(&GiteaSdkMock{err: errors.New("401 Unauthorized")}), SonarQube(&SQSdkMock{status: "UP"}))
+		c.RunOnce(context.Background())
+
+		ready, results := c.Ready()
+		assert.False(t, ready)
+		assert.Equal(t, StatusFailing, results["gitea"].Status)
+		assert.Equal(t, "401 Unauthorized", results["gitea"].Error)
+		assert.Equal(t, StatusOk, results["sonarqube"].Status)
+	})
+
+	t.Run("Timeout", func(t *testing.T) {
+		c := NewChecker(10*time.Millisecond, Check{
+			Name: "slow",
+			Run: func(ctx context.Context) error {
+				<-ctx.Done()
+				return ctx.Err()
+			},
+		})
+		c.RunOnce(context.Background())
+
+		_, results := c.Ready()
+		assert.Equal(t, "context deadline exceeded", results["slow"].Error)
+	})
+
+	t.Run("Periodic", func(t *testing.T) {
+		runs := make(chan struct{}, 10)
+		c := NewChecker(time.Second, Check{
+			Name: "counting",
+			Run: func(_ context.Context) error {
+				runs <- struct{}{}
+				return nil
+			},
+		})
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		c.Start(ctx, 5*time.Millisecond)
+
+		<-runs
+		<-runs
+	})
+}
+
+func TestSonarQube(t *testing.T) {
+	assert.Nil(t, SonarQube(&SQSdkMock{status: "UP"}).Run(context.Background()))
+	assert.EqualError(t, SonarQube(&SQSdkMock{status: "STARTING"}).Run(context.Background()), "system status is STARTING")
+	assert.EqualError(t, SonarQube(&SQSdkMock{err: errors.New("connection refused")}).Run(context.Background()), "connection refused")
+}
+
+func TestConfig(t *testing.T) {
+	settings.Current().Projects = []settings.Project{}
+	assert.EqualError(t, Config().Run(context.Background()), "no project mapping loaded")
+
+	settings.Current().Projects = []settings.Project{{Gitea: settings.GiteaRepository{Owner: "test-owner", Name: "test-repo"}}}
+	assert.Nil(t, Config().Run(context.Background()))
+}
+
+type QueueMock struct {
+	stats queue.Stats
+}
+
+func (m *QueueMock) Stats() queue.Stats {
+	return m.stats
+}
+
+func TestQueue(t *testing.T) {
+	assert.Nil(t, Queue(&QueueMock{stats: queue.Stats{Pending: 99, Capacity: 100}}).Run(context.Background()))
+	assert.EqualError(t, Queue(&QueueMock{stats: queue.Stats{Pending: 100, Capacity: 100}}).Run(context.Background()), "job queue is saturated with 100 pending and 0 waiting jobs")
+	assert.EqualError(t, Queue(&QueueMock{stats: queue.Stats{Pending: 40, Waiting: 60, Capacity: 100}}).Run(context.Background()), "job queue is saturated with 40 pending and 60 waiting jobs")
+}
@@ -0,0 +1,92 @@
+package logging
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+)
+
+type contextKey struct{}
+
+// DeliveryKey is the attribute name of the webhook delivery ID in log records.
+const DeliveryKey = "delivery"
+
+// WithDeliveryID returns a context carrying the delivery ID that is added to all log records written with it.
+func WithDeliveryID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, contextKey{}, id)
+}
+
+// DeliveryID returns the delivery ID of the context or an empty string.
+func DeliveryID(ctx context.Context) string {
+	id, _ := ctx.Value(contextKey{}).(string)
+	return id
+}
+
+// NewDeliveryID generates a random ID for webhooks that are sent without one.
+func NewDeliveryID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+
+	return hex.EncodeToString(b)
+}
+
+// contextHandler adds the delivery ID of the context to every record.
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h contextHandler) Handle(ctx context.Context, r slog.Record) error {
+	if id := DeliveryID(ctx); id != "" {
+		r.AddAttrs(slog.String(DeliveryKey, id))
+	}
+
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return contextHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h contextHandler) WithGroup(name string) slog.Handler {
+	return contextHandler{h.Handler.WithGroup(name)}
+}
+
+// NewLogger creates a logger writing records of at least the given level in text or json format.
+func NewLogger(w io.Writer, format string, level string) (*slog.Logger, error) {
+	var l slog.Level
+	if err := l.UnmarshalText([]byte(level)); err != nil {
+		return nil, fmt.Errorf("invalid log level '%s'", level)
+	}
+
+	options := &slog.HandlerOptions{
+		Level: l,
+	}
+
+	var handler slog.Handler
+	switch strings.ToLower(format) {
+	case "text":
+		handler = slog.NewTextHandler(w, options)
+	case "json":
+		handler = slog.NewJSONHandler(w, options)
+	default:
+		return nil, fmt.Errorf("invalid log format '%s', expected text or json", format)
+	}
+
+	return slog.New(contextHandler{handler}), nil
+}
+
+// Setup replaces the default logger. Output of the standard log package is passed through it as well.
+func Setup(w io.Writer, format string, level string) error {
+	logger, err := NewLogger(w, format, level)
+	if err != nil {
+		return err
+	}
+
+	slog.SetDefault(logger)
+
+	return nil
+}
@@ -0,0 +1,55 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewLogger(t *testing.T) {
+	t.Run("JSON with delivery ID", func(t *testing.T) {
+		var buf bytes.Buffer
+		logger, err := NewLogger(&buf, "json", "info")
+		assert.Nil(t, err)
+
+		ctx := WithDeliveryID(context.Background(), "f6266f16-1d2b-4c23-b4b6-5a9f0d8e0a1c")
+		logger.InfoContext(ctx, "Processing data", "project", "test-project")
+
+		record := map[string]interface{}{}
+		assert.Nil(t, json.Unmarshal(buf.Bytes(), &record))
+		assert.Equal(t, "INFO", record["level"])
+		assert.Equal(t, "Processing data", record["msg"])
+		assert.Equal(t, "test-project", record["project"])
+		assert.Equal(t, "f6266f16-1d2b-4c23-b4b6-5a9f0d8e0a1c", record[DeliveryKey])
+	})
+
+	t.Run("Level filter", func(t *testing.T) {
+		var buf bytes.Buffer
+		logger, err := NewLogger(&buf, "text", "warn")
+		assert.Nil(t, err)
+
+		logger.Info("Hidden")
+		logger.With("component", "test").Warn("Shown")
+
+		assert.NotContains(t, buf.String(), "Hidden")
+		assert.Contains(t, buf.String(), "msg=Shown component=test")
+	})
+
+	t.Run("Invalid settings", func(t *testing.T) {
+		_, err := NewLogger(&bytes.Buffer{}, "xml", "info")
+		assert.EqualError(t, err, "invalid log format 'xml', expected text or json")
+
+		_, err = NewLogger(&bytes.Buffer{}, "text", "verbose")
+		assert.EqualError(t, err, "invalid log level 'verbose'")
+	})
+}
+
+func TestDeliveryID(t *testing.T) {
+	assert.Empty(t, DeliveryID(context.Background()))
+	assert.Equal(t, "1", DeliveryID(WithDeliveryID(context.Background(), "1")))
+	assert.Len(t, NewDeliveryID(), 32)
+	assert.NotEqual(t, NewDeliveryID(), NewDeliveryID())
+}
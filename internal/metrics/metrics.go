@@ -0,0 +1,132 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+)
+
+var (
+	registryMutex sync.Mutex
+	registry      []*Counter
+)
+
+// Counter is a monotonically increasing value per combination of label values, exposed in the Prometheus text format.
+type Counter struct {
+	name   string
+	help   string
+	labels []string
+	mutex  sync.Mutex
+	values map[string]float64
+}
+
+// Inc increments the counter for the given label values, which must match the labels of the counter in number and
+// order.
+func (c *Counter) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+func (c *Counter) Add(delta float64, labelValues ...string) {
+	if len(labelValues) != len(c.labels) {
+		panic(fmt.Sprintf("metric %s expects %d label values, got %d", c.name, len(c.labels), len(labelValues)))
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.values[c.series(labelValues)] += delta
+}
+
+// Value returns the current value for the given label values.
+func (c *Counter) Value(labelValues ...string) float64 {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return c.values[c.series(labelValues)]
+}
+
+func (c *Counter) series(labelValues []string) string {
+	if len(c.labels) == 0 {
+		return c.name
+	}
+
+	pairs := make([]string, len(c.labels))
+	for i, label := range c.labels {
+		pairs[i] = fmt.Sprintf(`%s="%s"`, label, escape(labelValues[i]))
+	}
+
+	return c.name + "{" + strings.Join(pairs, ",") + "}"
+}
+
+func (c *Counter) write(w io.Writer) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if _, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n", c.name, c.help, c.name); err != nil {
+		return err
+	}
+
+	series := make([]string, 0, len(c.values))
+	for s := range c.values {
+		series = append(series, s)
+	}
+	sort.Strings(series)
+
+	for _, s := range series {
+		if _, err := fmt.Fprintf(w, "%s %v\n", s, c.values[s]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escape(value string) string {
+	return labelEscaper.Replace(value)
+}
+
+// NewCounter creates a counter and registers it for being exposed by Write.
+func NewCounter(name string, help string, labels ...string) *Counter {
+	c := &Counter{
+		name:   name,
+		help:   help,
+		labels: labels,
+		values: map[string]float64{},
+	}
+
+	registryMutex.Lock()
+	defer registryMutex.Unlock()
+	registry = append(registry, c)
+
+	return c
+}
+
+// Write exposes all registered metrics in the Prometheus text format.
+func Write(w io.Writer) error {
+	registryMutex.Lock()
+	counters := append([]*Counter{}, registry...)
+	registryMutex.Unlock()
+
+	sort.Slice(counters, func(i, j int) bool { return counters[i].name < counters[j].name })
+
+	for _, c := range counters {
+		if err := c.write(w); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Handler serves all registered metrics.
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		_ = Write(w)
+	})
+}
@@ -0,0 +1,42 @@
+package metrics
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCounter(t *testing.T) {
+	t.Run("Labels", func(t *testing.T) {
+		c := NewCounter("test_labels_total", "Test counter.", "endpoint", "reason")
+		c.Inc("/hooks/gitea", "rate_limited")
+		c.Inc("/hooks/gitea", "rate_limited")
+		c.Inc("/hooks/sonarqube", "too \"large\"")
+
+		assert.Equal(t, float64(2), c.Value("/hooks/gitea", "rate_limited"))
+		assert.Equal(t, float64(0), c.Value("/hooks/gitea", "unknown"))
+
+		w := &bytes.Buffer{}
+		assert.Nil(t, c.write(w))
+		assert.Equal(t, `# HELP test_labels_total Test counter.
+# TYPE test_labels_total counter
+test_labels_total{endpoint="/hooks/gitea",reason="rate_limited"} 2
+test_labels_total{endpoint="/hooks/sonarqube",reason="too \"large\""} 1
+`, w.String())
+	})
+
+	t.Run("Label mismatch", func(t *testing.T) {
+		c := NewCounter("test_mismatch_total", "Test counter.", "endpoint")
+
+		assert.Panics(t, func() { c.Inc() })
+	})
+
+	t.Run("Registry", func(t *testing.T) {
+		NewCounter("test_registered_total", "Test counter.").Inc()
+
+		w := &bytes.Buffer{}
+		assert.Nil(t, Write(w))
+		assert.Contains(t, w.String(), "# TYPE test_registered_total counter\ntest_registered_total 1\n")
+	})
+}
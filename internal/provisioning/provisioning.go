@@ -0,0 +1,258 @@
+package provisioning
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	giteaSdk "codeberg.org/justusbunsi/gitea-sonarqube-bot/internal/clients/gitea"
+	sqSdk "codeberg.org/justusbunsi/gitea-sonarqube-bot/internal/clients/sonarqube"
+	"codeberg.org/justusbunsi/gitea-sonarqube-bot/internal/settings"
+)
+
+// HookName identifies the bot webhook in SonarQube.
+const HookName = "gitea-sonarqube-bot"
+
+// GiteaEvents are the repository events the bot needs to receive.
+var GiteaEvents = []string{"pull_request", "issue_comment"}
+
+type Action string
+
+const (
+	ActionNone   Action = "OK"
+	ActionCreate Action = "CREATE"
+	ActionUpdate Action = "UPDATE"
+	ActionFail   Action = "FAIL"
+)
+
+type Result struct {
+	Target string
+	Action Action
+	Drift  []string
+	Err    error
+	// DryRun is set if the drift was only reported
+	DryRun bool
+}
+
+type Report struct {
+	Results []Result
+}
+
+// Failed reports whether at least one webhook could not be reconciled.
+func (r *Report) Failed() bool {
+	for _, result := range r.Results {
+		if result.Err != nil {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (r *Report) String() string {
+	var b strings.Builder
+	for _, result := range r.Results {
+		action := string(result.Action)
+		if result.DryRun && (result.Action == ActionCreate || result.Action == ActionUpdate) {
+			action += " (dry run)"
+		}
+		fmt.Fprintf(&b, "%-18s %s", action, result.Target)
+		if result.Err != nil {
+			fmt.Fprintf(&b, ": %s", result.Err.Error())
+		} else if len(result.Drift) != 0 {
+			fmt.Fprintf(&b, ": %s", strings.Join(result.Drift, "; "))
+		}
+		b.WriteString("\n")
+	}
+
+	return b.String()
+}
+
+// Reconciler creates missing bot webhooks in Gitea and SonarQube and fixes drifted ones.
+type Reconciler struct {
+	giteaSdk giteaSdk.GiteaSdkInterface
+	sqSdk    sqSdk.SonarQubeSdkInterface
+	baseUrl  string
+	// dryRun reports whether the webhooks of a project must not be written
+	dryRun func(settings.GiteaRepository) bool
+}
+
+// Run reconciles the webhooks of all given projects. For projects in dry run mode, drift is only reported and neither
+// Gitea nor SonarQube are written.
+func (r *Reconciler) Run(ctx context.Context, projects []settings.Project) *Report {
+	report := &Report{}
+
+	for _, p := range projects {
+		dryRun := r.dryRun(p.Gitea)
+		report.Results = append(report.Results, r.reconcileGitea(ctx, p.Gitea, dryRun), r.reconcileSonarQube(ctx, p.SonarQube.Key, dryRun))
+	}
+
+	return report
+}
+
+func (r *Reconciler) reconcileGitea(ctx context.Context, repo settings.GiteaRepository, dryRun bool) Result {
+	result := Result{
+		Target: fmt.Sprintf("Gitea webhook of '%s/%s'", repo.Owner, repo.Name),
+		DryRun: dryRun,
+	}
+
+	hooks, err := r.giteaSdk.ListHooks(ctx, repo)
+	if err != nil {
+		return fail(result, err)
+	}
+
+	desired := giteaSdk.Hook{
+		Url:         r.baseUrl + "/hooks/gitea",
+		ContentType: "json",
+		Events:      GiteaEvents,
+		Active:      true,
+	}
+
+	var existing *giteaSdk.Hook
+	for i, h := range hooks {
+		if h.Url == desired.Url {
+			existing = &hooks[i]
+			break
+		}
+	}
+
+	if existing == nil {
+		result.Action = ActionCreate
+		result.Drift = []string{"missing"}
+		if !dryRun {
+			err = r.giteaSdk.CreateHook(ctx, repo, desired, settings.Current().Gitea.Webhook.Secret)
+		}
+		return failOnError(result, err)
+	}
+
+	if existing.ContentType != desired.ContentType {
+		result.Drift = append(result.Drift, fmt.Sprintf("content type is '%s'", existing.ContentType))
+	}
+
+	// Additional events configured by hand are kept
+	desired.Events = append([]string{}, existing.Events...)
+	for _, e := range GiteaEvents {
+		if !contains(existing.Events, e) {
+			result.Drift = append(result.Drift, fmt.Sprintf("event '%s' not subscribed", e))
+			desired.Events = append(desired.Events, e)
+		}
+	}
+
+	if !existing.Active {
+		result.Drift = append(result.Drift, "inactive")
+	}
+
+	if len(result.Drift) == 0 {
+		result.Action = ActionNone
+		return result
+	}
+
+	result.Action = ActionUpdate
+	if !dryRun {
+		desired.ID = existing.ID
+		err = r.giteaSdk.EditHook(ctx, repo, desired, settings.Current().Gitea.Webhook.Secret)
+	}
+
+	return failOnError(result, err)
+}
+
+func (r *Reconciler) reconcileSonarQube(ctx context.Context, project string, dryRun bool) Result {
+	result := Result{
+		Target: fmt.Sprintf("SonarQube webhook of '%s'", project),
+		DryRun: dryRun,
+	}
+
+	hooks, err := r.sqSdk.ListWebhooks(ctx, project)
+	if err != nil {
+		return fail(result, err)
+	}
+
+	desired := sqSdk.Webhook{
+		Name: HookName,
+		Url:  r.baseUrl + "/hooks/sonarqube",
+	}
+	secret := settings.Current().SonarQube.Webhook.Secret
+
+	var existing *sqSdk.Webhook
+	for i, h := range hooks {
+		if h.Url == desired.Url {
+			existing = &hooks[i]
+			break
+		}
+		if h.Name == desired.Name && existing == nil {
+			existing = &hooks[i]
+		}
+	}
+
+	if existing == nil {
+		result.Action = ActionCreate
+		result.Drift = []string{"missing"}
+		if !dryRun {
+			err = r.sqSdk.CreateWebhook(ctx, project, desired, secret)
+		}
+		return failOnError(result, err)
+	}
+
+	if existing.Url != desired.Url {
+		result.Drift = append(result.Drift, fmt.Sprintf("url is '%s'", existing.Url))
+	}
+
+	// Older SonarQube versions do not tell whether a secret is set
+	if existing.HasSecret != nil {
+		if *existing.HasSecret && secret == "" {
+			result.Drift = append(result.Drift, "secret set but not configured in the bot")
+		}
+		if !*existing.HasSecret && secret != "" {
+			result.Drift = append(result.Drift, "secret missing")
+		}
+	}
+
+	if len(result.Drift) == 0 {
+		result.Action = ActionNone
+		return result
+	}
+
+	result.Action = ActionUpdate
+	if !dryRun {
+		desired.Key = existing.Key
+		desired.Name = existing.Name
+		err = r.sqSdk.UpdateWebhook(ctx, desired, secret)
+	}
+
+	return failOnError(result, err)
+}
+
+func fail(result Result, err error) Result {
+	result.Action = ActionFail
+	result.Err = err
+
+	return result
+}
+
+func failOnError(result Result, err error) Result {
+	if err != nil {
+		return fail(result, err)
+	}
+
+	return result
+}
+
+func contains(list []string, value string) bool {
+	for _, v := range list {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
+
+// New creates a reconciler that only reports drift for the projects dryRun applies to.
+func New(g giteaSdk.GiteaSdkInterface, sq sqSdk.SonarQubeSdkInterface, baseUrl string, dryRun func(settings.GiteaRepository) bool) *Reconciler {
+	return &Reconciler{
+		giteaSdk: g,
+		sqSdk:    sq,
+		baseUrl:  strings.TrimSuffix(baseUrl, "/"),
+		dryRun:   dryRun,
+	}
+}
@@ -0,0 +1,213 @@
+package provisioning
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	giteaSdk "codeberg.org/justusbunsi/gitea-sonarqube-bot/internal/clients/gitea"
+	sqSdk "codeberg.org/justusbunsi/gitea-sonarqube-bot/internal/clients/sonarqube"
+	"codeberg.org/justusbunsi/gitea-sonarqube-bot/internal/settings"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+type GiteaSdkMock struct {
+	giteaSdk.GiteaSdkInterface
+	hooks   []giteaSdk.Hook
+	listErr error
+	mock.Mock
+}
+
+func (m *GiteaSdkMock) ListHooks(_ context.Context, _ settings.GiteaRepository) ([]giteaSdk.Hook, error) {
+	return m.hooks, m.listErr
+}
+
+func (m *GiteaSdkMock) CreateHook(_ context.Context, repo settings.GiteaRepository, hook giteaSdk.Hook, secret string) error {
+	m.Called(repo, hook, secret)
+	return nil
+}
+
+func (m *GiteaSdkMock) EditHook(_ context.Context, repo settings.GiteaRepository, hook giteaSdk.Hook, secret string) error {
+	m.Called(repo, hook, secret)
+	return nil
+}
+
+type SQSdkMock struct {
+	sqSdk.SonarQubeSdkInterface
+	hooks []sqSdk.Webhook
+	mock.Mock
+}
+
+func (m *SQSdkMock) ListWebhooks(_ context.Context, _ string) ([]sqSdk.Webhook, error) {
+	return m.hooks, nil
+}
+
+func (m *SQSdkMock) CreateWebhook(_ context.Context, project string, hook sqSdk.Webhook, secret string) error {
+	m.Called(project, hook, secret)
+	return nil
+}
+
+func (m *SQSdkMock) UpdateWebhook(_ context.Context, hook sqSdk.Webhook, secret string) error {
+	m.Called(hook, secret)
+	return nil
+}
+
+var projects = []settings.Project{
+	{
+		SonarQube: struct{ Key string }{
+			Key: "test-project",
+		},
+		Gitea: settings.GiteaRepository{
+			Owner: "test-owner",
+			Name:  "test-repo",
+		},
+	},
+}
+
+func never(_ settings.GiteaRepository) bool {
+	return false
+}
+
+func always(_ settings.GiteaRepository) bool {
+	return true
+}
+
+func withSecrets(t *testing.T) {
+	settings.Current().Gitea = settings.GiteaConfig{
+		Webhook: &settings.Webhook{Secret: "gitea-secret"},
+	}
+	settings.Current().SonarQube = settings.SonarQubeConfig{
+		Webhook: &settings.Webhook{Secret: "sonarqube-secret"},
+	}
+
+	t.Cleanup(func() {
+		settings.Current().Gitea = settings.GiteaConfig{}
+		settings.Current().SonarQube = settings.SonarQubeConfig{}
+	})
+}
+
+func TestRun(t *testing.T) {
+	t.Run("Create missing webhooks", func(t *testing.T) {
+		withSecrets(t)
+		g := &GiteaSdkMock{}
+		g.On("CreateHook", projects[0].Gitea, giteaSdk.Hook{
+			Url:         "https://bot.example.com/hooks/gitea",
+			ContentType: "json",
+			Events:      []string{"pull_request", "issue_comment"},
+			Active:      true,
+		}, "gitea-secret").Once()
+		sq := &SQSdkMock{}
+		sq.On("CreateWebhook", "test-project", sqSdk.Webhook{
+			Name: "gitea-sonarqube-bot",
+			Url:  "https://bot.example.com/hooks/sonarqube",
+		}, "sonarqube-secret").Once()
+
+		report := New(g, sq, "https://bot.example.com/", never).Run(context.Background(), projects)
+
+		assert.False(t, report.Failed())
+		assert.Equal(t, `CREATE             Gitea webhook of 'test-owner/test-repo': missing
+CREATE             SonarQube webhook of 'test-project': missing
+`, report.String())
+		g.AssertExpectations(t)
+		sq.AssertExpectations(t)
+	})
+
+	t.Run("Up to date", func(t *testing.T) {
+		withSecrets(t)
+		hasSecret := true
+		g := &GiteaSdkMock{hooks: []giteaSdk.Hook{
+			{ID: 3, Url: "https://bot.example.com/hooks/gitea", ContentType: "json", Events: []string{"issue_comment", "pull_request"}, Active: true},
+		}}
+		sq := &SQSdkMock{hooks: []sqSdk.Webhook{
+			{Key: "AU-Tpxb", Name: "gitea-sonarqube-bot", Url: "https://bot.example.com/hooks/sonarqube", HasSecret: &hasSecret},
+		}}
+
+		report := New(g, sq, "https://bot.example.com", never).Run(context.Background(), projects)
+
+		assert.Equal(t, `OK                 Gitea webhook of 'test-owner/test-repo'
+OK                 SonarQube webhook of 'test-project'
+`, report.String())
+		g.AssertNotCalled(t, "EditHook")
+		sq.AssertNotCalled(t, "UpdateWebhook")
+	})
+
+	t.Run("Update drifted webhooks", func(t *testing.T) {
+		withSecrets(t)
+		hasSecret := false
+		g := &GiteaSdkMock{hooks: []giteaSdk.Hook{
+			{ID: 3, Url: "https://bot.example.com/hooks/gitea", ContentType: "form", Events: []string{"push", "pull_request"}, Active: false},
+		}}
+		g.On("EditHook", projects[0].Gitea, giteaSdk.Hook{
+			ID:          3,
+			Url:         "https://bot.example.com/hooks/gitea",
+			ContentType: "json",
+			Events:      []string{"push", "pull_request", "issue_comment"},
+			Active:      true,
+		}, "gitea-secret").Once()
+		sq := &SQSdkMock{hooks: []sqSdk.Webhook{
+			{Key: "AU-Tpxb", Name: "gitea-sonarqube-bot", Url: "https://old.example.com/hooks/sonarqube", HasSecret: &hasSecret},
+		}}
+		sq.On("UpdateWebhook", sqSdk.Webhook{
+			Key:  "AU-Tpxb",
+			Name: "gitea-sonarqube-bot",
+			Url:  "https://bot.example.com/hooks/sonarqube",
+		}, "sonarqube-secret").Once()
+
+		report := New(g, sq, "https://bot.example.com", never).Run(context.Background(), projects)
+
+		assert.Equal(t, `UPDATE             Gitea webhook of 'test-owner/test-repo': content type is 'form'; event 'issue_comment' not subscribed; inactive
+UPDATE             SonarQube webhook of 'test-project': url is 'https://old.example.com/hooks/sonarqube'; secret missing
+`, report.String())
+		g.AssertExpectations(t)
+		sq.AssertExpectations(t)
+	})
+
+	t.Run("Dry run", func(t *testing.T) {
+		withSecrets(t)
+		g := &GiteaSdkMock{}
+		sq := &SQSdkMock{}
+
+		report := New(g, sq, "https://bot.example.com", always).Run(context.Background(), projects)
+
+		assert.Equal(t, `CREATE (dry run)   Gitea webhook of 'test-owner/test-repo': missing
+CREATE (dry run)   SonarQube webhook of 'test-project': missing
+`, report.String())
+		g.AssertNotCalled(t, "CreateHook")
+		sq.AssertNotCalled(t, "CreateWebhook")
+	})
+
+	t.Run("Project in dry run", func(t *testing.T) {
+		withSecrets(t)
+		settings.Current().Projects = []settings.Project{
+			{Gitea: projects[0].Gitea, DryRun: true},
+		}
+		g := &GiteaSdkMock{}
+		sq := &SQSdkMock{}
+
+		report := New(g, sq, "https://bot.example.com", settings.IsDryRun).Run(context.Background(), projects)
+
+		assert.Equal(t, `CREATE (dry run)   Gitea webhook of 'test-owner/test-repo': missing
+CREATE (dry run)   SonarQube webhook of 'test-project': missing
+`, report.String())
+		g.AssertNotCalled(t, "CreateHook")
+		sq.AssertNotCalled(t, "CreateWebhook")
+
+		t.Cleanup(func() {
+			settings.Current().Projects = nil
+		})
+	})
+
+	t.Run("API error", func(t *testing.T) {
+		withSecrets(t)
+		g := &GiteaSdkMock{listErr: errors.New("403 Forbidden")}
+		sq := &SQSdkMock{}
+		sq.On("CreateWebhook", mock.Anything, mock.Anything, mock.Anything).Once()
+
+		report := New(g, sq, "https://bot.example.com", never).Run(context.Background(), projects)
+
+		assert.True(t, report.Failed())
+		assert.Equal(t, "FAIL               Gitea webhook of 'test-owner/test-repo': 403 Forbidden\n", report.String()[:strings.Index(report.String(), "\n")+1])
+	})
+}
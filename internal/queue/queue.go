@@ -0,0 +1,311 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sort"
+	"sync"
+	"time"
+
+	"codeberg.org/justusbunsi/gitea-sonarqube-bot/internal/deliveries"
+	"codeberg.org/justusbunsi/gitea-sonarqube-bot/internal/logging"
+)
+
+var (
+	ErrFull     = errors.New("job queue is full")
+	ErrNotFound = errors.New("job not found")
+	ErrClosed   = errors.New("job queue is shut down")
+)
+
+type Job struct {
+	ID       int64  `json:"id"`
+	Delivery string `json:"delivery,omitempty"`
+	// Record is the ID of the delivery log entry of the webhook that scheduled the job
+	Record     string    `json:"record,omitempty"`
+	Key        string    `json:"key,omitempty"`
+	Name       string    `json:"name"`
+	EnqueuedAt time.Time `json:"enqueuedAt"`
+	Attempts   int       `json:"attempts"`
+	LastError  string    `json:"lastError,omitempty"`
+	ctx        context.Context
+	run        func(context.Context) error
+}
+
+type Stats struct {
+	// Jobs waiting for a worker
+	Pending int `json:"pending"`
+	// Jobs taken by a worker, but waiting for the running job of their key. Like pending jobs, they occupy the
+	// capacity of the queue.
+	Waiting     int `json:"waiting"`
+	Running     int `json:"running"`
+	Capacity    int `json:"capacity"`
+	DeadLetters int `json:"deadLetters"`
+}
+
+// Queue processes jobs by a fixed number of workers. Failed jobs are not retried automatically, as most of them
+// already wrote to Gitea. They are kept as dead letters to be inspected and retried manually.
+//
+// Jobs with the same key, e.g. for the same pull request, never run concurrently. They run one after another in the
+// order they reach a worker, which is not necessarily the order they were enqueued.
+type Queue struct {
+	jobs           chan *Job
+	maxDeadLetters int
+	mutex          sync.Mutex
+	lastID         int64
+	pending        map[int64]*Job
+	running        int
+	deadLetters    []*Job
+	onComplete     func(Job, error)
+	// Jobs waiting for the running job of their key. An entry exists as long as a job of the key is running.
+	waiting map[string][]*Job
+	// Accepted jobs that did not finish yet
+	unfinished sync.WaitGroup
+	closed     bool
+	// ctx is the parent of all running jobs. It is cancelled when Shutdown gives up waiting for them.
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// OnComplete registers a function called after each run of a job.
+func (q *Queue) OnComplete(fn func(Job, error)) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	q.onComplete = fn
+}
+
+// Enqueue schedules the job. It runs detached from cancellation of ctx, but keeps its values like the delivery ID and
+// the delivery log entry. Running jobs are cancelled if Shutdown times out.
+// An empty key does not serialize the job with others.
+func (q *Queue) Enqueue(ctx context.Context, key string, name string, run func(context.Context) error) (*Job, error) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	q.lastID++
+	job := &Job{
+		ID:         q.lastID,
+		Delivery:   logging.DeliveryID(ctx),
+		Record:     deliveries.RecordID(ctx),
+		Key:        key,
+		Name:       name,
+		EnqueuedAt: time.Now(),
+		ctx:        context.WithoutCancel(ctx),
+		run:        run,
+	}
+
+	if err := q.push(job); err != nil {
+		return nil, err
+	}
+
+	return job, nil
+}
+
+func (q *Queue) push(job *Job) error {
+	if q.closed {
+		return ErrClosed
+	}
+
+	// Jobs waiting for their key left the channel already, but still count against the capacity
+	if len(q.pending) >= cap(q.jobs) {
+		return ErrFull
+	}
+
+	select {
+	case q.jobs <- job:
+		q.pending[job.ID] = job
+		q.unfinished.Add(1)
+		return nil
+	default:
+		return ErrFull
+	}
+}
+
+// Retry moves a dead letter back into the queue.
+func (q *Queue) Retry(id int64) (*Job, error) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	for i, job := range q.deadLetters {
+		if job.ID != id {
+			continue
+		}
+
+		if err := q.push(job); err != nil {
+			return nil, err
+		}
+		q.deadLetters = append(q.deadLetters[:i], q.deadLetters[i+1:]...)
+
+		return job.copy(), nil
+	}
+
+	return nil, ErrNotFound
+}
+
+// Pending returns the jobs that did not start yet, oldest first. This includes jobs waiting for their key.
+func (q *Queue) Pending() []Job {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	jobs := make([]Job, 0, len(q.pending))
+	for _, job := range q.pending {
+		jobs = append(jobs, *job.copy())
+	}
+	sort.Slice(jobs, func(i, j int) bool { return jobs[i].ID < jobs[j].ID })
+
+	return jobs
+}
+
+// DeadLetters returns the failed jobs, oldest first.
+func (q *Queue) DeadLetters() []Job {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	jobs := make([]Job, 0, len(q.deadLetters))
+	for _, job := range q.deadLetters {
+		jobs = append(jobs, *job.copy())
+	}
+
+	return jobs
+}
+
+func (q *Queue) Stats() Stats {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	waiting := 0
+	for _, jobs := range q.waiting {
+		waiting += len(jobs)
+	}
+
+	return Stats{
+		Pending:     len(q.jobs),
+		Waiting:     waiting,
+		Running:     q.running,
+		Capacity:    cap(q.jobs),
+		DeadLetters: len(q.deadLetters),
+	}
+}
+
+// Shutdown stops accepting jobs and waits until all accepted jobs finished or the context is done. Then, running jobs
+// are cancelled. The workers must keep running meanwhile.
+func (q *Queue) Shutdown(ctx context.Context) error {
+	q.mutex.Lock()
+	q.closed = true
+	q.mutex.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		q.unfinished.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		q.cancel()
+		return ctx.Err()
+	}
+}
+
+// Start runs the given number of workers until the context is cancelled. Jobs still waiting are dropped then, use
+// Shutdown to process them before.
+func (q *Queue) Start(ctx context.Context, workers int) {
+	for i := 0; i < workers; i++ {
+		go func() {
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case job := <-q.jobs:
+					q.process(job)
+				}
+			}
+		}()
+	}
+}
+
+// process runs the job unless another job of its key is running. Then the job is handed over to the worker of that
+// job, which runs it afterwards.
+func (q *Queue) process(job *Job) {
+	q.mutex.Lock()
+	if job.Key != "" {
+		if waiting, busy := q.waiting[job.Key]; busy {
+			q.waiting[job.Key] = append(waiting, job)
+			q.mutex.Unlock()
+			return
+		}
+		q.waiting[job.Key] = []*Job{}
+	}
+	q.mutex.Unlock()
+
+	for job != nil {
+		job = q.run(job)
+	}
+}
+
+// run runs the job and returns the next one waiting for its key.
+func (q *Queue) run(job *Job) *Job {
+	q.mutex.Lock()
+	delete(q.pending, job.ID)
+	q.running++
+	job.Attempts++
+	q.mutex.Unlock()
+
+	ctx, cancel := context.WithCancel(job.ctx)
+	stop := context.AfterFunc(q.ctx, cancel)
+	err := job.run(ctx)
+	stop()
+	cancel()
+
+	q.mutex.Lock()
+	q.running--
+	job.LastError = ""
+	if err != nil {
+		slog.ErrorContext(job.ctx, "Job failed", "job", job.ID, "name", job.Name, "error", err)
+		job.LastError = err.Error()
+		q.deadLetters = append(q.deadLetters, job)
+		if len(q.deadLetters) > q.maxDeadLetters {
+			q.deadLetters = q.deadLetters[1:]
+		}
+	}
+
+	var next *Job
+	if job.Key != "" {
+		if waiting := q.waiting[job.Key]; len(waiting) != 0 {
+			next = waiting[0]
+			q.waiting[job.Key] = waiting[1:]
+		} else {
+			delete(q.waiting, job.Key)
+		}
+	}
+	completed, onComplete := *job.copy(), q.onComplete
+	q.mutex.Unlock()
+
+	if onComplete != nil {
+		onComplete(completed, err)
+	}
+	q.unfinished.Done()
+
+	return next
+}
+
+func (j *Job) copy() *Job {
+	c := *j
+	return &c
+}
+
+// New creates a queue holding up to size jobs that did not start yet and the latest maxDeadLetters failed ones.
+func New(size int, maxDeadLetters int) *Queue {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	return &Queue{
+		ctx:            ctx,
+		cancel:         cancel,
+		jobs:           make(chan *Job, size),
+		maxDeadLetters: maxDeadLetters,
+		pending:        map[int64]*Job{},
+		waiting:        map[string][]*Job{},
+	}
+}
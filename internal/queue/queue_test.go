@@ -0,0 +1,260 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"codeberg.org/justusbunsi/gitea-sonarqube-bot/internal/deliveries"
+	"codeberg.org/justusbunsi/gitea-sonarqube-bot/internal/logging"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQueue(t *testing.T) {
+	t.Run("Process", func(t *testing.T) {
+		q := New(10, 10)
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		q.Start(ctx, 2)
+
+		done := make(chan string)
+		reqCtx, reqCancel := context.WithCancel(logging.WithDeliveryID(context.Background(), "test-delivery"))
+		job, err := q.Enqueue(reqCtx, "", "test", func(ctx context.Context) error {
+			// Jobs outlive the request they were created for
+			assert.Nil(t, ctx.Err())
+			done <- logging.DeliveryID(ctx)
+			return nil
+		})
+		reqCancel()
+
+		assert.Nil(t, err)
+		assert.Equal(t, "test-delivery", job.Delivery)
+		assert.Equal(t, "test-delivery", <-done)
+	})
+
+	t.Run("Completion callback", func(t *testing.T) {
+		q := New(10, 10)
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		type completion struct {
+			job Job
+			err error
+		}
+		completed := make(chan completion, 1)
+		q.OnComplete(func(job Job, err error) {
+			completed <- completion{job, err}
+		})
+		q.Start(ctx, 1)
+
+		reqCtx := deliveries.WithRecordID(logging.WithDeliveryID(context.Background(), "test-delivery"), "test-record")
+		_, _ = q.Enqueue(reqCtx, "", "test", func(_ context.Context) error {
+			return errors.New("Gitea unreachable")
+		})
+
+		c := <-completed
+		assert.EqualError(t, c.err, "Gitea unreachable")
+		assert.Equal(t, "test-delivery", c.job.Delivery)
+		assert.Equal(t, "test-record", c.job.Record)
+		assert.Equal(t, "Gitea unreachable", c.job.LastError)
+	})
+
+	t.Run("Serialized by key", func(t *testing.T) {
+		q := New(10, 10)
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		release := make(chan struct{})
+		started := make(chan string, 3)
+		block := func(name string) func(context.Context) error {
+			return func(_ context.Context) error {
+				started <- name
+				<-release
+				return nil
+			}
+		}
+
+		_, _ = q.Enqueue(context.Background(), "owner/repo#1", "first", block("first"))
+		_, _ = q.Enqueue(context.Background(), "owner/repo#1", "second", block("second"))
+		_, _ = q.Enqueue(context.Background(), "owner/repo#2", "other", block("other"))
+		q.Start(ctx, 3)
+
+		// Workers may take jobs of the same key in any order
+		running := []string{<-started, <-started}
+		assert.Contains(t, running, "other")
+		assert.Eventually(t, func() bool {
+			return q.Stats() == Stats{Waiting: 1, Running: 2, Capacity: 10}
+		}, time.Second, 10*time.Millisecond)
+		assert.Empty(t, started)
+
+		close(release)
+		assert.ElementsMatch(t, []string{"first", "second", "other"}, append(running, <-started))
+		assert.Eventually(t, func() bool {
+			return q.Stats() == Stats{Capacity: 10}
+		}, time.Second, 10*time.Millisecond)
+	})
+
+	t.Run("Waiting jobs occupy capacity", func(t *testing.T) {
+		q := New(1, 10)
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		q.Start(ctx, 2)
+
+		release := make(chan struct{})
+		defer close(release)
+		block := func(_ context.Context) error {
+			<-release
+			return nil
+		}
+
+		_, _ = q.Enqueue(context.Background(), "owner/repo#1", "first", block)
+		assert.Eventually(t, func() bool { return q.Stats().Running == 1 }, time.Second, 10*time.Millisecond)
+		_, _ = q.Enqueue(context.Background(), "owner/repo#1", "second", block)
+		assert.Eventually(t, func() bool { return q.Stats().Waiting == 1 }, time.Second, 10*time.Millisecond)
+
+		_, err := q.Enqueue(context.Background(), "owner/repo#1", "third", block)
+		assert.ErrorIs(t, err, ErrFull, "Waiting job bypassed the capacity")
+	})
+
+	t.Run("Full", func(t *testing.T) {
+		q := New(1, 10)
+
+		_, err := q.Enqueue(context.Background(), "", "first", func(_ context.Context) error { return nil })
+		assert.Nil(t, err)
+		_, err = q.Enqueue(context.Background(), "", "second", func(_ context.Context) error { return nil })
+		assert.ErrorIs(t, err, ErrFull)
+
+		assert.Equal(t, Stats{Pending: 1, Capacity: 1}, q.Stats())
+		pending := q.Pending()
+		assert.Len(t, pending, 1)
+		assert.Equal(t, "first", pending[0].Name)
+	})
+
+	t.Run("Shutdown", func(t *testing.T) {
+		q := New(10, 10)
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		q.Start(ctx, 1)
+
+		release := make(chan struct{})
+		finished := make(chan string, 2)
+		_, _ = q.Enqueue(context.Background(), "", "running", func(_ context.Context) error {
+			<-release
+			finished <- "running"
+			return nil
+		})
+		_, _ = q.Enqueue(context.Background(), "", "pending", func(_ context.Context) error {
+			finished <- "pending"
+			return nil
+		})
+
+		shutdown := make(chan error)
+		go func() { shutdown <- q.Shutdown(context.Background()) }()
+
+		assert.Eventually(t, func() bool {
+			_, err := q.Enqueue(context.Background(), "", "late", func(_ context.Context) error { return nil })
+			return errors.Is(err, ErrClosed)
+		}, time.Second, time.Millisecond)
+
+		close(release)
+		assert.Nil(t, <-shutdown)
+		assert.Equal(t, "running", <-finished)
+		assert.Equal(t, "pending", <-finished)
+	})
+
+	t.Run("Shutdown timeout", func(t *testing.T) {
+		q := New(10, 10)
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		q.Start(ctx, 1)
+
+		release := make(chan struct{})
+		defer close(release)
+		_, _ = q.Enqueue(context.Background(), "", "hanging", func(_ context.Context) error {
+			<-release
+			return nil
+		})
+
+		shutdownCtx, cancelShutdown := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancelShutdown()
+		assert.ErrorIs(t, q.Shutdown(shutdownCtx), context.DeadlineExceeded)
+	})
+
+	t.Run("Shutdown timeout cancels running jobs", func(t *testing.T) {
+		q := New(10, 10)
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		q.Start(ctx, 1)
+
+		requestCtx, cancelRequest := context.WithCancel(deliveries.WithRecordID(context.Background(), "test-record"))
+		started := make(chan struct{})
+		result := make(chan error, 1)
+		_, _ = q.Enqueue(requestCtx, "", "hanging", func(ctx context.Context) error {
+			close(started)
+			<-ctx.Done()
+			assert.Equal(t, "test-record", deliveries.RecordID(ctx), "Job context lost request values")
+			result <- ctx.Err()
+			return ctx.Err()
+		})
+		<-started
+		cancelRequest()
+
+		shutdownCtx, cancelShutdown := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancelShutdown()
+		assert.ErrorIs(t, q.Shutdown(shutdownCtx), context.DeadlineExceeded)
+
+		select {
+		case err := <-result:
+			assert.ErrorIs(t, err, context.Canceled)
+		case <-time.After(time.Second):
+			t.Fatal("Running job not cancelled")
+		}
+	})
+
+	t.Run("Dead letters", func(t *testing.T) {
+		q := New(10, 1)
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		q.Start(ctx, 1)
+
+		fail := func(_ context.Context) error { return errors.New("Gitea unreachable") }
+		first, _ := q.Enqueue(context.Background(), "", "first", fail)
+		second, _ := q.Enqueue(context.Background(), "", "second", fail)
+
+		assert.Eventually(t, func() bool {
+			dead := q.DeadLetters()
+			return len(dead) == 1 && dead[0].ID == second.ID
+		}, time.Second, time.Millisecond)
+
+		dead := q.DeadLetters()[0]
+		assert.Equal(t, 1, dead.Attempts)
+		assert.Equal(t, "Gitea unreachable", dead.LastError)
+
+		_, err := q.Retry(first.ID)
+		assert.ErrorIs(t, err, ErrNotFound)
+	})
+
+	t.Run("Retry", func(t *testing.T) {
+		q := New(10, 10)
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		q.Start(ctx, 1)
+
+		attempts := 0
+		job, _ := q.Enqueue(context.Background(), "", "flaky", func(_ context.Context) error {
+			attempts++
+			if attempts == 1 {
+				return errors.New("Gitea unreachable")
+			}
+			return nil
+		})
+		assert.Eventually(t, func() bool { return len(q.DeadLetters()) == 1 }, time.Second, time.Millisecond)
+
+		retried, err := q.Retry(job.ID)
+		assert.Nil(t, err)
+		assert.Equal(t, job.ID, retried.ID)
+		assert.Eventually(t, func() bool { return q.Stats() == Stats{Capacity: 10} }, time.Second, time.Millisecond)
+		assert.Empty(t, q.DeadLetters())
+	})
+}
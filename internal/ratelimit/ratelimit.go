@@ -0,0 +1,70 @@
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+type window struct {
+	start time.Time
+	count int
+}
+
+// Limiter counts requests per key in fixed time windows.
+type Limiter struct {
+	window    time.Duration
+	now       func() time.Time
+	mutex     sync.Mutex
+	windows   map[string]*window
+	nextPrune time.Time
+}
+
+// Allow counts a request for the key and reports whether it is within the limit of the current window. The limit is
+// passed on each call to follow configuration reloads. A limit of zero or less disables limiting.
+func (l *Limiter) Allow(key string, limit int) bool {
+	if limit <= 0 {
+		return true
+	}
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	now := l.now()
+	l.prune(now)
+
+	w, found := l.windows[key]
+	if !found || !now.Before(w.start.Add(l.window)) {
+		w = &window{start: now}
+		l.windows[key] = w
+	}
+
+	if w.count >= limit {
+		return false
+	}
+	w.count++
+
+	return true
+}
+
+// prune drops windows that ended, at most once per window duration.
+func (l *Limiter) prune(now time.Time) {
+	if now.Before(l.nextPrune) {
+		return
+	}
+
+	for key, w := range l.windows {
+		if !now.Before(w.start.Add(l.window)) {
+			delete(l.windows, key)
+		}
+	}
+	l.nextPrune = now.Add(l.window)
+}
+
+// New creates a limiter counting requests in windows of the given duration.
+func New(duration time.Duration) *Limiter {
+	return &Limiter{
+		window:  duration,
+		now:     time.Now,
+		windows: map[string]*window{},
+	}
+}
@@ -0,0 +1,44 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLimiter(t *testing.T) {
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	newLimiter := func() *Limiter {
+		l := New(time.Minute)
+		l.now = func() time.Time { return now }
+		return l
+	}
+
+	t.Run("Limit per key", func(t *testing.T) {
+		l := newLimiter()
+
+		assert.True(t, l.Allow("a", 2))
+		assert.True(t, l.Allow("a", 2))
+		assert.False(t, l.Allow("a", 2))
+		assert.True(t, l.Allow("b", 2))
+	})
+
+	t.Run("Next window", func(t *testing.T) {
+		l := newLimiter()
+		assert.True(t, l.Allow("a", 1))
+		assert.False(t, l.Allow("a", 1))
+
+		now = now.Add(time.Minute)
+
+		assert.True(t, l.Allow("a", 1))
+	})
+
+	t.Run("Disabled", func(t *testing.T) {
+		l := newLimiter()
+
+		for i := 0; i < 10; i++ {
+			assert.True(t, l.Allow("a", 0))
+		}
+	})
+}
@@ -0,0 +1,124 @@
+package review
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	giteaSdk "codeberg.org/justusbunsi/gitea-sonarqube-bot/internal/clients/gitea"
+	sqSdk "codeberg.org/justusbunsi/gitea-sonarqube-bot/internal/clients/sonarqube"
+	"codeberg.org/justusbunsi/gitea-sonarqube-bot/internal/settings"
+	"codeberg.org/justusbunsi/gitea-sonarqube-bot/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Result contains everything a review would write to Gitea.
+type Result struct {
+	HeadRef string
+	Status  giteaSdk.StatusDetails
+	Comment string
+}
+
+// Service runs the review pipeline of the `/sq-bot review` command for a single pull request.
+type Service struct {
+	giteaSdk giteaSdk.GiteaSdkInterface
+	sqSdk    sqSdk.SonarQubeSdkInterface
+}
+
+// Prepare fetches the SonarQube analysis of the pull request and composes status and comment without changing
+// anything in Gitea. If only composing the comment fails, the error is returned together with a result without comment.
+func (s *Service) Prepare(ctx context.Context, project settings.Project, index int64) (result *Result, err error) {
+	ctx, span := tracing.Start(ctx, "review.Prepare", trace.WithAttributes(
+		attribute.String("sonarqube.project", project.SonarQube.Key),
+		attribute.Int64("gitea.pull_request", index),
+	))
+	defer func() { tracing.End(span, err) }()
+
+	headRef, err := s.giteaSdk.DetermineHEAD(ctx, project.Gitea, index)
+	if err != nil {
+		return nil, fmt.Errorf("error retrieving HEAD ref: %w", err)
+	}
+
+	pr, err := s.sqSdk.GetPullRequest(ctx, project.SonarQube.Key, index)
+	if err != nil {
+		return nil, fmt.Errorf("error loading PR data from SonarQube: %w", err)
+	}
+
+	state := giteaSdk.StatusOK
+	if pr.Status.QualityGateStatus != "OK" {
+		state = giteaSdk.StatusFailure
+	}
+
+	url := s.sqSdk.GetPullRequestUrl(project.SonarQube.Key, index)
+
+	config := settings.Current()
+	result = &Result{
+		HeadRef: headRef,
+		Status: giteaSdk.StatusDetails{
+			Url:     url,
+			Message: pr.Status.QualityGateStatus,
+			State:   state,
+		},
+	}
+
+	result.Comment, err = s.sqSdk.ComposeGiteaComment(ctx, &sqSdk.CommentComposeData{
+		Key:            project.SonarQube.Key,
+		PRName:         sqSdk.PRNameFromIndex(index),
+		Url:            url,
+		QualityGate:    pr.Status.QualityGateStatus,
+		Metrics:        config.SonarQube.GetMetricGroups(&project),
+		Hotspots:       project.Hotspots,
+		Coverage:       project.Coverage,
+		Duplications:   project.Duplications,
+		PullRequestUrl: config.Gitea.GetPullRequestUrl(project.Gitea, index),
+		SourceUrl:      config.Gitea.GetSourceUrl(project.Gitea, headRef),
+	})
+	if err != nil {
+		return result, fmt.Errorf("error composing comment: %w", err)
+	}
+
+	return result, nil
+}
+
+// Apply sets the commit status and posts the comment of a prepared review. The comment is posted even if the status
+// cannot be updated. A review without comment only sets the status.
+func (s *Service) Apply(ctx context.Context, project settings.Project, index int64, r *Result) (err error) {
+	ctx, span := tracing.Start(ctx, "review.Apply", trace.WithAttributes(
+		attribute.String("gitea.repository", project.Gitea.Owner+"/"+project.Gitea.Name),
+		attribute.Int64("gitea.pull_request", index),
+	))
+	defer func() { tracing.End(span, err) }()
+
+	statusErr := s.giteaSdk.UpdateStatus(ctx, project.Gitea, r.HeadRef, r.Status)
+
+	if r.Comment != "" {
+		err = s.giteaSdk.PostComment(ctx, project.Gitea, int(index), r.Comment)
+		if err != nil {
+			return fmt.Errorf("error posting comment: %w", err)
+		}
+	}
+
+	if statusErr != nil {
+		return fmt.Errorf("error updating status: %w", statusErr)
+	}
+
+	return nil
+}
+
+// Run prepares and applies the review of a pull request. The commit status is set even if composing the comment failed.
+func (s *Service) Run(ctx context.Context, project settings.Project, index int64) error {
+	r, err := s.Prepare(ctx, project, index)
+	if r == nil {
+		return err
+	}
+
+	return errors.Join(err, s.Apply(ctx, project, index, r))
+}
+
+func NewService(g giteaSdk.GiteaSdkInterface, sq sqSdk.SonarQubeSdkInterface) *Service {
+	return &Service{
+		giteaSdk: g,
+		sqSdk:    sq,
+	}
+}
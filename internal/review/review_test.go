@@ -0,0 +1,154 @@
+package review
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	giteaSdk "codeberg.org/justusbunsi/gitea-sonarqube-bot/internal/clients/gitea"
+	sqSdk "codeberg.org/justusbunsi/gitea-sonarqube-bot/internal/clients/sonarqube"
+	"codeberg.org/justusbunsi/gitea-sonarqube-bot/internal/settings"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+type GiteaSdkMock struct {
+	giteaSdk.GiteaSdkInterface
+	statusErr error
+	mock.Mock
+}
+
+func (m *GiteaSdkMock) DetermineHEAD(_ context.Context, _ settings.GiteaRepository, _ int64) (string, error) {
+	return "a1aada0b7b19e58ae539b4812d960bca35ev78cb", nil
+}
+
+func (m *GiteaSdkMock) UpdateStatus(_ context.Context, repo settings.GiteaRepository, ref string, details giteaSdk.StatusDetails) error {
+	m.Called(repo, ref, details)
+	return m.statusErr
+}
+
+func (m *GiteaSdkMock) PostComment(_ context.Context, repo settings.GiteaRepository, idx int, msg string) error {
+	m.Called(repo, idx, msg)
+	return nil
+}
+
+type SQSdkMock struct {
+	sqSdk.SonarQubeSdkInterface
+	qualityGate string
+	prErr       error
+	commentErr  error
+}
+
+func (m *SQSdkMock) GetPullRequest(_ context.Context, _ string, _ int64) (*sqSdk.PullRequest, error) {
+	if m.prErr != nil {
+		return nil, m.prErr
+	}
+
+	pr := &sqSdk.PullRequest{}
+	pr.Status.QualityGateStatus = m.qualityGate
+	return pr, nil
+}
+
+func (m *SQSdkMock) GetPullRequestUrl(project string, index int64) string {
+	return "https://sonarqube.example.com/dashboard?id=test-project&pullRequest=PR-42"
+}
+
+func (m *SQSdkMock) ComposeGiteaComment(_ context.Context, data *sqSdk.CommentComposeData) (string, error) {
+	if m.commentErr != nil {
+		return "", m.commentErr
+	}
+	return "Quality gate: " + data.QualityGate, nil
+}
+
+var project = settings.Project{
+	SonarQube: struct{ Key string }{
+		Key: "test-project",
+	},
+	Gitea: settings.GiteaRepository{
+		Owner: "test-owner",
+		Name:  "test-repo",
+	},
+}
+
+func TestMain(m *testing.M) {
+	settings.Current().Pattern = &settings.PatternConfig{
+		Template: "PR-%d",
+	}
+	m.Run()
+}
+
+func TestPrepare(t *testing.T) {
+	t.Run("Failed quality gate", func(t *testing.T) {
+		g := &GiteaSdkMock{}
+		s := NewService(g, &SQSdkMock{qualityGate: "ERROR"})
+
+		actual, err := s.Prepare(context.Background(), project, 42)
+
+		assert.Nil(t, err)
+		assert.Equal(t, &Result{
+			HeadRef: "a1aada0b7b19e58ae539b4812d960bca35ev78cb",
+			Status: giteaSdk.StatusDetails{
+				Url:     "https://sonarqube.example.com/dashboard?id=test-project&pullRequest=PR-42",
+				Message: "ERROR",
+				State:   giteaSdk.StatusFailure,
+			},
+			Comment: "Quality gate: ERROR",
+		}, actual)
+		g.AssertNotCalled(t, "UpdateStatus")
+		g.AssertNotCalled(t, "PostComment")
+	})
+
+	t.Run("SonarQube error", func(t *testing.T) {
+		s := NewService(&GiteaSdkMock{}, &SQSdkMock{prErr: errors.New("Simulated error")})
+
+		_, err := s.Prepare(context.Background(), project, 42)
+
+		assert.EqualError(t, err, "error loading PR data from SonarQube: Simulated error")
+	})
+
+	t.Run("Comment error", func(t *testing.T) {
+		s := NewService(&GiteaSdkMock{}, &SQSdkMock{qualityGate: "ERROR", commentErr: errors.New("Simulated error")})
+
+		actual, err := s.Prepare(context.Background(), project, 42)
+
+		assert.EqualError(t, err, "error composing comment: Simulated error")
+		assert.Equal(t, giteaSdk.StatusFailure, actual.Status.State, "Status missing")
+		assert.Empty(t, actual.Comment)
+	})
+}
+
+func TestRun(t *testing.T) {
+	t.Run("Success", func(t *testing.T) {
+		g := &GiteaSdkMock{}
+		g.On("UpdateStatus", project.Gitea, "a1aada0b7b19e58ae539b4812d960bca35ev78cb", mock.MatchedBy(func(d giteaSdk.StatusDetails) bool {
+			return d.State == giteaSdk.StatusOK
+		})).Once()
+		g.On("PostComment", project.Gitea, 42, "Quality gate: OK").Once()
+		s := NewService(g, &SQSdkMock{qualityGate: "OK"})
+
+		assert.Nil(t, s.Run(context.Background(), project, 42))
+		g.AssertExpectations(t)
+	})
+
+	t.Run("Status error still posts comment", func(t *testing.T) {
+		g := &GiteaSdkMock{statusErr: errors.New("Simulated error")}
+		g.On("UpdateStatus", mock.Anything, mock.Anything, mock.Anything).Once()
+		g.On("PostComment", project.Gitea, 42, "Quality gate: OK").Once()
+		s := NewService(g, &SQSdkMock{qualityGate: "OK"})
+
+		assert.EqualError(t, s.Run(context.Background(), project, 42), "error updating status: Simulated error")
+		g.AssertExpectations(t)
+	})
+
+	t.Run("Comment error still updates status", func(t *testing.T) {
+		g := &GiteaSdkMock{}
+		g.On("UpdateStatus", project.Gitea, "a1aada0b7b19e58ae539b4812d960bca35ev78cb", mock.MatchedBy(func(d giteaSdk.StatusDetails) bool {
+			return d.State == giteaSdk.StatusFailure
+		})).Once()
+		s := NewService(g, &SQSdkMock{qualityGate: "ERROR", commentErr: errors.New("Simulated error")})
+
+		assert.EqualError(t, s.Run(context.Background(), project, 42), "error composing comment: Simulated error")
+		g.AssertExpectations(t)
+		g.AssertNotCalled(t, "PostComment")
+	})
+}
@@ -0,0 +1,56 @@
+package secrets
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+// Keyring reads secrets from the keyring of the operating system using its command line tools: `secret-tool` of
+// libsecret on Linux and `security` on macOS. References have the form "service/user". Other systems are not
+// supported.
+type Keyring struct {
+	goos string
+	run  func(ctx context.Context, name string, args ...string) ([]byte, error)
+}
+
+func NewKeyring() *Keyring {
+	return &Keyring{
+		goos: runtime.GOOS,
+		run: func(ctx context.Context, name string, args ...string) ([]byte, error) {
+			return exec.CommandContext(ctx, name, args...).Output()
+		},
+	}
+}
+
+func (k *Keyring) Resolve(ctx context.Context, reference string) (string, error) {
+	service, user, _ := strings.Cut(reference, "/")
+	if service == "" || user == "" {
+		return "", fmt.Errorf("invalid reference '%s', expected service/user", reference)
+	}
+
+	var name string
+	var args []string
+	switch k.goos {
+	case "linux", "freebsd", "openbsd", "netbsd":
+		name, args = "secret-tool", []string{"lookup", "service", service, "username", user}
+	case "darwin":
+		name, args = "security", []string{"find-generic-password", "-s", service, "-a", user, "-w"}
+	default:
+		return "", fmt.Errorf("keyring is not supported on %s", k.goos)
+	}
+
+	out, err := k.run(ctx, name, args...)
+	if err != nil {
+		return "", fmt.Errorf("cannot look up '%s': %w", reference, err)
+	}
+
+	value := strings.TrimSuffix(strings.TrimSuffix(string(out), "\n"), "\r")
+	if value == "" {
+		return "", fmt.Errorf("no secret found for '%s'", reference)
+	}
+
+	return value, nil
+}
@@ -0,0 +1,85 @@
+// Package secrets resolves secret references like "env:GITEA_TOKEN" or "file:/run/secrets/token" to their current
+// value. Values without a known scheme are used literally.
+package secrets
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Source looks up the secret identified by the part of a reference after the scheme.
+type Source interface {
+	Resolve(ctx context.Context, reference string) (string, error)
+}
+
+type SourceFunc func(ctx context.Context, reference string) (string, error)
+
+func (f SourceFunc) Resolve(ctx context.Context, reference string) (string, error) {
+	return f(ctx, reference)
+}
+
+// Resolver dispatches references to the source registered for their scheme.
+type Resolver struct {
+	sources map[string]Source
+}
+
+// NewResolver creates a resolver supporting the "env" and "file" schemes.
+func NewResolver() *Resolver {
+	r := &Resolver{sources: map[string]Source{}}
+	r.Register("env", SourceFunc(lookupEnv))
+	r.Register("file", SourceFunc(readFile))
+
+	return r
+}
+
+// Register adds or replaces the source for the given scheme.
+func (r *Resolver) Register(scheme string, source Source) {
+	r.sources[scheme] = source
+}
+
+// IsReference reports whether the value starts with a registered scheme.
+func (r *Resolver) IsReference(value string) bool {
+	scheme, _, found := strings.Cut(value, ":")
+	if !found {
+		return false
+	}
+
+	_, ok := r.sources[scheme]
+	return ok
+}
+
+// Resolve returns the secret referenced by value or value itself if it is no reference.
+func (r *Resolver) Resolve(ctx context.Context, value string) (string, error) {
+	if !r.IsReference(value) {
+		return value, nil
+	}
+
+	scheme, reference, _ := strings.Cut(value, ":")
+	secret, err := r.sources[scheme].Resolve(ctx, reference)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", scheme, err)
+	}
+
+	return secret, nil
+}
+
+func lookupEnv(_ context.Context, name string) (string, error) {
+	value, ok := os.LookupEnv(name)
+	if !ok {
+		return "", fmt.Errorf("environment variable '%s' is not set", name)
+	}
+
+	return value, nil
+}
+
+// readFile trims surrounding whitespace, as most editors and `echo` add a trailing newline.
+func readFile(_ context.Context, path string) (string, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("cannot read '%s' or it is no regular file: %w", path, err)
+	}
+
+	return strings.TrimSpace(string(content)), nil
+}
@@ -0,0 +1,118 @@
+package secrets
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResolver(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("Literal values", func(t *testing.T) {
+		r := NewResolver()
+
+		for _, value := range []string{"", "plain-token", "unknown:value", "https://example.com"} {
+			assert.False(t, r.IsReference(value), value)
+			secret, err := r.Resolve(ctx, value)
+			assert.NoError(t, err)
+			assert.Equal(t, value, secret)
+		}
+	})
+
+	t.Run("Environment", func(t *testing.T) {
+		t.Setenv("SECRETS_TEST_TOKEN", "from-env")
+		r := NewResolver()
+
+		secret, err := r.Resolve(ctx, "env:SECRETS_TEST_TOKEN")
+		assert.NoError(t, err)
+		assert.Equal(t, "from-env", secret)
+
+		_, err = r.Resolve(ctx, "env:SECRETS_TEST_MISSING")
+		assert.EqualError(t, err, "env: environment variable 'SECRETS_TEST_MISSING' is not set")
+	})
+
+	t.Run("File", func(t *testing.T) {
+		file := path.Join(t.TempDir(), "token")
+		_ = os.WriteFile(file, []byte("from-file\n"), 0444)
+		r := NewResolver()
+
+		secret, err := r.Resolve(ctx, "file:"+file)
+		assert.NoError(t, err)
+		assert.Equal(t, "from-file", secret, "Trailing newline must be trimmed")
+
+		_, err = r.Resolve(ctx, "file:"+file+"-missing")
+		assert.ErrorContains(t, err, "file: cannot read '"+file+"-missing'")
+	})
+
+	t.Run("Registered source", func(t *testing.T) {
+		r := NewResolver()
+		r.Register("stub", SourceFunc(func(_ context.Context, reference string) (string, error) {
+			if reference == "broken" {
+				return "", errors.New("Simulated error")
+			}
+			return "stub-" + reference, nil
+		}))
+
+		secret, err := r.Resolve(ctx, "stub:value")
+		assert.NoError(t, err)
+		assert.Equal(t, "stub-value", secret)
+
+		_, err = r.Resolve(ctx, "stub:broken")
+		assert.EqualError(t, err, "stub: Simulated error")
+	})
+}
+
+func TestKeyring(t *testing.T) {
+	ctx := context.Background()
+	newKeyring := func(goos string, out string, err error) (*Keyring, *[]string) {
+		var called []string
+		return &Keyring{
+			goos: goos,
+			run: func(_ context.Context, name string, args ...string) ([]byte, error) {
+				called = append(append(called, name), args...)
+				return []byte(out), err
+			},
+		}, &called
+	}
+
+	t.Run("Linux", func(t *testing.T) {
+		k, called := newKeyring("linux", "from-keyring\n", nil)
+
+		secret, err := k.Resolve(ctx, "gitea-sonarqube-bot/gitea")
+		assert.NoError(t, err)
+		assert.Equal(t, "from-keyring", secret)
+		assert.Equal(t, []string{"secret-tool", "lookup", "service", "gitea-sonarqube-bot", "username", "gitea"}, *called)
+	})
+
+	t.Run("macOS", func(t *testing.T) {
+		k, called := newKeyring("darwin", "from-keychain\n", nil)
+
+		secret, err := k.Resolve(ctx, "gitea-sonarqube-bot/gitea")
+		assert.NoError(t, err)
+		assert.Equal(t, "from-keychain", secret)
+		assert.Equal(t, []string{"security", "find-generic-password", "-s", "gitea-sonarqube-bot", "-a", "gitea", "-w"}, *called)
+	})
+
+	t.Run("Errors", func(t *testing.T) {
+		k, _ := newKeyring("linux", "", nil)
+		_, err := k.Resolve(ctx, "gitea-sonarqube-bot/gitea")
+		assert.EqualError(t, err, "no secret found for 'gitea-sonarqube-bot/gitea'")
+
+		_, err = k.Resolve(ctx, "gitea-sonarqube-bot")
+		assert.EqualError(t, err, "invalid reference 'gitea-sonarqube-bot', expected service/user")
+
+		k, _ = newKeyring("linux", "", errors.New("exit status 1"))
+		_, err = k.Resolve(ctx, "gitea-sonarqube-bot/gitea")
+		assert.EqualError(t, err, "cannot look up 'gitea-sonarqube-bot/gitea': exit status 1")
+
+		k, called := newKeyring("windows", "", nil)
+		_, err = k.Resolve(ctx, "gitea-sonarqube-bot/gitea")
+		assert.EqualError(t, err, "keyring is not supported on windows")
+		assert.Empty(t, *called)
+	})
+}
@@ -0,0 +1,72 @@
+package secrets
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Vault reads secrets from HashiCorp Vault. References have the form "path#field" with the API path below /v1,
+// e.g. "secret/data/sonarqube-bot#giteaToken" for the KV v2 engine mounted at "secret".
+type Vault struct {
+	Address string
+	Token   string
+	Client  *http.Client
+}
+
+type vaultResponse struct {
+	Data map[string]interface{} `json:"data"`
+}
+
+func (v *Vault) Resolve(ctx context.Context, reference string) (string, error) {
+	path, field, _ := strings.Cut(reference, "#")
+	if path == "" || field == "" {
+		return "", fmt.Errorf("invalid reference '%s', expected path#field", reference)
+	}
+
+	if v.Address == "" {
+		return "", fmt.Errorf("no Vault address configured")
+	}
+
+	url := fmt.Sprintf("%s/v1/%s", strings.TrimSuffix(v.Address, "/"), strings.TrimPrefix(path, "/"))
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("X-Vault-Token", v.Token)
+
+	client := v.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("reading '%s' failed with status %d", path, resp.StatusCode)
+	}
+
+	var body vaultResponse
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return "", fmt.Errorf("cannot decode response for '%s': %w", path, err)
+	}
+
+	data := body.Data
+	// KV v2 wraps the secret together with its metadata
+	if nested, ok := data["data"].(map[string]interface{}); ok && data["metadata"] != nil {
+		data = nested
+	}
+
+	value, ok := data[field].(string)
+	if !ok {
+		return "", fmt.Errorf("field '%s' not found in '%s'", field, path)
+	}
+
+	return value, nil
+}
@@ -0,0 +1,65 @@
+package secrets
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVault(t *testing.T) {
+	ctx := context.Background()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Vault-Token") != "vault-token" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+
+		switch r.URL.Path {
+		case "/v1/secret/data/bot":
+			_, _ = w.Write([]byte(`{"data":{"data":{"giteaToken":"from-kv2"},"metadata":{"version":3}}}`))
+		case "/v1/kv/bot":
+			_, _ = w.Write([]byte(`{"data":{"giteaToken":"from-kv1"}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	t.Run("KV v2", func(t *testing.T) {
+		v := &Vault{Address: server.URL + "/", Token: "vault-token"}
+
+		secret, err := v.Resolve(ctx, "secret/data/bot#giteaToken")
+		assert.NoError(t, err)
+		assert.Equal(t, "from-kv2", secret)
+	})
+
+	t.Run("KV v1", func(t *testing.T) {
+		v := &Vault{Address: server.URL, Token: "vault-token"}
+
+		secret, err := v.Resolve(ctx, "/kv/bot#giteaToken")
+		assert.NoError(t, err)
+		assert.Equal(t, "from-kv1", secret)
+	})
+
+	t.Run("Errors", func(t *testing.T) {
+		v := &Vault{Address: server.URL, Token: "vault-token"}
+
+		_, err := v.Resolve(ctx, "secret/data/bot#sonarQubeToken")
+		assert.EqualError(t, err, "field 'sonarQubeToken' not found in 'secret/data/bot'")
+
+		_, err = v.Resolve(ctx, "secret/data/missing#giteaToken")
+		assert.EqualError(t, err, "reading 'secret/data/missing' failed with status 404")
+
+		_, err = v.Resolve(ctx, "secret/data/bot")
+		assert.EqualError(t, err, "invalid reference 'secret/data/bot', expected path#field")
+
+		_, err = (&Vault{Address: server.URL, Token: "wrong"}).Resolve(ctx, "secret/data/bot#giteaToken")
+		assert.EqualError(t, err, "reading 'secret/data/bot' failed with status 403")
+
+		_, err = (&Vault{}).Resolve(ctx, "secret/data/bot#giteaToken")
+		assert.EqualError(t, err, "no Vault address configured")
+	})
+}
@@ -0,0 +1,74 @@
+package selfcheck
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	giteaSdk "codeberg.org/justusbunsi/gitea-sonarqube-bot/internal/clients/gitea"
+	sqSdk "codeberg.org/justusbunsi/gitea-sonarqube-bot/internal/clients/sonarqube"
+	"codeberg.org/justusbunsi/gitea-sonarqube-bot/internal/settings"
+)
+
+type Result struct {
+	Target string
+	Err    error
+}
+
+type Report struct {
+	Results []Result
+}
+
+func (r *Report) add(target string, err error) {
+	r.Results = append(r.Results, Result{Target: target, Err: err})
+}
+
+// Failed reports whether at least one check did not pass.
+func (r *Report) Failed() bool {
+	for _, result := range r.Results {
+		if result.Err != nil {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (r *Report) String() string {
+	var b strings.Builder
+	for _, result := range r.Results {
+		if result.Err != nil {
+			fmt.Fprintf(&b, "FAIL %s: %s\n", result.Target, result.Err.Error())
+		} else {
+			fmt.Fprintf(&b, "OK   %s\n", result.Target)
+		}
+	}
+
+	return b.String()
+}
+
+// Run verifies that the configured tokens are accepted and that every mapped Gitea repository and SonarQube project
+// is accessible with the permissions the bot needs.
+func Run(ctx context.Context, g giteaSdk.GiteaSdkInterface, sq sqSdk.SonarQubeSdkInterface, projects []settings.Project) *Report {
+	report := &Report{}
+
+	user, err := g.GetBotUser(ctx)
+	if err != nil {
+		report.add("Gitea authentication", err)
+	} else {
+		report.add(fmt.Sprintf("Gitea authentication as '%s'", user), nil)
+		for _, p := range projects {
+			report.add(fmt.Sprintf("Gitea repository '%s/%s'", p.Gitea.Owner, p.Gitea.Name), g.CheckRepositoryAccess(ctx, p.Gitea))
+		}
+	}
+
+	err = sq.ValidateToken(ctx)
+	report.add("SonarQube authentication", err)
+	if err == nil {
+		for _, p := range projects {
+			report.add(fmt.Sprintf("SonarQube project '%s'", p.SonarQube.Key), sq.CheckProject(ctx, p.SonarQube.Key))
+		}
+	}
+
+	return report
+}
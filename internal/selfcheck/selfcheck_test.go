@@ -0,0 +1,93 @@
+package selfcheck
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	giteaSdk "codeberg.org/justusbunsi/gitea-sonarqube-bot/internal/clients/gitea"
+	sqSdk "codeberg.org/justusbunsi/gitea-sonarqube-bot/internal/clients/sonarqube"
+	"codeberg.org/justusbunsi/gitea-sonarqube-bot/internal/settings"
+	"github.com/stretchr/testify/assert"
+)
+
+type GiteaSdkMock struct {
+	giteaSdk.GiteaSdkInterface
+	userErr error
+	repoErr error
+}
+
+func (m *GiteaSdkMock) GetBotUser(_ context.Context) (string, error) {
+	return "sonarqube-bot", m.userErr
+}
+
+func (m *GiteaSdkMock) CheckRepositoryAccess(_ context.Context, _ settings.GiteaRepository) error {
+	return m.repoErr
+}
+
+type SQSdkMock struct {
+	sqSdk.SonarQubeSdkInterface
+	tokenErr   error
+	projectErr error
+}
+
+func (m *SQSdkMock) ValidateToken(_ context.Context) error {
+	return m.tokenErr
+}
+
+func (m *SQSdkMock) CheckProject(_ context.Context, _ string) error {
+	return m.projectErr
+}
+
+var projects = []settings.Project{
+	{
+		SonarQube: struct{ Key string }{
+			Key: "test-project",
+		},
+		Gitea: settings.GiteaRepository{
+			Owner: "test-owner",
+			Name:  "test-repo",
+		},
+	},
+}
+
+func TestRun(t *testing.T) {
+	t.Run("Success", func(t *testing.T) {
+		report := Run(context.Background(), &GiteaSdkMock{}, &SQSdkMock{}, projects)
+
+		assert.False(t, report.Failed())
+		assert.Equal(t, `OK   Gitea authentication as 'sonarqube-bot'
+OK   Gitea repository 'test-owner/test-repo'
+OK   SonarQube authentication
+OK   SonarQube project 'test-project'
+`, report.String())
+	})
+
+	t.Run("Access errors", func(t *testing.T) {
+		report := Run(context.Background(), &GiteaSdkMock{
+			repoErr: errors.New("missing write permission required for commit statuses"),
+		}, &SQSdkMock{
+			projectErr: errors.New("request failed with status 404: Component key 'test-project' not found"),
+		}, projects)
+
+		assert.True(t, report.Failed())
+		assert.Equal(t, `OK   Gitea authentication as 'sonarqube-bot'
+FAIL Gitea repository 'test-owner/test-repo': missing write permission required for commit statuses
+OK   SonarQube authentication
+FAIL SonarQube project 'test-project': request failed with status 404: Component key 'test-project' not found
+`, report.String())
+	})
+
+	t.Run("Authentication errors skip project checks", func(t *testing.T) {
+		report := Run(context.Background(), &GiteaSdkMock{
+			userErr: errors.New("401 Unauthorized"),
+		}, &SQSdkMock{
+			tokenErr: errors.New("missing or invalid API token"),
+		}, projects)
+
+		assert.True(t, report.Failed())
+		assert.Equal(t, `FAIL Gitea authentication: 401 Unauthorized
+FAIL SonarQube authentication: missing or invalid API token
+`, report.String())
+	})
+}
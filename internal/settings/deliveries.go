@@ -0,0 +1,6 @@
+package settings
+
+type DeliveryLogConfig struct {
+	StoreBodies  bool
+	RedactFields []string
+}
@@ -1,12 +1,26 @@
 package settings
 
+import (
+	"fmt"
+	"strings"
+)
+
 type GiteaRepository struct {
-	Owner string
-	Name  string
+	Owner string `json:"owner"`
+	Name  string `json:"name"`
 }
 
 type GiteaConfig struct {
 	Url     string
 	Token   *Token
 	Webhook *Webhook
+	Http    *HttpConfig
+}
+
+func (c *GiteaConfig) GetPullRequestUrl(repo GiteaRepository, index int64) string {
+	return fmt.Sprintf("%s/%s/%s/pulls/%d", strings.TrimSuffix(c.Url, "/"), repo.Owner, repo.Name, index)
+}
+
+func (c *GiteaConfig) GetSourceUrl(repo GiteaRepository, ref string) string {
+	return fmt.Sprintf("%s/%s/%s/src/commit/%s", strings.TrimSuffix(c.Url, "/"), repo.Owner, repo.Name, ref)
 }
@@ -0,0 +1,76 @@
+package settings
+
+import (
+	"fmt"
+	"time"
+)
+
+type TLSConfig struct {
+	CAFile     string
+	CertFile   string
+	KeyFile    string
+	MinVersion string
+	// InsecureSkipVerify disables certificate verification entirely. Only meant for testing setups.
+	InsecureSkipVerify bool
+}
+
+type ProxyConfig struct {
+	Url     string
+	NoProxy string
+}
+
+type HttpConfig struct {
+	Timeout             time.Duration
+	ConnectTimeout      time.Duration
+	TLSHandshakeTimeout time.Duration
+	TLS                 TLSConfig
+	Proxy               ProxyConfig
+}
+
+type httpConfigExtractor interface {
+	GetString(string) string
+	GetBool(string) bool
+	GetDuration(string) time.Duration
+}
+
+var tlsVersions = map[string]bool{
+	"":    true,
+	"1.0": true,
+	"1.1": true,
+	"1.2": true,
+	"1.3": true,
+}
+
+func (c *HttpConfig) validate(confContainer string, errCallback func(string)) {
+	if !tlsVersions[c.TLS.MinVersion] {
+		errCallback(fmt.Sprintf("Invalid configuration. Unknown TLS version '%s' in '%s.http.tls.minVersion'.", c.TLS.MinVersion, confContainer))
+		return
+	}
+
+	if (c.TLS.CertFile == "") != (c.TLS.KeyFile == "") {
+		errCallback(fmt.Sprintf("Invalid configuration. '%s.http.tls.certFile' and '%s.http.tls.keyFile' must be set together.", confContainer, confContainer))
+	}
+}
+
+func NewHttpConfig(extractor httpConfigExtractor, confContainer string, errCallback func(string)) *HttpConfig {
+	c := &HttpConfig{
+		Timeout:             extractor.GetDuration(fmt.Sprintf("%s.http.timeout", confContainer)),
+		ConnectTimeout:      extractor.GetDuration(fmt.Sprintf("%s.http.connectTimeout", confContainer)),
+		TLSHandshakeTimeout: extractor.GetDuration(fmt.Sprintf("%s.http.tlsHandshakeTimeout", confContainer)),
+		TLS: TLSConfig{
+			CAFile:             extractor.GetString(fmt.Sprintf("%s.http.tls.caFile", confContainer)),
+			CertFile:           extractor.GetString(fmt.Sprintf("%s.http.tls.certFile", confContainer)),
+			KeyFile:            extractor.GetString(fmt.Sprintf("%s.http.tls.keyFile", confContainer)),
+			MinVersion:         extractor.GetString(fmt.Sprintf("%s.http.tls.minVersion", confContainer)),
+			InsecureSkipVerify: extractor.GetBool(fmt.Sprintf("%s.http.tls.insecureSkipVerify", confContainer)),
+		},
+		Proxy: ProxyConfig{
+			Url:     extractor.GetString(fmt.Sprintf("%s.http.proxy.url", confContainer)),
+			NoProxy: extractor.GetString(fmt.Sprintf("%s.http.proxy.noProxy", confContainer)),
+		},
+	}
+
+	c.validate(confContainer, errCallback)
+
+	return c
+}
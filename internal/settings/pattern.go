@@ -1,8 +1,43 @@
 package settings
 
-import "regexp"
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// templateVerb matches a decimal verb with optional flags and width, e.g. `%d` or `%03d`.
+var templateVerb = regexp.MustCompile(`%[-+# 0]*[0-9]*d`)
 
 type PatternConfig struct {
 	RegExp   *regexp.Regexp
 	Template string
 }
+
+func NewPatternConfig(extractor func(string) string, errCallback func(string)) *PatternConfig {
+	expr := extractor("namingPattern.regex")
+	template := extractor("namingPattern.template")
+
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		errCallback(fmt.Sprintf("Invalid configuration. Naming pattern regex '%s' does not compile: %s", expr, err.Error()))
+		return nil
+	}
+
+	if re.NumSubexp() != 1 {
+		errCallback(fmt.Sprintf("Invalid configuration. Naming pattern regex '%s' must have exactly one group, got %d.", expr, re.NumSubexp()))
+		return nil
+	}
+
+	// Other integer verbs like %v, %x or %o format fine but would never match the decimal index in the regex
+	verbs := strings.ReplaceAll(template, "%%", "")
+	if strings.Count(verbs, "%") != 1 || !templateVerb.MatchString(verbs) {
+		errCallback(fmt.Sprintf("Invalid configuration. Naming pattern template '%s' must have exactly one integer placeholder.", template))
+		return nil
+	}
+
+	return &PatternConfig{
+		RegExp:   re,
+		Template: template,
+	}
+}
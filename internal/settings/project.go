@@ -1,8 +1,45 @@
 package settings
 
+type MetricGroup struct {
+	Name    string   `json:"name,omitempty"`
+	Metrics []string `json:"metrics"`
+}
+
+type HotspotsConfig struct {
+	Enabled bool `json:"enabled"`
+}
+
+type CoverageConfig struct {
+	Enabled  bool `json:"enabled"`
+	MaxFiles int  `mapstructure:"maxFiles" json:"maxFiles"`
+}
+
+type DuplicationsConfig struct {
+	Enabled  bool `json:"enabled"`
+	MaxFiles int  `mapstructure:"maxFiles" json:"maxFiles"`
+}
+
 type Project struct {
 	SonarQube struct {
 		Key string
 	} `mapstructure:"sonarqube"`
-	Gitea GiteaRepository
+	Gitea        GiteaRepository
+	Metrics      []MetricGroup
+	Hotspots     HotspotsConfig
+	Coverage     CoverageConfig
+	Duplications DuplicationsConfig
+	DryRun       bool `mapstructure:"dryRun"`
+}
+
+// IsDryRun reports whether writes to the given repository must only be recorded. Unknown repositories are never
+// written in dry run mode of the whole bot.
+func IsDryRun(repo GiteaRepository) bool {
+	c := Current()
+	for _, p := range c.Projects {
+		if p.Gitea.Owner == repo.Owner && p.Gitea.Name == repo.Name {
+			return p.DryRun
+		}
+	}
+
+	return c.DryRun
 }
@@ -0,0 +1,123 @@
+package settings
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"slices"
+	"time"
+
+	"codeberg.org/justusbunsi/gitea-sonarqube-bot/internal/secrets"
+	"github.com/spf13/viper"
+)
+
+// SecretTimeout bounds resolving all secret references on load and on every refresh.
+var SecretTimeout = 10 * time.Second
+
+// NewHttpClient builds the client for secret sources like Vault. The application replaces it by the HTTP client
+// package, so TLS and proxy settings apply. The default only applies the timeout.
+var NewHttpClient = func(c *HttpConfig) (*http.Client, error) {
+	return &http.Client{Timeout: c.Timeout}, nil
+}
+
+type VaultConfig struct {
+	Address string
+	// Token may be a reference itself, e.g. to the token sink file of a Vault agent.
+	Token string
+	Http  *HttpConfig
+}
+
+type SecretsConfig struct {
+	// RefreshInterval of secret references. Refreshing is disabled if zero.
+	RefreshInterval time.Duration
+	Vault           VaultConfig
+}
+
+func NewSecretsConfig(r *viper.Viper, errCallback func(string)) SecretsConfig {
+	c := SecretsConfig{
+		RefreshInterval: r.GetDuration("secrets.refreshInterval"),
+		Vault: VaultConfig{
+			Address: r.GetString("secrets.vault.address"),
+			Token:   r.GetString("secrets.vault.token"),
+			Http:    NewHttpConfig(r, "secrets.vault", errCallback),
+		},
+	}
+
+	if c.RefreshInterval < 0 {
+		errCallback(fmt.Sprintf("Invalid configuration. Secret refresh interval must not be negative, got %s.", c.RefreshInterval))
+	}
+
+	return c
+}
+
+func (c SecretsConfig) newResolver(ctx context.Context, errCallback func(string)) *secrets.Resolver {
+	r := secrets.NewResolver()
+
+	token, err := r.Resolve(ctx, c.Vault.Token)
+	if err != nil {
+		errCallback(fmt.Sprintf("Cannot resolve Vault token: %s", err.Error()))
+	}
+
+	client, err := NewHttpClient(c.Vault.Http)
+	if err != nil {
+		errCallback(fmt.Sprintf("Cannot create Vault client: %s", err.Error()))
+	} else {
+		r.Register("vault", &secrets.Vault{
+			Address: c.Vault.Address,
+			Token:   token,
+			Client:  client,
+		})
+	}
+	r.Register("keyring", secrets.NewKeyring())
+
+	return r
+}
+
+func resolveSecret(ctx context.Context, resolver *secrets.Resolver, reference string, errCallback func(string)) (string, bool) {
+	value, err := resolver.Resolve(ctx, reference)
+	if err != nil {
+		errCallback(fmt.Sprintf("Cannot resolve secret '%s': %s", reference, err.Error()))
+		return "", false
+	}
+
+	return value, true
+}
+
+// RefreshSecrets resolves all secret references again and replaces the configuration in use by a snapshot with the
+// changed tokens and webhook secrets. Secrets that cannot be resolved keep their current value. It returns the
+// configuration keys of the changed secrets and all detected problems.
+func RefreshSecrets(ctx context.Context) (changed []string, problems []string) {
+	errCallback := func(msg string) { problems = append(problems, msg) }
+
+	ctx, cancel := context.WithTimeout(ctx, SecretTimeout)
+	defer cancel()
+
+	updates.Lock()
+	defer updates.Unlock()
+
+	c := *Current()
+	resolver := c.Secrets.newResolver(ctx, errCallback)
+
+	if t := c.Gitea.Token.refreshed(ctx, resolver, errCallback); t.Value != c.Gitea.Token.Value {
+		c.Gitea.Token = t
+		changed = append(changed, "gitea.token")
+	}
+	if w := c.Gitea.Webhook.refreshed(ctx, resolver, errCallback); !slices.Equal(w.Secrets(), c.Gitea.Webhook.Secrets()) {
+		c.Gitea.Webhook = w
+		changed = append(changed, "gitea.webhook")
+	}
+	if t := c.SonarQube.Token.refreshed(ctx, resolver, errCallback); t.Value != c.SonarQube.Token.Value {
+		c.SonarQube.Token = t
+		changed = append(changed, "sonarqube.token")
+	}
+	if w := c.SonarQube.Webhook.refreshed(ctx, resolver, errCallback); !slices.Equal(w.Secrets(), c.SonarQube.Webhook.Secrets()) {
+		c.SonarQube.Webhook = w
+		changed = append(changed, "sonarqube.webhook")
+	}
+
+	if len(changed) != 0 {
+		current.Store(&c)
+	}
+
+	return changed, problems
+}
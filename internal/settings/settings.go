@@ -1,20 +1,45 @@
 package settings
 
 import (
+	"context"
 	"fmt"
-	"regexp"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/spf13/viper"
 )
 
+// Config is a consistent snapshot of the configuration. A reload replaces the snapshot as a whole, so snapshots must
+// not be modified.
+type Config struct {
+	Gitea       GiteaConfig
+	SonarQube   SonarQubeConfig
+	Projects    []Project
+	Pattern     *PatternConfig
+	DryRun      bool
+	Tracing     TracingConfig
+	DeliveryLog DeliveryLogConfig
+	Webhooks    WebhooksConfig
+	Secrets     SecretsConfig
+}
+
 var (
-	Gitea     GiteaConfig
-	SonarQube SonarQubeConfig
-	Projects  []Project
-	Pattern   *PatternConfig
+	current atomic.Pointer[Config]
+	// updates serializes replacing the snapshot, so a secret refresh never reverts a reload
+	updates sync.Mutex
 )
 
+func init() {
+	current.Store(&Config{})
+}
+
+// Current returns the configuration snapshot in use. Read it once per operation to work with consistent values.
+func Current() *Config {
+	return current.Load()
+}
+
 func newConfigReader(configFile string) *viper.Viper {
 	v := viper.New()
 	v.SetConfigFile(configFile)
@@ -28,55 +53,194 @@ func newConfigReader(configFile string) *viper.Viper {
 	v.SetDefault("gitea.token.file", "")
 	v.SetDefault("gitea.webhook.secret", "")
 	v.SetDefault("gitea.webhook.secretFile", "")
+	v.SetDefault("gitea.http.timeout", "30s")
+	v.SetDefault("gitea.http.connectTimeout", "10s")
+	v.SetDefault("gitea.http.tlsHandshakeTimeout", "10s")
+	v.SetDefault("gitea.http.tls.caFile", "")
+	v.SetDefault("gitea.http.tls.certFile", "")
+	v.SetDefault("gitea.http.tls.keyFile", "")
+	v.SetDefault("gitea.http.tls.minVersion", "1.2")
+	v.SetDefault("gitea.http.tls.insecureSkipVerify", false)
+	v.SetDefault("gitea.http.proxy.url", "")
+	v.SetDefault("gitea.http.proxy.noProxy", "")
 	v.SetDefault("sonarqube.url", "")
 	v.SetDefault("sonarqube.token.value", "")
 	v.SetDefault("sonarqube.token.file", "")
 	v.SetDefault("sonarqube.webhook.secret", "")
 	v.SetDefault("sonarqube.webhook.secretFile", "")
+	v.SetDefault("sonarqube.http.timeout", "30s")
+	v.SetDefault("sonarqube.http.connectTimeout", "10s")
+	v.SetDefault("sonarqube.http.tlsHandshakeTimeout", "10s")
+	v.SetDefault("sonarqube.http.tls.caFile", "")
+	v.SetDefault("sonarqube.http.tls.certFile", "")
+	v.SetDefault("sonarqube.http.tls.keyFile", "")
+	v.SetDefault("sonarqube.http.tls.minVersion", "1.2")
+	v.SetDefault("sonarqube.http.tls.insecureSkipVerify", false)
+	v.SetDefault("sonarqube.http.proxy.url", "")
+	v.SetDefault("sonarqube.http.proxy.noProxy", "")
 	v.SetDefault("sonarqube.additionalMetrics", []string{})
 	v.SetDefault("projects", []Project{})
+	v.SetDefault("dryRun", false)
+	v.SetDefault("tracing.enabled", false)
+	v.SetDefault("tracing.endpoint", "")
+	v.SetDefault("tracing.sampleRatio", 1.0)
+	v.SetDefault("tracing.serviceName", "gitea-sonarqube-bot")
+	v.SetDefault("deliveryLog.storeBodies", true)
+	v.SetDefault("deliveryLog.redactFields", []string{"email"})
+	v.SetDefault("webhooks.maxBodySize", 1<<20)
+	v.SetDefault("webhooks.requireSignatures", false)
+	v.SetDefault("webhooks.allowedSources", []string{})
+	v.SetDefault("webhooks.trustedProxies", []string{})
+	v.SetDefault("webhooks.rateLimit.perSource", 0)
+	v.SetDefault("webhooks.rateLimit.perRepository", 0)
+	v.SetDefault("secrets.refreshInterval", "5m")
+	v.SetDefault("secrets.vault.address", "")
+	v.SetDefault("secrets.vault.token", "")
+	v.SetDefault("secrets.vault.http.timeout", "10s")
+	v.SetDefault("secrets.vault.http.connectTimeout", "10s")
+	v.SetDefault("secrets.vault.http.tlsHandshakeTimeout", "10s")
+	v.SetDefault("secrets.vault.http.tls.caFile", "")
+	v.SetDefault("secrets.vault.http.tls.certFile", "")
+	v.SetDefault("secrets.vault.http.tls.keyFile", "")
+	v.SetDefault("secrets.vault.http.tls.minVersion", "1.2")
+	v.SetDefault("secrets.vault.http.tls.insecureSkipVerify", false)
+	v.SetDefault("secrets.vault.http.proxy.url", "")
+	v.SetDefault("secrets.vault.http.proxy.noProxy", "")
+	// Fall back to the environment variables of the Vault CLI
+	_ = v.BindEnv("secrets.vault.address", "PRBOT_SECRETS_VAULT_ADDRESS", "VAULT_ADDR")
+	_ = v.BindEnv("secrets.vault.token", "PRBOT_SECRETS_VAULT_TOKEN", "VAULT_TOKEN")
 	v.SetDefault("namingPattern.regex", `^PR-(\d+)$`)
 	v.SetDefault("namingPattern.template", "PR-%d")
 
 	return v
 }
 
+// Load reads the configuration file and panics on the first problem.
 func Load(configFile string) {
+	c := load(configFile, func(msg string) { panic(msg) })
+
+	updates.Lock()
+	defer updates.Unlock()
+	current.Store(c)
+}
+
+// Validate reads the configuration file like Load, but returns all detected problems instead of panicking. The
+// configuration in use is not changed.
+func Validate(configFile string) []string {
+	var problems []string
+	load(configFile, func(msg string) { problems = append(problems, msg) })
+
+	return problems
+}
+
+// Reload reads the configuration file like Validate and replaces the configuration in use if no problem is detected.
+func Reload(configFile string) []string {
+	updates.Lock()
+	defer updates.Unlock()
+
+	var problems []string
+	c := load(configFile, func(msg string) { problems = append(problems, msg) })
+	if len(problems) == 0 {
+		current.Store(c)
+	}
+
+	return problems
+}
+
+func load(configFile string, errCallback func(string)) *Config {
+	c := &Config{}
 	r := newConfigReader(configFile)
 
 	err := r.ReadInConfig()
 	if err != nil {
-		panic(fmt.Errorf("fatal error while reading config file: %w", err))
+		errCallback(fmt.Sprintf("fatal error while reading config file: %s", err.Error()))
+		return c
 	}
 
 	var projects []Project
 
 	err = r.UnmarshalKey("projects", &projects)
 	if err != nil {
-		panic(fmt.Errorf("unable to load project mapping: %s", err.Error()))
+		errCallback(fmt.Sprintf("unable to load project mapping: %s", err.Error()))
+		return c
 	}
 
 	if len(projects) == 0 {
-		panic("Invalid configuration. At least one project mapping is necessary.")
+		errCallback("Invalid configuration. At least one project mapping is necessary.")
+	}
+
+	c.DryRun = r.GetBool("dryRun")
+
+	for i, p := range projects {
+		if c.DryRun {
+			projects[i].DryRun = true
+		}
+
+		if p.Coverage.Enabled && p.Coverage.MaxFiles == 0 {
+			projects[i].Coverage.MaxFiles = 10
+		}
+
+		if p.Duplications.Enabled && p.Duplications.MaxFiles == 0 {
+			projects[i].Duplications.MaxFiles = 10
+		}
+
+		for _, group := range p.Metrics {
+			if len(group.Metrics) == 0 {
+				errCallback(fmt.Sprintf("Invalid configuration. Metric group '%s' of project '%s' has no metrics.", group.Name, p.SonarQube.Key))
+			}
+		}
 	}
 
-	Projects = projects
+	c.Projects = projects
+
+	c.Secrets = NewSecretsConfig(r, errCallback)
 
-	errCallback := func(msg string) { panic(msg) }
+	ctx, cancel := context.WithTimeout(context.Background(), SecretTimeout)
+	defer cancel()
+	resolver := c.Secrets.newResolver(ctx, errCallback)
 
-	Gitea = GiteaConfig{
+	c.Gitea = GiteaConfig{
 		Url:     r.GetString("gitea.url"),
-		Token:   NewToken(r.GetString, "gitea", errCallback),
-		Webhook: NewWebhook(r.GetString, "gitea", errCallback),
+		Token:   NewToken(ctx, r.GetString, resolver, "gitea", errCallback),
+		Webhook: NewWebhook(ctx, r.GetString, resolver, "gitea", errCallback),
+		Http:    NewHttpConfig(r, "gitea", errCallback),
 	}
-	SonarQube = SonarQubeConfig{
+	c.SonarQube = SonarQubeConfig{
 		Url:               r.GetString("sonarqube.url"),
-		Token:             NewToken(r.GetString, "sonarqube", errCallback),
-		Webhook:           NewWebhook(r.GetString, "sonarqube", errCallback),
+		Token:             NewToken(ctx, r.GetString, resolver, "sonarqube", errCallback),
+		Webhook:           NewWebhook(ctx, r.GetString, resolver, "sonarqube", errCallback),
+		Http:              NewHttpConfig(r, "sonarqube", errCallback),
 		AdditionalMetrics: r.GetStringSlice("sonarqube.additionalMetrics"),
 	}
-	Pattern = &PatternConfig{
-		RegExp:   regexp.MustCompile(r.GetString("namingPattern.regex")),
-		Template: r.GetString("namingPattern.template"),
+	c.Gitea.Webhook.loadAdditionalSecrets(ctx, r, resolver, "gitea", errCallback)
+	c.SonarQube.Webhook.loadAdditionalSecrets(ctx, r, resolver, "sonarqube", errCallback)
+	c.Pattern = NewPatternConfig(r.GetString, errCallback)
+	c.Tracing = TracingConfig{
+		Enabled:     r.GetBool("tracing.enabled"),
+		Endpoint:    r.GetString("tracing.endpoint"),
+		SampleRatio: r.GetFloat64("tracing.sampleRatio"),
+		ServiceName: r.GetString("tracing.serviceName"),
 	}
+
+	c.DeliveryLog = DeliveryLogConfig{
+		StoreBodies:  r.GetBool("deliveryLog.storeBodies"),
+		RedactFields: r.GetStringSlice("deliveryLog.redactFields"),
+	}
+
+	c.Webhooks = NewWebhooksConfig(r, errCallback)
+
+	if c.Webhooks.RequireSignatures {
+		if !c.Gitea.Webhook.HasActiveSecrets(time.Now()) {
+			errCallback("Invalid configuration. Webhook signatures are required, but no Gitea webhook secret is configured.")
+		}
+		if !c.SonarQube.Webhook.HasActiveSecrets(time.Now()) {
+			errCallback("Invalid configuration. Webhook signatures are required, but no SonarQube webhook secret is configured.")
+		}
+	}
+
+	if c.Tracing.SampleRatio < 0 || c.Tracing.SampleRatio > 1 {
+		errCallback(fmt.Sprintf("Invalid configuration. Tracing sample ratio must be between 0 and 1, got %v.", c.Tracing.SampleRatio))
+	}
+
+	return c
 }
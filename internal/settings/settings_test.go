@@ -1,11 +1,18 @@
 package settings
 
 import (
+	"context"
 	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"path"
 	"regexp"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -37,6 +44,17 @@ namingPattern:
 `)
 }
 
+func defaultHttpConfig() *HttpConfig {
+	return &HttpConfig{
+		Timeout:             30 * time.Second,
+		ConnectTimeout:      10 * time.Second,
+		TLSHandshakeTimeout: 10 * time.Second,
+		TLS: TLSConfig{
+			MinVersion: "1.2",
+		},
+	}
+}
+
 func WriteConfigFile(t *testing.T, content []byte) string {
 	dir := os.TempDir()
 	config := path.Join(dir, "config.yaml")
@@ -65,7 +83,7 @@ func TestLoad(t *testing.T) {
 		_ = ioutil.WriteFile(giteaWebhookSecretFile, []byte(`gitea-totally-secret`), 0444)
 
 		giteaTokenFile := path.Join(os.TempDir(), "token-secret-gitea")
-		_ = ioutil.WriteFile(giteaTokenFile, []byte(`d0fcdeb5eaa99c506831f9eb4e63fc7cc484a565`), 0444)
+		_ = ioutil.WriteFile(giteaTokenFile, []byte("d0fcdeb5eaa99c506831f9eb4e63fc7cc484a565\n"), 0444)
 
 		sonarqubeWebhookSecretFile := path.Join(os.TempDir(), "webhook-secret-sonarqube")
 		_ = ioutil.WriteFile(sonarqubeWebhookSecretFile, []byte(`sonarqube-totally-secret`), 0444)
@@ -97,31 +115,33 @@ projects:
 		expectedGitea := GiteaConfig{
 			Url: "https://example.com/gitea",
 			Token: &Token{
-				Value: "d0fcdeb5eaa99c506831f9eb4e63fc7cc484a565",
-				file:  giteaTokenFile,
+				Value:     "d0fcdeb5eaa99c506831f9eb4e63fc7cc484a565",
+				reference: "file:" + giteaTokenFile,
 			},
 			Webhook: &Webhook{
-				Secret:     "gitea-totally-secret",
-				secretFile: giteaWebhookSecretFile,
+				Secret:          "gitea-totally-secret",
+				secretReference: "file:" + giteaWebhookSecretFile,
 			},
+			Http: defaultHttpConfig(),
 		}
 
 		expectedSonarQube := SonarQubeConfig{
 			Url: "https://example.com/sonarqube",
 			Token: &Token{
-				Value: "a09eb5785b25bb2cbacf48808a677a0709f02d8e",
-				file:  sonarqubeTokenFile,
+				Value:     "a09eb5785b25bb2cbacf48808a677a0709f02d8e",
+				reference: "file:" + sonarqubeTokenFile,
 			},
 			Webhook: &Webhook{
-				Secret:     "sonarqube-totally-secret",
-				secretFile: sonarqubeWebhookSecretFile,
+				Secret:          "sonarqube-totally-secret",
+				secretReference: "file:" + sonarqubeWebhookSecretFile,
 			},
+			Http:              defaultHttpConfig(),
 			AdditionalMetrics: []string{},
 		}
 
 		Load(c)
-		assert.EqualValues(t, expectedGitea, Gitea)
-		assert.EqualValues(t, expectedSonarQube, SonarQube)
+		assert.EqualValues(t, expectedGitea, Current().Gitea)
+		assert.EqualValues(t, expectedSonarQube, Current().SonarQube)
 
 		t.Cleanup(func() {
 			os.Remove(giteaWebhookSecretFile)
@@ -149,9 +169,87 @@ func TestLoadGitea(t *testing.T) {
 			Webhook: &Webhook{
 				Secret: "haxxor-gitea-secret",
 			},
+			Http: defaultHttpConfig(),
 		}
 
-		assert.EqualValues(t, expected, Gitea)
+		assert.EqualValues(t, expected, Current().Gitea)
+	})
+
+	t.Run("TLS and proxy", func(t *testing.T) {
+		os.Setenv("PRBOT_GITEA_HTTP_PROXY_URL", "http://proxy.example.com:3128")
+		c := WriteConfigFile(t, []byte(
+			`gitea:
+  url: https://example.com/gitea
+  token:
+    value: fake-gitea-token
+  http:
+    tls:
+      caFile: /etc/ssl/internal-ca.pem
+      certFile: /etc/ssl/bot.pem
+      keyFile: /etc/ssl/bot.key
+      minVersion: "1.3"
+    proxy:
+      noProxy: internal.example.com
+sonarqube:
+  url: https://example.com/sonarqube
+  token:
+    value: fake-sonarqube-token
+projects:
+  - sonarqube:
+      key: gitea-sonarqube-bot
+    gitea:
+      owner: example-organization
+      name: pr-bot
+`))
+		Load(c)
+
+		expectedTLS := TLSConfig{
+			CAFile:     "/etc/ssl/internal-ca.pem",
+			CertFile:   "/etc/ssl/bot.pem",
+			KeyFile:    "/etc/ssl/bot.key",
+			MinVersion: "1.3",
+		}
+		expectedProxy := ProxyConfig{
+			Url:     "http://proxy.example.com:3128",
+			NoProxy: "internal.example.com",
+		}
+
+		assert.EqualValues(t, expectedTLS, Current().Gitea.Http.TLS)
+		assert.EqualValues(t, expectedProxy, Current().Gitea.Http.Proxy)
+
+		t.Cleanup(func() {
+			os.Unsetenv("PRBOT_GITEA_HTTP_PROXY_URL")
+		})
+	})
+
+	t.Run("Invalid TLS settings", func(t *testing.T) {
+		for name, tlsConfig := range map[string]string{
+			"Unknown version":  `minVersion: "2.0"`,
+			"Certificate only": `certFile: /etc/ssl/bot.pem`,
+			"Key only":         `keyFile: /etc/ssl/bot.key`,
+		} {
+			c := WriteConfigFile(t, []byte(
+				`gitea:
+  url: https://example.com/gitea
+  token:
+    value: fake-gitea-token
+  http:
+    tls:
+      `+tlsConfig+`
+sonarqube:
+  url: https://example.com/sonarqube
+  token:
+    value: fake-sonarqube-token
+projects:
+  - sonarqube:
+      key: gitea-sonarqube-bot
+    gitea:
+      owner: example-organization
+      name: pr-bot
+`))
+
+			assert.Panics(t, func() { Load(c) }, "No panic for invalid TLS settings: %s", name)
+		}
 	})
 
 	t.Run("Injected envs", func(t *testing.T) {
@@ -168,9 +266,10 @@ func TestLoadGitea(t *testing.T) {
 			Webhook: &Webhook{
 				Secret: "injected-webhook-secret",
 			},
+			Http: defaultHttpConfig(),
 		}
 
-		assert.EqualValues(t, expected, Gitea)
+		assert.EqualValues(t, expected, Current().Gitea)
 
 		t.Cleanup(func() {
 			os.Unsetenv("PRBOT_GITEA_WEBHOOK_SECRET")
@@ -179,6 +278,73 @@ func TestLoadGitea(t *testing.T) {
 	})
 }
 
+func TestLoadWebhookSecrets(t *testing.T) {
+	t.Run("Additional secrets", func(t *testing.T) {
+		c := WriteConfigFile(t, []byte(strings.Replace(string(defaultConfig()), `    secret: haxxor-gitea-secret
+`, `    secret: haxxor-gitea-secret
+    additionalSecrets:
+      - name: previous
+        value: old-gitea-secret
+        expiresAt: 2026-12-01T00:00:00Z
+      - value: other-gitea-secret
+        expiresAt: "2027-01-15"
+`, 1)))
+		Load(c)
+
+		assert.Equal(t, []WebhookSecret{
+			{Name: PrimaryWebhookSecret, Value: "haxxor-gitea-secret"},
+			{Name: "previous", Value: "old-gitea-secret", ExpiresAt: time.Date(2026, 12, 1, 0, 0, 0, 0, time.UTC)},
+			{Name: "additional-2", Value: "other-gitea-secret", ExpiresAt: time.Date(2027, 1, 15, 0, 0, 0, 0, time.UTC)},
+		}, Current().Gitea.Webhook.Secrets())
+		assert.Nil(t, Current().SonarQube.Webhook.AdditionalSecrets)
+	})
+
+	t.Run("Invalid secrets", func(t *testing.T) {
+		c := WriteConfigFile(t, []byte(strings.Replace(string(defaultConfig()), `    secret: haxxor-sonarqube-secret
+`, `    secret: haxxor-sonarqube-secret
+    additionalSecrets:
+      - name: empty
+      - name: invalid-expiry
+        value: old-sonarqube-secret
+        expiresAt: tomorrow
+`, 1)))
+
+		assert.Equal(t, []string{
+			"Invalid configuration. Webhook secret 'empty' in 'sonarqube.webhook.additionalSecrets' has no value.",
+			"Invalid configuration. Cannot parse expiry of webhook secret 'invalid-expiry' in 'sonarqube.webhook.additionalSecrets': parsing time \"tomorrow\" as \"2006-01-02\": cannot parse \"tomorrow\" as \"2006\"",
+		}, Validate(c))
+	})
+
+	t.Run("Expired secrets only", func(t *testing.T) {
+		w := &Webhook{AdditionalSecrets: []WebhookSecret{
+			{Name: "previous", Value: "old", ExpiresAt: time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)},
+		}}
+
+		assert.True(t, w.HasActiveSecrets(time.Date(2025, 12, 31, 0, 0, 0, 0, time.UTC)))
+		assert.False(t, w.HasActiveSecrets(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)))
+	})
+}
+
+func TestGiteaGetPullRequestUrl(t *testing.T) {
+	c := &GiteaConfig{
+		Url: "https://example.com/gitea/",
+	}
+
+	actual := c.GetPullRequestUrl(GiteaRepository{Owner: "example-organization", Name: "pr-bot"}, 42)
+
+	assert.Equal(t, "https://example.com/gitea/example-organization/pr-bot/pulls/42", actual)
+}
+
+func TestGiteaGetSourceUrl(t *testing.T) {
+	c := &GiteaConfig{
+		Url: "https://example.com/gitea",
+	}
+
+	actual := c.GetSourceUrl(GiteaRepository{Owner: "example-organization", Name: "pr-bot"}, "f84442009c09b1adc278b6aa80a3853419f54007")
+
+	assert.Equal(t, "https://example.com/gitea/example-organization/pr-bot/src/commit/f84442009c09b1adc278b6aa80a3853419f54007", actual)
+}
+
 func TestLoadSonarQube(t *testing.T) {
 	t.Run("Default", func(t *testing.T) {
 		c := WriteConfigFile(t, defaultConfig())
@@ -192,9 +358,10 @@ func TestLoadSonarQube(t *testing.T) {
 			Webhook: &Webhook{
 				Secret: "haxxor-sonarqube-secret",
 			},
+			Http: defaultHttpConfig(),
 		}
 
-		assert.EqualValues(t, expected, SonarQube)
+		assert.EqualValues(t, expected, Current().SonarQube)
 		assert.EqualValues(t, expected.GetMetricsList(), "bugs,vulnerabilities,code_smells")
 	})
 
@@ -226,14 +393,50 @@ projects:
 			Webhook: &Webhook{
 				Secret: "",
 			},
+			Http: defaultHttpConfig(),
 			AdditionalMetrics: []string{
 				"new_security_hotspots",
 			},
 		}
 
-		assert.EqualValues(t, expected, SonarQube)
+		assert.EqualValues(t, expected, Current().SonarQube)
 		assert.EqualValues(t, expected.AdditionalMetrics, []string{"new_security_hotspots"})
-		assert.EqualValues(t, "bugs,vulnerabilities,code_smells,new_security_hotspots", SonarQube.GetMetricsList())
+		assert.EqualValues(t, "bugs,vulnerabilities,code_smells,new_security_hotspots", Current().SonarQube.GetMetricsList())
+	})
+
+	t.Run("HTTP timeouts", func(t *testing.T) {
+		c := WriteConfigFile(t, []byte(
+			`gitea:
+  url: https://example.com/gitea
+  token:
+    value: fake-gitea-token
+sonarqube:
+  url: https://example.com/sonarqube
+  token:
+    value: fake-sonarqube-token
+  http:
+    timeout: 1m
+    connectTimeout: 5s
+projects:
+  - sonarqube:
+      key: gitea-sonarqube-bot
+    gitea:
+      owner: example-organization
+      name: pr-bot
+`))
+		Load(c)
+
+		expected := &HttpConfig{
+			Timeout:             time.Minute,
+			ConnectTimeout:      5 * time.Second,
+			TLSHandshakeTimeout: 10 * time.Second,
+			TLS: TLSConfig{
+				MinVersion: "1.2",
+			},
+		}
+
+		assert.EqualValues(t, expected, Current().SonarQube.Http)
+		assert.EqualValues(t, defaultHttpConfig(), Current().Gitea.Http)
 	})
 
 	t.Run("Injected envs", func(t *testing.T) {
@@ -250,9 +453,10 @@ projects:
 			Webhook: &Webhook{
 				Secret: "injected-webhook-secret",
 			},
+			Http: defaultHttpConfig(),
 		}
 
-		assert.EqualValues(t, expected, SonarQube)
+		assert.EqualValues(t, expected, Current().SonarQube)
 
 		t.Cleanup(func() {
 			os.Unsetenv("PRBOT_SONARQUBE_WEBHOOK_SECRET")
@@ -278,7 +482,147 @@ func TestLoadProjects(t *testing.T) {
 			},
 		}
 
-		assert.EqualValues(t, expectedProjects, Projects)
+		assert.EqualValues(t, expectedProjects, Current().Projects)
+	})
+
+	t.Run("Metric groups", func(t *testing.T) {
+		c := WriteConfigFile(t, []byte(
+			`gitea:
+  url: https://example.com/gitea
+  token:
+    value: fake-gitea-token
+sonarqube:
+  url: https://example.com/sonarqube
+  token:
+    value: fake-sonarqube-token
+projects:
+  - sonarqube:
+      key: gitea-sonarqube-bot
+    gitea:
+      owner: example-organization
+      name: pr-bot
+    metrics:
+      - name: Coverage
+        metrics:
+          - new_coverage
+      - name: Reliability
+        metrics:
+          - new_bugs
+          - bugs
+`))
+		Load(c)
+
+		expected := []MetricGroup{
+			{
+				Name:    "Coverage",
+				Metrics: []string{"new_coverage"},
+			},
+			{
+				Name:    "Reliability",
+				Metrics: []string{"new_bugs", "bugs"},
+			},
+		}
+
+		assert.EqualValues(t, expected, Current().Projects[0].Metrics)
+		assert.EqualValues(t, expected, Current().SonarQube.GetMetricGroups(&Current().Projects[0]))
+		assert.EqualValues(t, []string{"new_coverage", "new_bugs", "bugs"}, MetricKeys(Current().SonarQube.GetMetricGroups(&Current().Projects[0])))
+	})
+
+	t.Run("Metric groups fallback", func(t *testing.T) {
+		c := WriteConfigFile(t, defaultConfig())
+		Load(c)
+
+		expected := []MetricGroup{
+			{
+				Metrics: []string{"bugs", "vulnerabilities", "code_smells"},
+			},
+		}
+
+		assert.EqualValues(t, expected, Current().SonarQube.GetMetricGroups(&Current().Projects[0]))
+	})
+
+	t.Run("Coverage defaults", func(t *testing.T) {
+		c := WriteConfigFile(t, []byte(
+			`gitea:
+  url: https://example.com/gitea
+  token:
+    value: fake-gitea-token
+sonarqube:
+  url: https://example.com/sonarqube
+  token:
+    value: fake-sonarqube-token
+projects:
+  - sonarqube:
+      key: gitea-sonarqube-bot
+    gitea:
+      owner: example-organization
+      name: pr-bot
+    coverage:
+      enabled: true
+`))
+		Load(c)
+
+		assert.EqualValues(t, CoverageConfig{Enabled: true, MaxFiles: 10}, Current().Projects[0].Coverage)
+	})
+
+	t.Run("Dry run", func(t *testing.T) {
+		config := `gitea:
+  url: https://example.com/gitea
+  token:
+    value: fake-gitea-token
+sonarqube:
+  url: https://example.com/sonarqube
+  token:
+    value: fake-sonarqube-token
+projects:
+  - sonarqube:
+      key: gitea-sonarqube-bot
+    gitea:
+      owner: example-organization
+      name: pr-bot
+    dryRun: true
+  - sonarqube:
+      key: other-project
+    gitea:
+      owner: example-organization
+      name: other-repo
+`
+		c := WriteConfigFile(t, []byte(config))
+		Load(c)
+
+		assert.True(t, IsDryRun(GiteaRepository{Owner: "example-organization", Name: "pr-bot"}))
+		assert.False(t, IsDryRun(GiteaRepository{Owner: "example-organization", Name: "other-repo"}))
+		assert.False(t, IsDryRun(GiteaRepository{Owner: "example-organization", Name: "unknown"}))
+
+		c = WriteConfigFile(t, []byte(config+"dryRun: true\n"))
+		Load(c)
+
+		assert.True(t, IsDryRun(GiteaRepository{Owner: "example-organization", Name: "other-repo"}))
+		assert.True(t, IsDryRun(GiteaRepository{Owner: "example-organization", Name: "unknown"}))
+	})
+
+	t.Run("Empty metric group", func(t *testing.T) {
+		c := WriteConfigFile(t, []byte(
+			`gitea:
+  url: https://example.com/gitea
+  token:
+    value: fake-gitea-token
+sonarqube:
+  url: https://example.com/sonarqube
+  token:
+    value: fake-sonarqube-token
+projects:
+  - sonarqube:
+      key: gitea-sonarqube-bot
+    gitea:
+      owner: example-organization
+      name: pr-bot
+    metrics:
+      - name: Coverage
+        metrics: []
+`))
+
+		assert.Panics(t, func() { Load(c) }, "No panic for metric group without metrics")
 	})
 
 	t.Run("Empty mapping", func(t *testing.T) {
@@ -303,6 +647,308 @@ projects: []
 	})
 }
 
+func TestLoadTracing(t *testing.T) {
+	t.Run("Default", func(t *testing.T) {
+		c := WriteConfigFile(t, defaultConfig())
+		Load(c)
+
+		assert.Equal(t, TracingConfig{
+			SampleRatio: 1,
+			ServiceName: "gitea-sonarqube-bot",
+		}, Current().Tracing)
+	})
+
+	t.Run("Configured", func(t *testing.T) {
+		c := WriteConfigFile(t, append(defaultConfig(), []byte(`tracing:
+  enabled: true
+  endpoint: http://otel-collector:4318
+  sampleRatio: 0.25
+`)...))
+		Load(c)
+
+		assert.Equal(t, TracingConfig{
+			Enabled:     true,
+			Endpoint:    "http://otel-collector:4318",
+			SampleRatio: 0.25,
+			ServiceName: "gitea-sonarqube-bot",
+		}, Current().Tracing)
+	})
+
+	t.Run("Invalid sample ratio", func(t *testing.T) {
+		c := WriteConfigFile(t, append(defaultConfig(), []byte(`tracing:
+  sampleRatio: 2
+`)...))
+
+		assert.Panics(t, func() { Load(c) }, "No panic for invalid sample ratio")
+	})
+}
+
+func TestLoadDeliveryLog(t *testing.T) {
+	t.Run("Default", func(t *testing.T) {
+		c := WriteConfigFile(t, defaultConfig())
+		Load(c)
+
+		assert.Equal(t, DeliveryLogConfig{
+			StoreBodies:  true,
+			RedactFields: []string{"email"},
+		}, Current().DeliveryLog)
+	})
+
+	t.Run("Configured", func(t *testing.T) {
+		c := WriteConfigFile(t, append(defaultConfig(), []byte(`deliveryLog:
+  storeBodies: false
+  redactFields:
+    - email
+    - full_name
+`)...))
+		Load(c)
+
+		assert.Equal(t, DeliveryLogConfig{
+			StoreBodies:  false,
+			RedactFields: []string{"email", "full_name"},
+		}, Current().DeliveryLog)
+	})
+}
+
+func TestLoadWebhooks(t *testing.T) {
+	t.Run("Default", func(t *testing.T) {
+		c := WriteConfigFile(t, defaultConfig())
+		Load(c)
+
+		assert.Equal(t, WebhooksConfig{
+			MaxBodySize:    1048576,
+			AllowedSources: []*net.IPNet{},
+			TrustedProxies: []string{},
+		}, Current().Webhooks)
+		assert.True(t, Current().Webhooks.IsAllowedSource("203.0.113.7"))
+	})
+
+	t.Run("Configured", func(t *testing.T) {
+		c := WriteConfigFile(t, append(defaultConfig(), []byte(`webhooks:
+  maxBodySize: 65536
+  requireSignatures: true
+  allowedSources:
+    - 10.0.0.0/8
+    - 192.0.2.10
+    - 2001:db8::/32
+  trustedProxies:
+    - 10.1.0.0/16
+  rateLimit:
+    perSource: 60
+    perRepository: 30
+`)...))
+		Load(c)
+
+		assert.Equal(t, int64(65536), Current().Webhooks.MaxBodySize)
+		assert.True(t, Current().Webhooks.RequireSignatures)
+		assert.Equal(t, []string{"10.1.0.0/16"}, Current().Webhooks.TrustedProxies)
+		assert.Equal(t, RateLimitConfig{PerSource: 60, PerRepository: 30}, Current().Webhooks.RateLimit)
+		assert.True(t, Current().Webhooks.IsAllowedSource("10.20.30.40"))
+		assert.True(t, Current().Webhooks.IsAllowedSource("192.0.2.10"))
+		assert.True(t, Current().Webhooks.IsAllowedSource("2001:db8::1"))
+		assert.False(t, Current().Webhooks.IsAllowedSource("192.0.2.11"))
+		assert.False(t, Current().Webhooks.IsAllowedSource("invalid"))
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+		c := WriteConfigFile(t, append(defaultConfig(), []byte(`webhooks:
+  maxBodySize: 0
+  allowedSources:
+    - 10.0.0.0/33
+    - example.com
+  trustedProxies:
+    - proxy
+  rateLimit:
+    perSource: -1
+`)...))
+
+		assert.Len(t, Validate(c), 5)
+	})
+
+	t.Run("Signatures required without secrets", func(t *testing.T) {
+		c := WriteConfigFile(t, []byte(`gitea:
+  url: https://example.com/gitea
+  token:
+    value: d0fcdeb5eaa99c506831f9eb4e63fc7cc484a565
+sonarqube:
+  url: https://example.com/sonarqube
+  token:
+    value: a09eb5785b25bb2cbacf48808a677a0709f02d8e
+projects:
+  - sonarqube:
+      key: gitea-sonarqube-bot
+    gitea:
+      owner: example-organization
+      name: pr-bot
+webhooks:
+  requireSignatures: true
+`))
+
+		assert.Equal(t, []string{
+			"Invalid configuration. Webhook signatures are required, but no Gitea webhook secret is configured.",
+			"Invalid configuration. Webhook signatures are required, but no SonarQube webhook secret is configured.",
+		}, Validate(c))
+		assert.Panics(t, func() { Load(c) }, "No panic for missing webhook secrets")
+	})
+}
+
+func TestLoadSecrets(t *testing.T) {
+	vault := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Vault-Token") != "vault-token" || r.URL.Path != "/v1/secret/data/bot" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		_, _ = w.Write([]byte(`{"data":{"data":{"sonarQubeToken":"token-from-vault"},"metadata":{"version":1}}}`))
+	}))
+	t.Cleanup(vault.Close)
+
+	vaultTokenFile := path.Join(t.TempDir(), "vault-token")
+	_ = ioutil.WriteFile(vaultTokenFile, []byte("vault-token\n"), 0644)
+
+	// The application builds Vault clients with the HTTP client package, which would be an import cycle here
+	newHttpClient := NewHttpClient
+	NewHttpClient = func(_ *HttpConfig) (*http.Client, error) {
+		return vault.Client(), nil
+	}
+	t.Cleanup(func() {
+		NewHttpClient = newHttpClient
+	})
+
+	referencesConfig := func() []byte {
+		return []byte(`gitea:
+  url: https://example.com/gitea
+  token:
+    value: env:SETTINGS_TEST_GITEA_TOKEN
+  webhook:
+    secret: haxxor-gitea-secret
+    additionalSecrets:
+      - name: previous
+        value: env:SETTINGS_TEST_GITEA_PREVIOUS_SECRET
+sonarqube:
+  url: https://example.com/sonarqube
+  token:
+    value: vault:secret/data/bot#sonarQubeToken
+  webhook:
+    secret: haxxor-sonarqube-secret
+projects:
+  - sonarqube:
+      key: gitea-sonarqube-bot
+    gitea:
+      owner: example-organization
+      name: pr-bot
+secrets:
+  refreshInterval: 1m
+  vault:
+    address: ` + vault.URL + `
+    token: file:` + vaultTokenFile + `
+`)
+	}
+
+	t.Run("Default", func(t *testing.T) {
+		c := WriteConfigFile(t, defaultConfig())
+		Load(c)
+
+		assert.Equal(t, 5*time.Minute, Current().Secrets.RefreshInterval)
+		assert.Equal(t, "", Current().Secrets.Vault.Address)
+		assert.Equal(t, "", Current().Secrets.Vault.Token)
+		assert.Equal(t, 10*time.Second, Current().Secrets.Vault.Http.Timeout)
+		assert.Equal(t, "1.2", Current().Secrets.Vault.Http.TLS.MinVersion)
+	})
+
+	t.Run("Vault environment", func(t *testing.T) {
+		t.Setenv("VAULT_ADDR", "https://vault.example.com")
+		t.Setenv("VAULT_TOKEN", "vault-token")
+		c := WriteConfigFile(t, defaultConfig())
+		Load(c)
+
+		assert.Equal(t, "https://vault.example.com", Current().Secrets.Vault.Address)
+		assert.Equal(t, "vault-token", Current().Secrets.Vault.Token)
+	})
+
+	t.Run("References", func(t *testing.T) {
+		t.Setenv("SETTINGS_TEST_GITEA_TOKEN", "token-from-env")
+		t.Setenv("SETTINGS_TEST_GITEA_PREVIOUS_SECRET", "previous-from-env")
+		c := WriteConfigFile(t, referencesConfig())
+		Load(c)
+
+		assert.Equal(t, time.Minute, Current().Secrets.RefreshInterval)
+		assert.Equal(t, "token-from-env", Current().Gitea.Token.Value)
+		assert.Equal(t, "token-from-vault", Current().SonarQube.Token.Value)
+		assert.Equal(t, []WebhookSecret{
+			{Name: PrimaryWebhookSecret, Value: "haxxor-gitea-secret"},
+			{Name: "previous", Value: "previous-from-env", reference: "env:SETTINGS_TEST_GITEA_PREVIOUS_SECRET"},
+		}, Current().Gitea.Webhook.Secrets())
+	})
+
+	t.Run("Unresolvable references", func(t *testing.T) {
+		c := WriteConfigFile(t, referencesConfig())
+
+		assert.Equal(t, []string{
+			"Cannot resolve secret 'env:SETTINGS_TEST_GITEA_TOKEN': env: environment variable 'SETTINGS_TEST_GITEA_TOKEN' is not set",
+			"Cannot resolve secret 'env:SETTINGS_TEST_GITEA_PREVIOUS_SECRET': env: environment variable 'SETTINGS_TEST_GITEA_PREVIOUS_SECRET' is not set",
+		}, Validate(c))
+	})
+
+	t.Run("Invalid refresh interval", func(t *testing.T) {
+		c := WriteConfigFile(t, append(defaultConfig(), []byte(`secrets:
+  refreshInterval: -1m
+`)...))
+
+		assert.Equal(t, []string{"Invalid configuration. Secret refresh interval must not be negative, got -1m0s."}, Validate(c))
+	})
+
+	t.Run("Refresh", func(t *testing.T) {
+		tokenFile := path.Join(t.TempDir(), "token")
+		_ = ioutil.WriteFile(tokenFile, []byte("first-token\n"), 0644)
+		t.Setenv("PRBOT_SONARQUBE_TOKEN_FILE", tokenFile)
+		t.Setenv("SETTINGS_TEST_GITEA_TOKEN", "token-from-env")
+		t.Setenv("SETTINGS_TEST_GITEA_PREVIOUS_SECRET", "previous-from-env")
+		Load(WriteConfigFile(t, referencesConfig()))
+
+		changed, problems := RefreshSecrets(context.Background())
+		assert.Empty(t, changed)
+		assert.Empty(t, problems)
+
+		_ = ioutil.WriteFile(tokenFile, []byte("second-token\n"), 0644)
+		t.Setenv("SETTINGS_TEST_GITEA_PREVIOUS_SECRET", "rotated-from-env")
+		os.Unsetenv("SETTINGS_TEST_GITEA_TOKEN")
+
+		changed, problems = RefreshSecrets(context.Background())
+		assert.Equal(t, []string{"gitea.webhook", "sonarqube.token"}, changed)
+		assert.Equal(t, []string{
+			"Cannot resolve secret 'env:SETTINGS_TEST_GITEA_TOKEN': env: environment variable 'SETTINGS_TEST_GITEA_TOKEN' is not set",
+		}, problems)
+		assert.Equal(t, "second-token", Current().SonarQube.Token.Value)
+		assert.Equal(t, "token-from-env", Current().Gitea.Token.Value, "Unresolvable secrets must keep their value")
+		assert.Equal(t, "rotated-from-env", Current().Gitea.Webhook.AdditionalSecrets[0].Value)
+	})
+
+	t.Run("Refresh during reload", func(t *testing.T) {
+		tokenFile := path.Join(t.TempDir(), "token")
+		_ = ioutil.WriteFile(tokenFile, []byte("first-token"), 0644)
+		t.Setenv("PRBOT_SONARQUBE_TOKEN_FILE", tokenFile)
+		Load(WriteConfigFile(t, defaultConfig()))
+
+		_ = ioutil.WriteFile(tokenFile, []byte("second-token"), 0644)
+		c := WriteConfigFile(t, []byte(strings.Replace(string(defaultConfig()), "name: pr-bot", "name: other-repo", 1)))
+
+		var wg sync.WaitGroup
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			RefreshSecrets(context.Background())
+		}()
+		go func() {
+			defer wg.Done()
+			Reload(c)
+		}()
+		wg.Wait()
+
+		assert.Equal(t, "other-repo", Current().Projects[0].Gitea.Name, "Refresh must not revert the reload")
+		assert.Equal(t, "second-token", Current().SonarQube.Token.Value)
+	})
+}
+
 func TestLoadNamingPattern(t *testing.T) {
 	t.Run("Default", func(t *testing.T) {
 		c := WriteConfigFile(t, defaultConfig())
@@ -313,7 +959,7 @@ func TestLoadNamingPattern(t *testing.T) {
 			Template: "PR-%d",
 		}
 
-		assert.EqualValues(t, expected, Pattern)
+		assert.EqualValues(t, expected, Current().Pattern)
 	})
 
 	t.Run("Internal defaults", func(t *testing.T) {
@@ -341,7 +987,7 @@ projects:
 			Template: "PR-%d",
 		}
 
-		assert.EqualValues(t, expected, Pattern)
+		assert.EqualValues(t, expected, Current().Pattern)
 	})
 
 	t.Run("Injected envs", func(t *testing.T) {
@@ -355,7 +1001,33 @@ projects:
 			Template: "test-%d-pullrequest",
 		}
 
-		assert.EqualValues(t, expected, Pattern)
+		assert.EqualValues(t, expected, Current().Pattern)
+
+		t.Cleanup(func() {
+			os.Unsetenv("PRBOT_NAMINGPATTERN_REGEX")
+			os.Unsetenv("PRBOT_NAMINGPATTERN_TEMPLATE")
+		})
+	})
+
+	t.Run("Invalid patterns", func(t *testing.T) {
+		for name, pattern := range map[string][2]string{
+			"Broken regex":     {`^PR-(\d+$`, "PR-%d"},
+			"No regex group":   {`^PR-\d+$`, "PR-%d"},
+			"Too many groups":  {`^(PR)-(\d+)$`, "PR-%d"},
+			"No placeholder":   {`^PR-(\d+)$`, "PR"},
+			"Too many verbs":   {`^PR-(\d+)$`, "PR-%d-%d"},
+			"Non-integer verb": {`^PR-(\d+)$`, "PR-%s"},
+			"Generic verb":     {`^PR-(\d+)$`, "PR-%v"},
+			"Hex verb":         {`^PR-(\d+)$`, "PR-%x"},
+			"Octal verb":       {`^PR-(\d+)$`, "PR-%o"},
+			"Dangling percent": {`^PR-(\d+)$`, "PR-%d%"},
+		} {
+			os.Setenv("PRBOT_NAMINGPATTERN_REGEX", pattern[0])
+			os.Setenv("PRBOT_NAMINGPATTERN_TEMPLATE", pattern[1])
+			c := WriteConfigFile(t, defaultConfig())
+
+			assert.Panics(t, func() { Load(c) }, "No panic for invalid naming pattern: %s", name)
+		}
 
 		t.Cleanup(func() {
 			os.Unsetenv("PRBOT_NAMINGPATTERN_REGEX")
@@ -373,10 +1045,75 @@ projects:
 			Template: "PR-%d",
 		}
 
-		assert.EqualValues(t, expected, Pattern)
+		assert.EqualValues(t, expected, Current().Pattern)
 
 		t.Cleanup(func() {
 			os.Unsetenv("PRBOT_NAMINGPATTERN_REGEX")
 		})
 	})
 }
+
+func TestValidate(t *testing.T) {
+	t.Run("Valid", func(t *testing.T) {
+		c := WriteConfigFile(t, defaultConfig())
+
+		assert.Empty(t, Validate(c))
+	})
+
+	t.Run("Missing file", func(t *testing.T) {
+		problems := Validate(path.Join(os.TempDir(), "config.yaml"))
+
+		assert.Len(t, problems, 1)
+		assert.Contains(t, problems[0], "fatal error while reading config file")
+	})
+
+	t.Run("Keeps configuration in use", func(t *testing.T) {
+		Load(WriteConfigFile(t, defaultConfig()))
+		before := Current()
+
+		c := WriteConfigFile(t, []byte(strings.Replace(string(defaultConfig()), "name: pr-bot", "name: other-repo", 1)))
+
+		assert.Empty(t, Validate(c))
+		assert.Same(t, before, Current())
+	})
+
+	t.Run("Collects all problems", func(t *testing.T) {
+		os.Setenv("PRBOT_GITEA_TOKEN_FILE", path.Join(os.TempDir(), "missing-token-gitea"))
+		os.Setenv("PRBOT_NAMINGPATTERN_TEMPLATE", "PR")
+		c := WriteConfigFile(t, defaultConfig())
+
+		problems := Validate(c)
+
+		assert.Len(t, problems, 2)
+		assert.Contains(t, problems[0], "Cannot resolve secret 'file:"+path.Join(os.TempDir(), "missing-token-gitea")+"'")
+		assert.Equal(t, "Invalid configuration. Naming pattern template 'PR' must have exactly one integer placeholder.", problems[1])
+
+		t.Cleanup(func() {
+			os.Unsetenv("PRBOT_GITEA_TOKEN_FILE")
+			os.Unsetenv("PRBOT_NAMINGPATTERN_TEMPLATE")
+		})
+	})
+}
+
+func TestReload(t *testing.T) {
+	t.Run("Apply valid configuration", func(t *testing.T) {
+		Load(WriteConfigFile(t, defaultConfig()))
+
+		c := WriteConfigFile(t, []byte(strings.Replace(string(defaultConfig()), "name: pr-bot", "name: other-repo", 1)))
+
+		assert.Empty(t, Reload(c))
+		assert.Equal(t, "other-repo", Current().Projects[0].Gitea.Name)
+	})
+
+	t.Run("Keep configuration on problems", func(t *testing.T) {
+		Load(WriteConfigFile(t, defaultConfig()))
+		before := Current()
+
+		c := WriteConfigFile(t, []byte(strings.Replace(string(defaultConfig()), `template: "PR-%d"`, `template: "PR"`, 1)))
+
+		assert.Len(t, Reload(c), 1)
+		assert.Same(t, before, Current(), "Configuration in use must not be touched")
+		assert.Equal(t, "pr-bot", Current().Projects[0].Gitea.Name)
+		assert.Equal(t, "PR-%d", Current().Pattern.Template)
+	})
+}
@@ -6,10 +6,15 @@ type SonarQubeConfig struct {
 	Url               string
 	Token             *Token
 	Webhook           *Webhook
+	Http              *HttpConfig
 	AdditionalMetrics []string
 }
 
 func (c *SonarQubeConfig) GetMetricsList() string {
+	return strings.Join(c.defaultMetrics(), ",")
+}
+
+func (c *SonarQubeConfig) defaultMetrics() []string {
 	metrics := []string{
 		"bugs",
 		"vulnerabilities",
@@ -18,5 +23,28 @@ func (c *SonarQubeConfig) GetMetricsList() string {
 	if len(c.AdditionalMetrics) != 0 {
 		metrics = append(metrics, c.AdditionalMetrics...)
 	}
-	return strings.Join(metrics, ",")
+	return metrics
+}
+
+// GetMetricGroups returns the metric groups configured for the given project. Projects without own metric
+// configuration fall back to a single unnamed group containing the default metrics and additional metrics.
+func (c *SonarQubeConfig) GetMetricGroups(p *Project) []MetricGroup {
+	if p != nil && len(p.Metrics) != 0 {
+		return p.Metrics
+	}
+
+	return []MetricGroup{
+		{
+			Metrics: c.defaultMetrics(),
+		},
+	}
+}
+
+// MetricKeys flattens the given groups into their metric keys while keeping the configured order.
+func MetricKeys(groups []MetricGroup) []string {
+	keys := []string{}
+	for _, group := range groups {
+		keys = append(keys, group.Metrics...)
+	}
+	return keys
 }
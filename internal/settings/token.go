@@ -1,36 +1,47 @@
 package settings
 
 import (
+	"context"
 	"fmt"
-	"io/ioutil"
+
+	"codeberg.org/justusbunsi/gitea-sonarqube-bot/internal/secrets"
 )
 
 type Token struct {
 	Value string
-	file  string
+	// reference is resolved to Value on load and on every refresh, e.g. "env:GITEA_TOKEN"
+	reference string
 }
 
-func (t *Token) lookupSecret(errCallback func(string)) {
-	if t.file == "" {
+func (t *Token) lookupSecret(ctx context.Context, resolver *secrets.Resolver, errCallback func(string)) {
+	if t.reference == "" {
 		return
 	}
 
-	content, err := ioutil.ReadFile(t.file)
-	if err != nil {
-		errCallback(fmt.Sprintf("Cannot read '%s' or it is no regular file: %s", t.file, err.Error()))
-		return
+	if value, ok := resolveSecret(ctx, resolver, t.reference, errCallback); ok {
+		t.Value = value
 	}
+}
 
-	t.Value = string(content)
+func (t *Token) refreshed(ctx context.Context, resolver *secrets.Resolver, errCallback func(string)) *Token {
+	c := *t
+	c.lookupSecret(ctx, resolver, errCallback)
+
+	return &c
 }
 
-func NewToken(extractor func(string) string, confContainer string, errCallback func(string)) *Token {
+func NewToken(ctx context.Context, extractor func(string) string, resolver *secrets.Resolver, confContainer string, errCallback func(string)) *Token {
 	t := &Token{
 		Value: extractor(fmt.Sprintf("%s.token.value", confContainer)),
-		file:  extractor(fmt.Sprintf("%s.token.file", confContainer)),
 	}
 
-	t.lookupSecret(errCallback)
+	if file := extractor(fmt.Sprintf("%s.token.file", confContainer)); file != "" {
+		t.reference = "file:" + file
+	} else if resolver.IsReference(t.Value) {
+		t.reference, t.Value = t.Value, ""
+	}
+
+	t.lookupSecret(ctx, resolver, errCallback)
 
 	return t
 }
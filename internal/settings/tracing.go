@@ -0,0 +1,8 @@
+package settings
+
+type TracingConfig struct {
+	Enabled     bool
+	Endpoint    string
+	SampleRatio float64
+	ServiceName string
+}
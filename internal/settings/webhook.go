@@ -1,36 +1,159 @@
 package settings
 
 import (
+	"context"
 	"fmt"
-	"io/ioutil"
+	"time"
+
+	"codeberg.org/justusbunsi/gitea-sonarqube-bot/internal/secrets"
+	"github.com/spf13/viper"
 )
 
+// Name of the secret configured by `secret` or `secretFile`
+const PrimaryWebhookSecret = "primary"
+
+// WebhookSecret is accepted for validating webhook signatures until it expires.
+type WebhookSecret struct {
+	Name  string
+	Value string
+	// ExpiresAt is the zero time for secrets that do not expire.
+	ExpiresAt time.Time
+	reference string
+}
+
+func (s WebhookSecret) IsExpired(now time.Time) bool {
+	return !s.ExpiresAt.IsZero() && !now.Before(s.ExpiresAt)
+}
+
 type Webhook struct {
-	Secret     string
-	secretFile string
+	// Secret is used to sign webhooks created by the bot and always accepted.
+	Secret          string
+	secretReference string
+	// AdditionalSecrets are accepted as well, e.g. the previous secret during a rotation.
+	AdditionalSecrets []WebhookSecret
 }
 
-func (w *Webhook) lookupSecret(errCallback func(string)) {
-	if w.secretFile == "" {
-		return
+// Secrets returns the primary and all additional secrets, including expired ones.
+func (w *Webhook) Secrets() []WebhookSecret {
+	secrets := []WebhookSecret{}
+	if w.Secret != "" {
+		secrets = append(secrets, WebhookSecret{Name: PrimaryWebhookSecret, Value: w.Secret})
+	}
+
+	return append(secrets, w.AdditionalSecrets...)
+}
+
+// HasActiveSecrets reports whether any secret is accepted for validating signatures.
+func (w *Webhook) HasActiveSecrets(now time.Time) bool {
+	for _, s := range w.Secrets() {
+		if !s.IsExpired(now) {
+			return true
+		}
 	}
 
-	content, err := ioutil.ReadFile(w.secretFile)
-	if err != nil {
-		errCallback(fmt.Sprintf("Cannot read '%s' or it is no regular file: %s", w.secretFile, err.Error()))
+	return false
+}
+
+func (w *Webhook) lookupSecrets(ctx context.Context, resolver *secrets.Resolver, errCallback func(string)) {
+	if w.secretReference != "" {
+		if value, ok := resolveSecret(ctx, resolver, w.secretReference, errCallback); ok {
+			w.Secret = value
+		}
+	}
+
+	for i, s := range w.AdditionalSecrets {
+		if s.reference == "" {
+			continue
+		}
+
+		if value, ok := resolveSecret(ctx, resolver, s.reference, errCallback); ok {
+			w.AdditionalSecrets[i].Value = value
+		}
+	}
+}
+
+func (w *Webhook) refreshed(ctx context.Context, resolver *secrets.Resolver, errCallback func(string)) *Webhook {
+	c := *w
+	c.AdditionalSecrets = append([]WebhookSecret(nil), w.AdditionalSecrets...)
+	c.lookupSecrets(ctx, resolver, errCallback)
+
+	return &c
+}
+
+type rawWebhookSecret struct {
+	Name  string
+	Value string
+	// YAML timestamps are decoded as time, quoted ones as string
+	ExpiresAt interface{}
+}
+
+func parseExpiry(value interface{}) (time.Time, error) {
+	switch v := value.(type) {
+	case nil:
+		return time.Time{}, nil
+	case time.Time:
+		return v, nil
+	case string:
+		if t, err := time.Parse(time.RFC3339, v); err == nil {
+			return t, nil
+		}
+		return time.Parse(time.DateOnly, v)
+	default:
+		return time.Time{}, fmt.Errorf("unsupported value %v", v)
+	}
+}
+
+func (w *Webhook) loadAdditionalSecrets(ctx context.Context, r *viper.Viper, resolver *secrets.Resolver, confContainer string, errCallback func(string)) {
+	key := fmt.Sprintf("%s.webhook.additionalSecrets", confContainer)
+
+	var raw []rawWebhookSecret
+	if err := r.UnmarshalKey(key, &raw); err != nil {
+		errCallback(fmt.Sprintf("Invalid configuration. Cannot load '%s': %s", key, err.Error()))
 		return
 	}
 
-	w.Secret = string(content)
+	for i, s := range raw {
+		if s.Name == "" {
+			s.Name = fmt.Sprintf("additional-%d", i+1)
+		}
+
+		if s.Value == "" {
+			errCallback(fmt.Sprintf("Invalid configuration. Webhook secret '%s' in '%s' has no value.", s.Name, key))
+			continue
+		}
+
+		expiresAt, err := parseExpiry(s.ExpiresAt)
+		if err != nil {
+			errCallback(fmt.Sprintf("Invalid configuration. Cannot parse expiry of webhook secret '%s' in '%s': %s", s.Name, key, err.Error()))
+			continue
+		}
+
+		secret := WebhookSecret{
+			Name:      s.Name,
+			Value:     s.Value,
+			ExpiresAt: expiresAt,
+		}
+		if resolver.IsReference(s.Value) {
+			secret.reference, secret.Value = s.Value, ""
+			secret.Value, _ = resolveSecret(ctx, resolver, secret.reference, errCallback)
+		}
+
+		w.AdditionalSecrets = append(w.AdditionalSecrets, secret)
+	}
 }
 
-func NewWebhook(extractor func(string) string, confContainer string, errCallback func(string)) *Webhook {
+func NewWebhook(ctx context.Context, extractor func(string) string, resolver *secrets.Resolver, confContainer string, errCallback func(string)) *Webhook {
 	w := &Webhook{
-		Secret:     extractor(fmt.Sprintf("%s.webhook.secret", confContainer)),
-		secretFile: extractor(fmt.Sprintf("%s.webhook.secretFile", confContainer)),
+		Secret: extractor(fmt.Sprintf("%s.webhook.secret", confContainer)),
+	}
+
+	if file := extractor(fmt.Sprintf("%s.webhook.secretFile", confContainer)); file != "" {
+		w.secretReference = "file:" + file
+	} else if resolver.IsReference(w.Secret) {
+		w.secretReference, w.Secret = w.Secret, ""
 	}
 
-	w.lookupSecret(errCallback)
+	w.lookupSecrets(ctx, resolver, errCallback)
 
 	return w
 }
@@ -0,0 +1,111 @@
+package settings
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+// RateLimitConfig limits webhook requests per minute. Zero disables a limit.
+type RateLimitConfig struct {
+	PerSource     int
+	PerRepository int
+}
+
+type WebhooksConfig struct {
+	// MaxBodySize is the maximum size of a webhook request body in bytes.
+	MaxBodySize int64
+	// RequireSignatures refuses to start without webhook secrets for Gitea and SonarQube.
+	RequireSignatures bool
+	// AllowedSources restricts the IP addresses webhooks are accepted from. An empty list allows all sources.
+	AllowedSources []*net.IPNet
+	// TrustedProxies may set the X-Forwarded-For header to determine the source IP address of a request.
+	TrustedProxies []string
+	RateLimit      RateLimitConfig
+}
+
+// IsAllowedSource reports whether webhooks from the IP address are accepted.
+func (c *WebhooksConfig) IsAllowedSource(ip string) bool {
+	if len(c.AllowedSources) == 0 {
+		return true
+	}
+
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return false
+	}
+
+	for _, network := range c.AllowedSources {
+		if network.Contains(parsed) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// parseNetwork accepts a CIDR notation or a single IP address.
+func parseNetwork(value string) (*net.IPNet, error) {
+	if strings.Contains(value, "/") {
+		_, network, err := net.ParseCIDR(value)
+		return network, err
+	}
+
+	ip := net.ParseIP(value)
+	if ip == nil {
+		return nil, fmt.Errorf("invalid IP address")
+	}
+
+	bits := 8 * net.IPv6len
+	if ip.To4() != nil {
+		ip = ip.To4()
+		bits = 8 * net.IPv4len
+	}
+
+	return &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}, nil
+}
+
+type webhooksConfigExtractor interface {
+	GetBool(string) bool
+	GetInt(string) int
+	GetInt64(string) int64
+	GetStringSlice(string) []string
+}
+
+func NewWebhooksConfig(extractor webhooksConfigExtractor, errCallback func(string)) WebhooksConfig {
+	c := WebhooksConfig{
+		MaxBodySize:       extractor.GetInt64("webhooks.maxBodySize"),
+		RequireSignatures: extractor.GetBool("webhooks.requireSignatures"),
+		AllowedSources:    []*net.IPNet{},
+		TrustedProxies:    extractor.GetStringSlice("webhooks.trustedProxies"),
+		RateLimit: RateLimitConfig{
+			PerSource:     extractor.GetInt("webhooks.rateLimit.perSource"),
+			PerRepository: extractor.GetInt("webhooks.rateLimit.perRepository"),
+		},
+	}
+
+	if c.MaxBodySize <= 0 {
+		errCallback(fmt.Sprintf("Invalid configuration. 'webhooks.maxBodySize' must be positive, got %d.", c.MaxBodySize))
+	}
+
+	if c.RateLimit.PerSource < 0 || c.RateLimit.PerRepository < 0 {
+		errCallback("Invalid configuration. Webhook rate limits must not be negative.")
+	}
+
+	for _, source := range extractor.GetStringSlice("webhooks.allowedSources") {
+		network, err := parseNetwork(source)
+		if err != nil {
+			errCallback(fmt.Sprintf("Invalid configuration. Cannot parse '%s' in 'webhooks.allowedSources': %s", source, err.Error()))
+			continue
+		}
+		c.AllowedSources = append(c.AllowedSources, network)
+	}
+
+	for _, proxy := range c.TrustedProxies {
+		if _, err := parseNetwork(proxy); err != nil {
+			errCallback(fmt.Sprintf("Invalid configuration. Cannot parse '%s' in 'webhooks.trustedProxies': %s", proxy, err.Error()))
+		}
+	}
+
+	return c
+}
@@ -0,0 +1,87 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+
+	"codeberg.org/justusbunsi/gitea-sonarqube-bot/internal/settings"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// InstrumentationName identifies spans created by the bot itself.
+const InstrumentationName = "codeberg.org/justusbunsi/gitea-sonarqube-bot"
+
+// Tracer returns the tracer of the bot. Without Setup, spans are not recorded.
+func Tracer() trace.Tracer {
+	return otel.Tracer(InstrumentationName)
+}
+
+// Start creates a span as child of the span in ctx.
+func Start(ctx context.Context, name string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	return Tracer().Start(ctx, name, opts...)
+}
+
+// End records err on the span, if any, and ends it.
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// NewTracerProvider creates a provider sampling the given ratio of new traces and exporting them in batches.
+// Child spans follow the sampling decision of their parent.
+func NewTracerProvider(exporter sdktrace.SpanExporter, serviceName string, ratio float64) *sdktrace.TracerProvider {
+	return sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(ratio))),
+		sdktrace.WithResource(resource.NewSchemaless(semconv.ServiceName(serviceName))),
+	)
+}
+
+// Register sets the global provider and the W3C trace context propagator.
+func Register(provider trace.TracerProvider) {
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+}
+
+// Setup exports traces via OTLP over HTTP if enabled. The returned function flushes and stops the export.
+// The endpoint falls back to the OTEL_EXPORTER_OTLP_* environment variables if empty. Endpoints without path get
+// the default path /v1/traces.
+func Setup(ctx context.Context, config *settings.TracingConfig) (func(context.Context) error, error) {
+	if !config.Enabled {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	var options []otlptracehttp.Option
+	if config.Endpoint != "" {
+		u, err := url.Parse(config.Endpoint)
+		if err != nil {
+			return nil, fmt.Errorf("invalid tracing endpoint: %w", err)
+		}
+
+		options = append(options, otlptracehttp.WithEndpointURL(config.Endpoint))
+		if u.Path == "" || u.Path == "/" {
+			options = append(options, otlptracehttp.WithURLPath("/v1/traces"))
+		}
+	}
+
+	exporter, err := otlptracehttp.New(ctx, options...)
+	if err != nil {
+		return nil, err
+	}
+
+	provider := NewTracerProvider(exporter, config.ServiceName, config.SampleRatio)
+	Register(provider)
+
+	return provider.Shutdown, nil
+}
@@ -0,0 +1,67 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"codeberg.org/justusbunsi/gitea-sonarqube-bot/internal/settings"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+func TestSetup(t *testing.T) {
+	t.Run("Disabled", func(t *testing.T) {
+		shutdown, err := Setup(context.Background(), &settings.TracingConfig{})
+
+		assert.Nil(t, err)
+		assert.Nil(t, shutdown(context.Background()))
+	})
+
+	t.Run("Enabled", func(t *testing.T) {
+		shutdown, err := Setup(context.Background(), &settings.TracingConfig{
+			Enabled:     true,
+			Endpoint:    "http://127.0.0.1:4318",
+			SampleRatio: 1,
+			ServiceName: "gitea-sonarqube-bot",
+		})
+
+		assert.Nil(t, err)
+		assert.NotNil(t, shutdown)
+
+		t.Cleanup(func() {
+			_ = shutdown(context.Background())
+			Register(noop.NewTracerProvider())
+		})
+	})
+}
+
+func TestNewTracerProvider(t *testing.T) {
+	t.Run("Sampled", func(t *testing.T) {
+		exporter := tracetest.NewInMemoryExporter()
+		provider := NewTracerProvider(exporter, "gitea-sonarqube-bot", 1)
+
+		_, span := provider.Tracer(InstrumentationName).Start(context.Background(), "review.Prepare")
+		End(span, errors.New("Simulated error"))
+		assert.Nil(t, provider.ForceFlush(context.Background()))
+
+		spans := exporter.GetSpans()
+		assert.Len(t, spans, 1)
+		assert.Equal(t, codes.Error, spans[0].Status.Code)
+		assert.Equal(t, "Simulated error", spans[0].Status.Description)
+		assert.Contains(t, spans[0].Resource.String(), "service.name=gitea-sonarqube-bot")
+	})
+
+	t.Run("Not sampled", func(t *testing.T) {
+		exporter := tracetest.NewInMemoryExporter()
+		provider := NewTracerProvider(exporter, "gitea-sonarqube-bot", 0)
+
+		_, span := provider.Tracer(InstrumentationName).Start(context.Background(), "review.Prepare")
+		End(span, nil)
+		assert.Nil(t, provider.ForceFlush(context.Background()))
+
+		assert.Empty(t, exporter.GetSpans())
+	})
+}
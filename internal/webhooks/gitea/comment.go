@@ -1,13 +1,15 @@
 package gitea
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
-	"log"
+	"log/slog"
 
 	"codeberg.org/justusbunsi/gitea-sonarqube-bot/internal/actions"
 	giteaSdk "codeberg.org/justusbunsi/gitea-sonarqube-bot/internal/clients/gitea"
 	sqSdk "codeberg.org/justusbunsi/gitea-sonarqube-bot/internal/clients/sonarqube"
+	"codeberg.org/justusbunsi/gitea-sonarqube-bot/internal/review"
 	"codeberg.org/justusbunsi/gitea-sonarqube-bot/internal/settings"
 )
 
@@ -45,7 +47,8 @@ func (w *CommentWebhook) Validate() error {
 		return fmt.Errorf("ignore non-PR hook")
 	}
 
-	found, pIdx := w.inProjectsMapping(settings.Projects)
+	projects := settings.Current().Projects
+	found, pIdx := w.inProjectsMapping(projects)
 	if !found {
 		return fmt.Errorf("ignore hook for non-configured project '%s/%s'", w.Issue.Repository.Owner, w.Issue.Repository.Name)
 	}
@@ -58,55 +61,27 @@ func (w *CommentWebhook) Validate() error {
 		return fmt.Errorf("ignore hook for non-bot action comment or unknown action")
 	}
 
-	w.ConfiguredProject = settings.Projects[pIdx]
+	w.ConfiguredProject = projects[pIdx]
 
 	return nil
 }
 
-func (w *CommentWebhook) ProcessData(gSDK giteaSdk.GiteaSdkInterface, sqSDK sqSdk.SonarQubeSdkInterface) {
-	headRef, err := gSDK.DetermineHEAD(w.ConfiguredProject.Gitea, w.Issue.Number)
-	if err != nil {
-		log.Printf("Error retrieving HEAD ref: %s", err.Error())
-		return
-	}
-	log.Printf("Fetching SonarQube data...")
+func (w *CommentWebhook) ProcessData(ctx context.Context, gSDK giteaSdk.GiteaSdkInterface, sqSDK sqSdk.SonarQubeSdkInterface) error {
+	slog.InfoContext(ctx, "Fetching SonarQube data", "repository", w.ConfiguredProject.Gitea.Owner+"/"+w.ConfiguredProject.Gitea.Name, "index", w.Issue.Number)
 
-	pr, err := sqSDK.GetPullRequest(w.ConfiguredProject.SonarQube.Key, w.Issue.Number)
+	err := review.NewService(gSDK, sqSDK).Run(ctx, w.ConfiguredProject, w.Issue.Number)
 	if err != nil {
-		log.Printf("Error loading PR data from SonarQube: %s", err.Error())
-		return
+		return fmt.Errorf("error processing review: %w", err)
 	}
 
-	status := giteaSdk.StatusOK
-	if pr.Status.QualityGateStatus != "OK" {
-		status = giteaSdk.StatusFailure
-	}
-
-	url := sqSDK.GetPullRequestUrl(w.ConfiguredProject.SonarQube.Key, w.Issue.Number)
-
-	_ = gSDK.UpdateStatus(w.ConfiguredProject.Gitea, headRef, giteaSdk.StatusDetails{
-		Url:     url,
-		Message: pr.Status.QualityGateStatus,
-		State:   status,
-	})
-
-	comment, err := sqSDK.ComposeGiteaComment(&sqSdk.CommentComposeData{
-		Key:         w.ConfiguredProject.SonarQube.Key,
-		PRName:      sqSdk.PRNameFromIndex(w.Issue.Number),
-		Url:         url,
-		QualityGate: pr.Status.QualityGateStatus,
-	})
-	if err != nil {
-		return
-	}
-	gSDK.PostComment(w.ConfiguredProject.Gitea, int(w.Issue.Number), comment)
+	return nil
 }
 
-func NewCommentWebhook(raw []byte) (*CommentWebhook, bool) {
+func NewCommentWebhook(ctx context.Context, raw []byte) (*CommentWebhook, bool) {
 	w := &CommentWebhook{}
 	err := json.Unmarshal(raw, &w)
 	if err != nil {
-		log.Printf("Error parsing Gitea webhook: %s", err.Error())
+		slog.ErrorContext(ctx, "Error parsing Gitea webhook", "error", err)
 		return w, false
 	}
 
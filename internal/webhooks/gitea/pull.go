@@ -1,9 +1,10 @@
 package gitea
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
-	"log"
+	"log/slog"
 
 	giteaSdk "codeberg.org/justusbunsi/gitea-sonarqube-bot/internal/clients/gitea"
 	sqSdk "codeberg.org/justusbunsi/gitea-sonarqube-bot/internal/clients/sonarqube"
@@ -47,7 +48,8 @@ func (w *PullWebhook) inProjectsMapping(p []settings.Project) (bool, int) {
 }
 
 func (w *PullWebhook) Validate() error {
-	found, pIdx := w.inProjectsMapping(settings.Projects)
+	projects := settings.Current().Projects
+	found, pIdx := w.inProjectsMapping(projects)
 	owner := w.RawRepository.Owner.Login
 	name := w.RawRepository.Name
 	if !found {
@@ -62,24 +64,24 @@ func (w *PullWebhook) Validate() error {
 		Owner: owner,
 		Name:  name,
 	}
-	w.ConfiguredProject = settings.Projects[pIdx]
+	w.ConfiguredProject = projects[pIdx]
 
 	return nil
 }
 
-func (w *PullWebhook) ProcessData(gSDK giteaSdk.GiteaSdkInterface, sqSDK sqSdk.SonarQubeSdkInterface) {
-	_ = gSDK.UpdateStatus(w.ConfiguredProject.Gitea, w.PullRequest.Head.Sha, giteaSdk.StatusDetails{
+func (w *PullWebhook) ProcessData(ctx context.Context, gSDK giteaSdk.GiteaSdkInterface, sqSDK sqSdk.SonarQubeSdkInterface) error {
+	return gSDK.UpdateStatus(ctx, w.ConfiguredProject.Gitea, w.PullRequest.Head.Sha, giteaSdk.StatusDetails{
 		Url:     "",
 		Message: "Analysis pending...",
 		State:   giteaSdk.StatusPending,
 	})
 }
 
-func NewPullWebhook(raw []byte) (*PullWebhook, bool) {
+func NewPullWebhook(ctx context.Context, raw []byte) (*PullWebhook, bool) {
 	w := &PullWebhook{}
 	err := json.Unmarshal(raw, &w)
 	if err != nil {
-		log.Printf("Error parsing Gitea webhook: %s", err.Error())
+		slog.ErrorContext(ctx, "Error parsing Gitea webhook", "error", err)
 		return w, false
 	}
 
@@ -1,8 +1,9 @@
 package sonarqube
 
 import (
+	"context"
 	"encoding/json"
-	"log"
+	"log/slog"
 
 	sqSdk "codeberg.org/justusbunsi/gitea-sonarqube-bot/internal/clients/sonarqube"
 )
@@ -12,9 +13,11 @@ type properties struct {
 }
 
 type Webhook struct {
-	ServerUrl string `json:"serverUrl"`
-	Revision  string `json:"revision"`
-	Project   struct {
+	ServerUrl  string `json:"serverUrl"`
+	TaskId     string `json:"taskId"`
+	AnalysedAt string `json:"analysedAt"`
+	Revision   string `json:"revision"`
+	Project    struct {
 		Key  string `json:"key"`
 		Name string `json:"name"`
 		Url  string `json:"url"`
@@ -43,18 +46,28 @@ func (w *Webhook) GetRevision() string {
 	return w.Revision
 }
 
-func New(raw []byte) (*Webhook, bool) {
+// AnalysisKey identifies the analysis the webhook was sent for. SonarQube may send the same analysis more than once.
+func (w *Webhook) AnalysisKey() string {
+	analysis := w.TaskId
+	if analysis == "" {
+		analysis = w.AnalysedAt
+	}
+
+	return w.Project.Key + "/" + analysis + "/" + w.GetRevision()
+}
+
+func New(ctx context.Context, raw []byte) (*Webhook, bool) {
 	w := &Webhook{}
 
 	err := json.Unmarshal(raw, w)
 	if err != nil {
-		log.Printf("Error parsing SonarQube webhook: %s", err.Error())
+		slog.ErrorContext(ctx, "Error parsing SonarQube webhook", "error", err)
 		return w, false
 	}
 
 	idx, err1 := sqSdk.ParsePRIndex(w.Branch.Name)
 	if err1 != nil {
-		log.Printf("Error parsing PR index: %s", err1.Error())
+		slog.ErrorContext(ctx, "Error parsing PR index", "error", err1)
 		return w, false
 	}
 
@@ -1,6 +1,7 @@
 package sonarqube
 
 import (
+	"context"
 	"regexp"
 	"testing"
 
@@ -10,12 +11,12 @@ import (
 
 func TestNewWebhook(t *testing.T) {
 	t.Run("Success", func(t *testing.T) {
-		settings.Pattern = &settings.PatternConfig{
+		settings.Current().Pattern = &settings.PatternConfig{
 			RegExp: regexp.MustCompile(`^PR-(\d+)$`),
 		}
 
 		raw := []byte(`{ "serverUrl": "https://example.com/sonarqube", "taskId": "AXouyxDpizdp4B1K", "status": "SUCCESS", "analysedAt": "2021-05-21T12:12:07+0000", "revision": "f84442009c09b1adc278b6aa80a3853419f54007", "changedAt": "2021-05-21T12:12:07+0000", "project": { "key": "pr-bot", "name": "PR Bot", "url": "https://example.com/sonarqube/dashboard?id=pr-bot" }, "branch": { "name": "PR-1337", "type": "PULL_REQUEST", "isMain": false, "url": "https://example.com/sonarqube/dashboard?id=pr-bot&pullRequest=PR-1337" }, "qualityGate": { "name": "PR Bot", "status": "OK", "conditions": [ { "metric": "new_reliability_rating", "operator": "GREATER_THAN", "value": "1", "status": "OK", "errorThreshold": "1" }, { "metric": "new_security_rating", "operator": "GREATER_THAN", "value": "1", "status": "OK", "errorThreshold": "1" }, { "metric": "new_maintainability_rating", "operator": "GREATER_THAN", "value": "1", "status": "OK", "errorThreshold": "1" }, { "metric": "new_security_hotspots_reviewed", "operator": "LESS_THAN", "status": "NO_VALUE", "errorThreshold": "100" } ] }, "properties": { "sonar.analysis.sqbot": "a84442009c09b1adc278b6bb80a3853419f54007" } }`)
-		response, ok := New(raw)
+		response, ok := New(context.Background(), raw)
 
 		assert.NotNil(t, response)
 		assert.Equal(t, 1337, response.PRIndex)
@@ -23,29 +24,29 @@ func TestNewWebhook(t *testing.T) {
 		assert.True(t, ok)
 
 		t.Cleanup(func() {
-			settings.Pattern = nil
+			settings.Current().Pattern = nil
 		})
 	})
 
 	t.Run("Invalid JSON", func(t *testing.T) {
 		raw := []byte(`{ "serverUrl": ["invalid-server-url-content"] }`)
-		_, ok := New(raw)
+		_, ok := New(context.Background(), raw)
 
 		assert.False(t, ok)
 	})
 
 	t.Run("Invalid branch name", func(t *testing.T) {
-		settings.Pattern = &settings.PatternConfig{
+		settings.Current().Pattern = &settings.PatternConfig{
 			RegExp: regexp.MustCompile(`^PR-(\d+)$`),
 		}
 
 		raw := []byte(`{ "serverUrl": "https://example.com/sonarqube", "taskId": "AXouyxDpizdp4B1K", "status": "SUCCESS", "analysedAt": "2021-05-21T12:12:07+0000", "revision": "f84442009c09b1adc278b6aa80a3853419f54007", "changedAt": "2021-05-21T12:12:07+0000", "project": { "key": "pr-bot", "name": "PR Bot", "url": "https://example.com/sonarqube/dashboard?id=pr-bot" }, "branch": { "name": "invalid", "type": "PULL_REQUEST", "isMain": false, "url": "https://example.com/sonarqube/dashboard?id=pr-bot&pullRequest=PR-1337" }, "qualityGate": { "name": "PR Bot", "status": "OK", "conditions": [ { "metric": "new_reliability_rating", "operator": "GREATER_THAN", "value": "1", "status": "OK", "errorThreshold": "1" }, { "metric": "new_security_rating", "operator": "GREATER_THAN", "value": "1", "status": "OK", "errorThreshold": "1" }, { "metric": "new_maintainability_rating", "operator": "GREATER_THAN", "value": "1", "status": "OK", "errorThreshold": "1" }, { "metric": "new_security_hotspots_reviewed", "operator": "LESS_THAN", "status": "NO_VALUE", "errorThreshold": "100" } ] }, "properties": {} }`)
-		_, ok := New(raw)
+		_, ok := New(context.Background(), raw)
 
 		assert.False(t, ok)
 
 		t.Cleanup(func() {
-			settings.Pattern = nil
+			settings.Current().Pattern = nil
 		})
 	})
 }
@@ -79,3 +80,27 @@ func TestWebhookGetRevision(t *testing.T) {
 		assert.Equal(t, w.Properties.OriginalCommit, w.GetRevision())
 	})
 }
+
+func TestWebhookAnalysisKey(t *testing.T) {
+	t.Run("Task", func(t *testing.T) {
+		w := Webhook{
+			TaskId:     "AXouyxDpizdp4B1K",
+			AnalysedAt: "2021-05-21T12:12:07+0000",
+			Revision:   "225fa0306c0ab83297d0cb5db0717b194ccb2e76",
+		}
+		w.Project.Key = "pr-bot"
+
+		assert.Equal(t, "pr-bot/AXouyxDpizdp4B1K/225fa0306c0ab83297d0cb5db0717b194ccb2e76", w.AnalysisKey())
+	})
+
+	t.Run("Analysis date without task", func(t *testing.T) {
+		w := Webhook{
+			AnalysedAt: "2021-05-21T12:12:07+0000",
+			Revision:   "225fa0306c0ab83297d0cb5db0717b194ccb2e76",
+			Properties: &properties{OriginalCommit: "a84442009c09b1adc278b6bb80a3853419f54007"},
+		}
+		w.Project.Key = "pr-bot"
+
+		assert.Equal(t, "pr-bot/2021-05-21T12:12:07+0000/a84442009c09b1adc278b6bb80a3853419f54007", w.AnalysisKey())
+	})
+}